@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "解析命令行和配置文件，输出hook点、参数的op序列、过滤规则以及要写入map的内容，不加载eBPF程序",
+	Long:  "选项与直接运行时一致，加上--json输出json格式\n\t./stackplz explain -n com.sfx.ebpf -w 'open[str,int]'",
+	Run:   explainFunc,
+}
+
+func explainFunc(command *cobra.Command, args []string) {
+	explain := mconfig.GetExplain()
+	if gconfig.FmtJson {
+		fmt.Println(explain.Json())
+	} else {
+		fmt.Println(explain.String())
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+}
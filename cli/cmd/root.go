@@ -9,15 +9,16 @@ import (
     "errors"
     "fmt"
     "io"
-    "io/ioutil"
     "log"
     "os"
     "os/signal"
     "path"
+    "runtime"
     "stackplz/assets"
     "stackplz/user/config"
     "stackplz/user/event"
     "stackplz/user/event_parser"
+    "stackplz/user/event_processor"
     "stackplz/user/module"
     "stackplz/user/rpc"
     "stackplz/user/util"
@@ -66,12 +67,36 @@ func NewLogger(log_path string) *log.Logger {
 var gconfig = config.NewGlobalConfig()
 var mconfig = config.NewModuleConfig()
 
+// 通过 -- 启动的目标程序
+var spawn_cmd *util.Spawned
+
 var rootCmd = &cobra.Command{
-    Use:               "stackplz",
+    Use:               "stackplz [flags] [-- binary args...]",
     Short:             "打印堆栈信息，目前仅支持5.10+内核，出现崩溃请升级系统版本",
     Long:              "基于eBPF的堆栈追踪工具，指定目标程序的uid、库文件路径和符号即可\n\t./stackplz --name com.sfx.ebpf --syscall openat -o tmp.log --debug",
     PersistentPreRunE: persistentPreRunEFunc,
     Run:               runFunc,
+    // 有子命令时默认不允许额外参数 这里需要支持 -- binary args...
+    Args: rootArgs,
+}
+
+func rootArgs(command *cobra.Command, args []string) error {
+    // 只有 -- 之后的参数是要启动的程序 之前多出来的参数仍然按未知子命令报错
+    dash := command.ArgsLenAtDash()
+    if dash < 0 {
+        dash = len(args)
+    }
+    if dash == 0 {
+        return nil
+    }
+    if command.SuggestionsMinimumDistance <= 0 {
+        command.SuggestionsMinimumDistance = 2
+    }
+    suggestions := ""
+    if names := command.SuggestionsFor(args[0]); len(names) > 0 {
+        suggestions = "\n\nDid you mean this?\n\t" + strings.Join(names, "\n\t") + "\n"
+    }
+    return errors.New(fmt.Sprintf("unknown command %q for %q%s", args[0], command.CommandPath(), suggestions))
 }
 
 // cobra.Command 中几个函数执行的顺序
@@ -81,10 +106,11 @@ var rootCmd = &cobra.Command{
 // PostRun
 // PersistentPostRun
 
-func persistentPreRunEFunc(command *cobra.Command, args []string) error {
+func persistentPreRunEFunc(command *cobra.Command, args []string) (err error) {
     // 在执行子命令的时候 上级命令的 PersistentPreRun/PersistentPreRunE 会先执行
 
-    var err error
+    // explain 只解析配置 不加载 eBPF 程序
+    is_explain := command.Name() == "explain"
 
     // 首先根据全局设定设置日志输出
     dir, _ := os.Getwd()
@@ -106,7 +132,11 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
     // 在 init 之后各个选项的 flag 还没有初始化 到这里才初始化 所以在这里最先设置好 logger
     logger := NewLogger(log_path)
     mconfig.SetLogger(logger)
-    if !gconfig.NoCheck {
+    if is_explain && gconfig.LogFile == "" {
+        // 标准输出留给 explain 的结果
+        logger.SetOutput(os.Stderr)
+    }
+    if !gconfig.NoCheck && !is_explain {
         // 先检查必要的配置
         err = util.CheckKernelConfig()
         if err != nil {
@@ -116,7 +146,7 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
     if gconfig.Btf {
         mconfig.ExternalBTF = ""
     } else {
-        if !util.HasEnableBTF {
+        if !util.HasEnableBTF && runtime.GOARCH == "arm64" {
             // 检查平台 判断是不是开发板
             gconfig.ExternalBTF = findBTFAssets()
             mconfig.ExternalBTF = gconfig.ExternalBTF
@@ -126,12 +156,8 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
     }
     // 这个操作有点耗时 内核版本符合要求的用不着检查 先不要这个操作
     // 检查符号情况 用于判断部分选项是否能启用
-    // has_bpf_probe_read_user, err := findKallsymsSymbol("bpf_probe_read_user")
+    // _, err = findKallsymsSymbol("bpf_probe_read_user")
     // if err != nil {
-    //     logger.Printf("bpf_probe_read_user err:%v", err)
-    //     return err
-    // }
-    // if !has_bpf_probe_read_user {
     //     logger.Printf("!!! may not support for this machine, has no bpf_probe_read_user")
     // }
 
@@ -153,6 +179,17 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
     if err = gconfig.RestoreAssets(); err != nil {
         return err
     }
+    if gconfig.NoPreload {
+        // 没有可用的栈回溯库 退化为基于帧指针的栈回溯
+        if gconfig.JavaStack {
+            logger.Printf("no preload unwinder, --jstack is disabled")
+            gconfig.JavaStack = false
+        }
+        if gconfig.UnwindStack && !gconfig.ManualStack {
+            logger.Printf("no preload unwinder, --stack falls back to frame pointer unwinding")
+        }
+        gconfig.ManualStack = true
+    }
     gconfig.InitLibraryDirs()
 
     if gconfig.Rpc {
@@ -162,6 +199,22 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
 
     gconfig.ParseArgFilter()
 
+    if len(args) > 0 && gconfig.AmStart != "" {
+        return errors.New("-- binary and --am-start can not be used together")
+    }
+    if gconfig.AmStart != "" {
+        // pkg/.Activity 通过包名的 uid 过滤 进程从 zygote 孵化开始就会被追踪
+        items := strings.SplitN(gconfig.AmStart, "/", 2)
+        if len(items) != 2 || items[0] == "" || items[1] == "" {
+            return fmt.Errorf("parse --am-start %s failed, format like com.sfx.ebpf/.MainActivity", gconfig.AmStart)
+        }
+        if gconfig.Name == "" {
+            gconfig.Name = items[0]
+        } else {
+            gconfig.Name += "," + items[0]
+        }
+    }
+
     mconfig.Parse_Idlist("UidWhitelist", gconfig.Uid)
     mconfig.Parse_Idlist("UidBlacklist", gconfig.NoUid)
     mconfig.Parse_Idlist("PidWhitelist", gconfig.Pid)
@@ -172,7 +225,14 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
     mconfig.Parse_Namelist("TNameBlacklist", gconfig.NoTName)
     mconfig.FullTName = gconfig.FullTName
 
-    pis := util.Get_PackageInfos()
+    err = mconfig.Parse_User(gconfig)
+    if err != nil {
+        return err
+    }
+    pis, err := util.Get_PackageInfos(gconfig.PackagesList)
+    if err != nil {
+        return err
+    }
     // 根据 pid 解析进程架构、获取库文件搜索路径
     for _, process_pid := range mconfig.PidWhitelist {
         process_uid := pis.FindUidByPid(process_pid)
@@ -220,12 +280,19 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
         case "iso":
             mconfig.TraceGroup |= util.GROUP_ISO
         default:
-            is_find, info := pis.FindPackageByName(pkg_name)
-            if !is_find {
-                return fmt.Errorf("can not find pkg_name=%s", pkg_name)
+            pkg_uids, err := mconfig.ResolvePackageUids(pis, pkg_name)
+            if err != nil {
+                return err
             }
             // 根据包名查找进程名 再获取库搜索路径
-            pid_list := FindPidByName(pkg_name)
+            var pid_list []uint32
+            for _, pkg_pid := range FindPidByName(pkg_name) {
+                // 其他用户下的同名进程
+                if !mconfig.MatchUser(pis.FindUidByPid(pkg_pid)) {
+                    continue
+                }
+                pid_list = append(pid_list, pkg_pid)
+            }
             for _, pkg_pid := range pid_list {
                 // 解析maps 将maps中的路径加入搜索路径中
                 search_paths, err := event.FindLibPaths(pkg_pid)
@@ -240,15 +307,54 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
             }
             // 对于system进程不添加uid
             mconfig.PidWhitelist = append(mconfig.PidWhitelist, pid_list...)
-            if info.Uid != 1000 {
-                mconfig.UidWhitelist = append(mconfig.UidWhitelist, info.Uid)
-            }
+            mconfig.UidWhitelist = append(mconfig.UidWhitelist, pkg_uids...)
             addLibPath(pkg_name)
             mconfig.PkgNamelist = append(mconfig.PkgNamelist, pkg_name)
         }
     }
+    // 按进程名或可执行文件匹配 不依赖安卓的包信息
+    for _, comm := range strings.Split(gconfig.Comm, ",") {
+        if comm == "" {
+            continue
+        }
+        pid_list := util.FindPidsByComm(comm)
+        logger.Printf("comm:%s running pids:%v", comm, pid_list)
+        mconfig.PidWhitelist = append(mconfig.PidWhitelist, pid_list...)
+        mconfig.CommNamelist = append(mconfig.CommNamelist, comm)
+    }
+    for _, exe := range strings.Split(gconfig.Exe, ",") {
+        if exe == "" {
+            continue
+        }
+        pid_list := util.FindPidsByExe(exe)
+        logger.Printf("exe:%s running pids:%v", exe, pid_list)
+        mconfig.PidWhitelist = append(mconfig.PidWhitelist, pid_list...)
+        mconfig.ExeNamelist = append(mconfig.ExeNamelist, exe)
+    }
     // 对于执行stackplz前处于运行状态的进程 保存maps
     util.SaveMaps(mconfig.PidWhitelist)
+
+    // -- 之后为要启动的程序 先以停止状态启动 等模块全部运行后再恢复
+    if dash := command.ArgsLenAtDash(); dash >= 0 && dash < len(args) && !is_explain {
+        args = args[dash:]
+        spawn_cmd, err = util.SpawnStopped(args)
+        if err != nil {
+            return err
+        }
+        // 之后的任何检查失败 都不能留下一个停止状态的子进程
+        defer func() {
+            if r := recover(); r != nil {
+                killSpawned()
+                panic(r)
+            }
+            if err != nil {
+                killSpawned()
+            }
+        }()
+        spawn_pid := uint32(spawn_cmd.Pid)
+        mconfig.PidWhitelist = append(mconfig.PidWhitelist, spawn_pid)
+        logger.Printf("spawn %s stopped, pid:%d", strings.Join(args, " "), spawn_pid)
+    }
     // 后面更新map的时候不影响 列表不去重也行
 
     mconfig.InitCommonConfig(gconfig)
@@ -280,6 +386,17 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
         if u_syscall != "" {
             gconfig.SysCall += "," + u_syscall
         }
+        if gconfig.Is32Bit() {
+            // 区分 arm/thumb 并修正 hook 地址
+            err = mconfig.StackUprobeConf.ResolveArmPoints()
+            if err != nil {
+                return err
+            }
+            // 上游 arm64 内核的 arch_uprobe_analyze_insn 对 AArch32 进程直接返回 -EOPNOTSUPP
+            if runtime.GOARCH == "arm64" {
+                logger.Printf("warn, arm64 kernel may refuse to install uprobes into 32-bit processes")
+            }
+        }
     }
 
     // 3. hook syscall
@@ -287,6 +404,7 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
 
     // 4. watch breakpoint
     var brk_base uint64 = 0x0
+    var brk_lib_path string = ""
     if gconfig.BrkLib != "" {
         if gconfig.Pid == "" {
             return errors.New("must set --pid when use --brk-lib option")
@@ -299,11 +417,15 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
         if err != nil {
             return err
         }
+        if lib_info.LibPath == "" {
+            return errors.New(fmt.Sprintf("can not find %s in maps of pid:%d", gconfig.BrkLib, value))
+        }
         brk_base = lib_info.BaseAddr
+        brk_lib_path = lib_info.LibPath
     }
 
-    if gconfig.BrkAddr != "" && strings.HasPrefix(gconfig.BrkAddr, "0x") {
-        if gconfig.BrkLen <= 0 && gconfig.BrkLen > 8 {
+    if gconfig.BrkAddr != "" {
+        if gconfig.BrkLen <= 0 || gconfig.BrkLen > 8 {
             return errors.New(fmt.Sprintf("BrkLen %d invaild, support [1, 8]", gconfig.BrkLen))
         }
         mconfig.BrkLen = gconfig.BrkLen
@@ -327,11 +449,77 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
         } else {
             return errors.New("BrkType not set, choose:r,w,x,rw")
         }
-        addr, err := strconv.ParseUint(strings.TrimPrefix(infos[0], "0x"), 16, 64)
+        addr, err := parseBrkAddr(infos[0], brk_lib_path)
         if err != nil {
             return errors.New(fmt.Sprintf("parse for %s failed, err:%v", gconfig.BrkAddr, err))
         }
         mconfig.BrkAddr = brk_base + addr
+        if gconfig.BrkArgs != "" {
+            if mconfig.BrkAddr&0xffff000000000000 > 0 {
+                return errors.New("--brk-args is not supported for kernel address")
+            }
+            if err := mconfig.Parse_BrkArgs(gconfig.BrkArgs); err != nil {
+                return errors.New(fmt.Sprintf("parse for %s failed, err:%v", gconfig.BrkArgs, err))
+            }
+        }
+    } else if gconfig.BrkArgs != "" {
+        return errors.New("--brk-args must work with --brk")
+    }
+
+    // 5. flight recorder
+    err = mconfig.Parse_FlightRecorder(gconfig)
+    if err != nil {
+        return err
+    }
+    if mconfig.Recorder.IsEnable() {
+        logger.Printf("flight recorder enabled, size:%d", mconfig.Recorder.Size)
+    }
+
+    // 6. syscall summary
+    err = mconfig.Parse_Summary(gconfig)
+    if err != nil {
+        return err
+    }
+
+    // 7. flamegraph
+    if mconfig.FlameGraph != "" {
+        if !mconfig.UnwindStack {
+            return errors.New("--flamegraph must work with --stack")
+        }
+        logger.Printf("flamegraph will be saved to %s.folded and %s.svg", mconfig.FlameGraph, mconfig.FlameGraph)
+    }
+
+    // 8. caller filter
+    err = mconfig.Parse_Caller(gconfig)
+    if err != nil {
+        return err
+    }
+    if gconfig.Caller != "" && !mconfig.SysCallConf.Enable && len(mconfig.StackUprobeConf.Points) == 0 {
+        return errors.New("--caller must work with -s/--syscall or -w/--point")
+    }
+    if mconfig.Caller.IsEnable() {
+        logger.Printf("caller filter enabled, groups:%v", mconfig.Caller.Groups)
+    }
+
+    // 9. stack match
+    err = mconfig.Parse_StackMatch(gconfig)
+    if err != nil {
+        return err
+    }
+    if mconfig.StackMatch.IsEnable() {
+        logger.Printf("stack match enabled, rules:%s", mconfig.StackMatch.String())
+    }
+
+    // 10. session limits
+    err = mconfig.Parse_Session(gconfig)
+    if err != nil {
+        return err
+    }
+
+    // 11. process tree
+    err = mconfig.Parse_ProcTree(gconfig)
+    if err != nil {
+        return err
     }
 
     // 检查hook设定
@@ -356,8 +544,15 @@ func persistentPreRunEFunc(command *cobra.Command, args []string) error {
         }
         logger.Printf("set breakpoint at kernel:%t, addr:0x%x, type:%d", mconfig.BrkKernel, mconfig.BrkAddr, mconfig.BrkType)
     }
+    if mconfig.Crash {
+        enable_hook = true
+        logger.Printf("capture crash, report dir:%s", mconfig.CrashDir)
+    }
     if !enable_hook {
-        logger.Fatal("hook nothing, plz set -w/--point or -s/--syscall or --brk")
+        return errors.New("hook nothing, plz set -w/--point or -s/--syscall or --brk or --crash")
+    }
+    if is_explain {
+        return nil
     }
     if gconfig.ParseFile != "" {
         parser := event_parser.NewEventParser()
@@ -378,8 +573,16 @@ func runFunc(command *cobra.Command, args []string) {
         rpc.StartRpcServer(stopper, gconfig.RpcPath)
         os.Exit(0)
     }
+    // 模块启动过程中 panic 同样不能留下停止状态的子进程
+    defer func() {
+        if r := recover(); r != nil {
+            killSpawned()
+            panic(r)
+        }
+    }()
     var runMods uint8
     var runModules = make(map[string]module.IModule)
+    var exit_code int = config.SESSION_EXIT_SIGNAL
     var wg sync.WaitGroup
 
     var modNames []string
@@ -391,8 +594,20 @@ func runFunc(command *cobra.Command, args []string) {
     } else if len(mconfig.StackUprobeConf.Points) > 0 {
         modNames = append(modNames, module.MODULE_NAME_PERF)
         modNames = append(modNames, module.MODULE_NAME_STACK)
-    } else {
-        Logger.Fatal("hook nothing, plz set -w/--point or -s/--syscall or --brk")
+    } else if !mconfig.Crash {
+        killSpawned()
+        Logger.Fatal("hook nothing, plz set -w/--point or -s/--syscall or --brk or --crash")
+    }
+    if mconfig.Crash {
+        // 崩溃报告依赖 mmap2 事件解析符号
+        if !slices.Contains(modNames, module.MODULE_NAME_PERF) {
+            modNames = append(modNames, module.MODULE_NAME_PERF)
+        }
+        modNames = append(modNames, module.MODULE_NAME_CRASH)
+    }
+    if slices.Contains(modNames, module.MODULE_NAME_SYSCALL) || slices.Contains(modNames, module.MODULE_NAME_STACK) {
+        // 跟踪 execve 之后的映像变化
+        modNames = append(modNames, module.MODULE_NAME_EXEC)
     }
     for _, modName := range modNames {
         // 现在合并成只有一个模块了 所以直接通过名字获取
@@ -402,6 +617,7 @@ func runFunc(command *cobra.Command, args []string) {
         err := mod.Run()
         if err != nil {
             Logger.Printf("%s\tmodule Run failed, [skip it]. error:%+v", mod.Name(), err)
+            killSpawned()
             os.Exit(1)
         }
         runModules[mod.Name()] = mod
@@ -414,6 +630,25 @@ func runFunc(command *cobra.Command, args []string) {
     }
     if runMods > 0 {
         Logger.Printf("start %d modules", runMods)
+        if spawn_cmd != nil {
+            err := util.ResumeSpawned(spawn_cmd)
+            if err != nil {
+                // detach 失败时子进程已经被结束掉
+                spawn_cmd = nil
+                Logger.Fatalf("resume spawned process failed, err:%v", err)
+            }
+            Logger.Printf("resume spawned process, pid:%d", spawn_cmd.Pid)
+            // 已经恢复运行 之后由 tracer 线程负责回收
+            spawn_cmd = nil
+        }
+        if gconfig.AmStart != "" {
+            // -S 先停止已经运行的实例 保证从头开始追踪
+            content, err := util.RunCommand("am", "start", "-S", "-n", gconfig.AmStart)
+            if err != nil {
+                Logger.Fatalf("am start %s failed, err:%v", gconfig.AmStart, err)
+            }
+            Logger.Printf("am start %s\n%s", gconfig.AmStart, strings.TrimSpace(content))
+        }
         go func() {
             scanner := bufio.NewScanner(os.Stdin)
             for {
@@ -430,9 +665,19 @@ func runFunc(command *cobra.Command, args []string) {
             }
         }()
 
-        <-stopper
+        if mconfig.Session.IsEnable() {
+            session := event_processor.GetSession(mconfig, Logger)
+            session.Start()
+            select {
+            case <-stopper:
+            case exit_code = <-session.Done():
+            }
+        } else {
+            <-stopper
+        }
     } else {
         Logger.Println("No runnable modules, Exit(1)")
+        killSpawned()
         os.Exit(1)
     }
     cancelFun()
@@ -448,10 +693,23 @@ func runFunc(command *cobra.Command, args []string) {
     wg.Wait()
     // 关闭打开的dump文件
     mconfig.DumpClose()
-    os.Exit(0)
+    os.Exit(exit_code)
+}
+
+func killSpawned() {
+    // 以停止状态启动的子进程还没有恢复 出错时直接结束掉
+    if spawn_cmd == nil {
+        return
+    }
+    util.KillSpawned(spawn_cmd)
+    spawn_cmd = nil
 }
 
 func addLibPath(name string) {
+    // pm 命令只在安卓上有
+    if !util.IsAndroid() {
+        return
+    }
     content, err := util.RunCommand("pm", "path", name)
     if err != nil {
         panic(err)
@@ -470,9 +728,12 @@ func addLibPath(name string) {
                     gconfig.LibraryDirs = append(gconfig.LibraryDirs, apk_path)
                 }
             }
-            // 将 apk + /lib/arm64 作为搜索路径
+            // 将 apk + /lib/arm64 作为搜索路径 32 位则是 /lib/arm
             items := strings.Split(parts[1], "/")
             lib_search_path := strings.Join(items[:len(items)-1], "/") + "/lib/arm64"
+            if gconfig.Is32Bit() {
+                lib_search_path = strings.Join(items[:len(items)-1], "/") + "/lib/arm"
+            }
             _, err = os.Stat(lib_search_path)
             if err == nil {
                 if !slices.Contains(gconfig.LibraryDirs, lib_search_path) {
@@ -501,24 +762,43 @@ func findBTFAssets() string {
     return btf_file
 }
 
-func findKallsymsSymbol(symbol string) (bool, error) {
-    find := false
-    content, err := ioutil.ReadFile("/proc/kallsyms")
-    if err != nil {
-        return find, fmt.Errorf("Error when opening file:%v", err)
-    }
-    lines := string(content)
-    for _, line := range strings.Split(lines, "\n") {
-        parts := strings.SplitN(line, " ", 3)
-        if len(parts) != 3 {
-            continue
-        }
-        if parts[2] == symbol {
-            find = true
-            break
+func findKallsymsSymbol(symbol string) (uint64, error) {
+    // 返回符号在 kallsyms 中的地址 kptr_restrict 生效时地址全为 0 此时返回错误
+    return util.FindKallsymsAddr(symbol)
+}
+
+func parseBrkAddr(addr_str, lib_path string) (uint64, error) {
+    // 支持的格式
+    // 0x7a3c81e8 直接给出地址 或者 --brk-lib 时给出相对库基址的偏移
+    // sys_openat 内核符号 从 kallsyms 中查找
+    // open+0x10 配合 --brk-lib 时从库的符号表中查找
+    if strings.HasPrefix(addr_str, "0x") {
+        return strconv.ParseUint(strings.TrimPrefix(addr_str, "0x"), 16, 64)
+    }
+    var sym_offset uint64 = 0
+    symbol := addr_str
+    if index := strings.Index(addr_str, "+"); index != -1 {
+        symbol = addr_str[:index]
+        offset, err := strconv.ParseUint(addr_str[index+1:], 0, 64)
+        if err != nil {
+            return 0, err
         }
+        sym_offset = offset
+    }
+    if symbol == "" {
+        return 0, errors.New("symbol is empty")
     }
-    return find, nil
+    var sym_addr uint64
+    var err error
+    if lib_path != "" {
+        sym_addr, err = util.FindElfSymbolAddr(lib_path, symbol)
+    } else {
+        sym_addr, err = findKallsymsSymbol(symbol)
+    }
+    if err != nil {
+        return 0, err
+    }
+    return sym_addr + sym_offset, nil
 }
 
 func DumpSymbolRet() {
@@ -584,6 +864,9 @@ func FindPidByName(name string) []uint32 {
 
 func GetSdkInt() uint32 {
     var sdk_int uint32 = 29
+    if !util.IsAndroid() {
+        return sdk_int
+    }
     content, err := util.RunCommand("getprop", "ro.build.version.sdk")
     if err != nil {
         Logger.Printf("exec failed -> getprop ro.build.version.sdk")
@@ -623,9 +906,11 @@ func init() {
     rootCmd.PersistentFlags().StringVar(&gconfig.NoUid, "no-uid", "", "uid black list")
     rootCmd.PersistentFlags().StringVar(&gconfig.NoPid, "no-pid", "", "pid black list")
     rootCmd.PersistentFlags().StringVar(&gconfig.NoTid, "no-tid", "", "tid black list")
+    rootCmd.PersistentFlags().StringVar(&gconfig.Comm, "comm", "", "process name white list, also match processes started later")
+    rootCmd.PersistentFlags().StringVar(&gconfig.Exe, "exe", "", "executable path or file name white list, also match processes started later")
 
-    rootCmd.PersistentFlags().StringVar(&gconfig.TName, "tname", "", "thread name white list")
-    rootCmd.PersistentFlags().StringVar(&gconfig.NoTName, "no-tname", "", "thread name black list")
+    rootCmd.PersistentFlags().StringVar(&gconfig.TName, "tname", "", "thread name white list, support glob like OkHttp*")
+    rootCmd.PersistentFlags().StringVar(&gconfig.NoTName, "no-tname", "", "thread name black list, support glob like pool-*")
     rootCmd.PersistentFlags().BoolVar(&gconfig.FullTName, "full-tname", false, "disable default thread name black list")
     rootCmd.PersistentFlags().StringArrayVarP(&gconfig.ArgFilter, "filter", "f", []string{}, "arg filter rule")
 
@@ -635,10 +920,11 @@ func init() {
     rootCmd.PersistentFlags().BoolVar(&gconfig.Rpc, "rpc", false, "enable rpc")
     rootCmd.PersistentFlags().StringVar(&gconfig.RpcPath, "rpc-path", "127.0.0.1:41718", "rpc path, default 127.0.0.1:41718")
     // 硬件断点设定
-    rootCmd.PersistentFlags().StringVar(&gconfig.BrkAddr, "brk", "", "set hardware breakpoint address")
+    rootCmd.PersistentFlags().StringVar(&gconfig.BrkAddr, "brk", "", "set hardware breakpoint, format: addr|symbol[+off]:r|w|x|rw, e.g. 0x1234:x sys_openat:x open+0x10:x")
     rootCmd.PersistentFlags().IntVar(&gconfig.BrkPid, "brk-pid", -1, "set hardware breakpoint pid, just keep default")
-    rootCmd.PersistentFlags().StringVar(&gconfig.BrkLib, "brk-lib", "", "as library base address, work with -p/--pid option")
+    rootCmd.PersistentFlags().StringVar(&gconfig.BrkLib, "brk-lib", "", "as library base address, work with -p/--pid option, symbol of --brk will be searched in this library")
     rootCmd.PersistentFlags().Uint64Var(&gconfig.BrkLen, "brk-len", 4, "hardware breakpoint length, default 4, support [1, 8]")
+    rootCmd.PersistentFlags().StringVar(&gconfig.BrkArgs, "brk-args", "", "read args when hardware breakpoint hit, same format as -w/--point args, e.g. [str:x0,buf:32:x1]")
     // 缓冲区大小设定 单位M
     rootCmd.PersistentFlags().Uint32VarP(&gconfig.Buffer, "buffer", "b", 8, "perf cache buffer size, default 8M")
     rootCmd.PersistentFlags().Uint32Var(&gconfig.MaxOp, "maxop", 64, "max operation count for uprobe, at least 192 for string array")
@@ -673,5 +959,28 @@ func init() {
     rootCmd.PersistentFlags().StringVarP(&gconfig.SysCall, "syscall", "s", "", "filter syscalls")
     rootCmd.PersistentFlags().StringVar(&gconfig.NoSysCall, "no-syscall", "", "syscall black list, max 20")
     // config hook
+    rootCmd.PersistentFlags().Uint32Var(&gconfig.FlightRecorder, "flight-recorder", 0, "keep the last N events per thread in memory, only output them when trigger hit")
+    rootCmd.PersistentFlags().StringVar(&gconfig.FRSysCall, "fr-syscall", "", "flight recorder trigger syscalls, same format as -s/--syscall, e.g. kill,exit_group")
+    rootCmd.PersistentFlags().StringArrayVar(&gconfig.FRPoint, "fr-point", []string{}, "flight recorder trigger point, same format as -w/--point, must be hooked")
+    rootCmd.PersistentFlags().StringVar(&gconfig.FRSignal, "fr-signal", "", "flight recorder trigger crash signals, e.g. SIGSEGV,SIGABRT or all, must work with --crash")
+    rootCmd.PersistentFlags().BoolVar(&gconfig.Summary, "summary", false, "count calls/errors/latency of syscalls like strace -c, print table at exit")
+    rootCmd.PersistentFlags().StringVar(&gconfig.SummaryBy, "summary-by", "syscall", "summary group by syscall/pid/tid")
+    rootCmd.PersistentFlags().Uint32Var(&gconfig.SummaryInterval, "summary-interval", 0, "print summary table every N seconds, 0 means only at exit")
+    rootCmd.PersistentFlags().StringVar(&gconfig.FlameGraph, "flamegraph", "", "aggregate backtraces per hook point, write <prefix>.folded and <prefix>.svg at exit, work with --stack")
+    rootCmd.PersistentFlags().StringVar(&gconfig.Caller, "caller", "", "only trace calls from these libraries, e.g. libfoo.so,libbar.so")
+    rootCmd.PersistentFlags().StringArrayVar(&gconfig.StackMatch, "stack-match", []string{}, "only output events whose backtrace has a frame matching module or symbol, support glob, prefix ! to exclude, work with --stack")
+    rootCmd.PersistentFlags().Uint64Var(&gconfig.MaxEvents, "max-events", 0, "stop after output N events, exit code 2")
+    rootCmd.PersistentFlags().StringVar(&gconfig.Duration, "duration", "", "stop after a duration, e.g. 30s 5m, exit code 3")
+    rootCmd.PersistentFlags().BoolVar(&gconfig.ExitWithTarget, "exit-with-target", false, "stop when all target processes exited, exit code 4")
+    rootCmd.PersistentFlags().StringVar(&gconfig.User, "user", "0", "android user id of target packages, or all, e.g. 10 for work profile")
+    rootCmd.PersistentFlags().StringVar(&gconfig.PackagesList, "packages-list", util.DEFAULT_PACKAGES_LIST, "path of packages.list used to resolve package uid")
+    rootCmd.PersistentFlags().BoolVar(&gconfig.ProcTree, "proc-tree", false, "collect lifecycle of traced processes and threads, print tree at exit")
+    rootCmd.PersistentFlags().Uint32Var(&gconfig.ProcTreeInterval, "proc-tree-interval", 0, "print process tree every N seconds, 0 means only at exit")
+    rootCmd.PersistentFlags().BoolVar(&gconfig.NoFollowExec, "no-follow-exec", false, "stop tracing a process after it calls execve")
+    rootCmd.PersistentFlags().StringVar(&gconfig.AmStart, "am-start", "", "start activity after all modules running, e.g. com.sfx.ebpf/.MainActivity")
+    rootCmd.PersistentFlags().BoolVar(&gconfig.Crash, "crash", false, "capture crash of target, write report when SIGSEGV/SIGBUS/SIGABRT/SIGILL/SIGTRAP delivered")
+    rootCmd.PersistentFlags().StringVar(&gconfig.CrashDir, "crash-dir", "crash", "directory to save crash report")
     rootCmd.PersistentFlags().StringArrayVarP(&gconfig.ConfigFiles, "config", "c", []string{}, "hook config file")
+    rootCmd.PersistentFlags().StringVar(&gconfig.DebugFile, "debug-file", "", "elf file with DWARF info for dwarf: types, default is the -l/--lib library")
+    rootCmd.PersistentFlags().Uint32Var(&gconfig.StructDepth, "struct-depth", 2, "max depth to expand nested or pointed structs of types/dwarf: types")
 }
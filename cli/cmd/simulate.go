@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"stackplz/user/config"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate fixture.json...",
+	Short: "按json中给出的参数、寄存器和内存模拟eBPF读取参数并解析，不需要内核参与",
+	Long:  "json中有expect时检查解析结果，任意一个不一致时退出码为1，可以作为参数写法和解析的测试\n\t./stackplz simulate test/sim/*.json",
+	Args:  cobra.MinimumNArgs(1),
+	// 不需要 root 命令中释放库文件、检查内核之类的准备工作
+	PersistentPreRunE: func(command *cobra.Command, args []string) error {
+		return nil
+	},
+	Run: simulateFunc,
+}
+
+func simulateFunc(command *cobra.Command, args []string) {
+	failed := 0
+	for _, path := range args {
+		if err := simulateFixture(path); err != nil {
+			fmt.Printf("[FAIL] %s\n\t%v\n", path, err)
+			failed += 1
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d/%d fixtures failed\n", failed, len(args))
+		os.Exit(1)
+	}
+}
+
+func simulateFixture(path string) error {
+	fixture, err := config.LoadSimFixture(path)
+	if err != nil {
+		return err
+	}
+	result, err := fixture.Verify()
+	if err != nil {
+		return err
+	}
+	if result == nil || len(fixture.Expect) > 0 {
+		fmt.Printf("[PASS] %s\n", path)
+		return nil
+	}
+	// 没有 expect 时输出解析结果
+	if gconfig.FmtJson {
+		data, err := json.Marshal(result.Json)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+	} else {
+		fmt.Printf("%s (%s) skip:%t\n", path, strings.Join(result.Args, ", "), result.Skip)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+}
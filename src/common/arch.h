@@ -3,7 +3,9 @@
 
 #include "bpf_helpers.h"
 #include "bpf_tracing.h"
+#include "bpf_core_read.h"
 #include "common/common.h"
+#include "common/consts.h"
 
 #if defined(__TARGET_ARCH_x86)
     #define PT_REGS_PARM6(ctx) ((ctx)->r9)
@@ -11,4 +13,159 @@
     #define PT_REGS_PARM6(x) ((x)->regs[5])
 #endif
 
+#if defined(__TARGET_ARCH_x86)
+// vmlinux 头文件来自 arm64 内核 x86_64 的 pt_regs 借助 CO-RE 按字段名重定位
+struct pt_regs___x86 {
+    unsigned long r15;
+    unsigned long r14;
+    unsigned long r13;
+    unsigned long r12;
+    unsigned long bp;
+    unsigned long bx;
+    unsigned long r11;
+    unsigned long r10;
+    unsigned long r9;
+    unsigned long r8;
+    unsigned long ax;
+    unsigned long cx;
+    unsigned long dx;
+    unsigned long si;
+    unsigned long di;
+    unsigned long orig_ax;
+    unsigned long ip;
+    unsigned long cs;
+    unsigned long flags;
+    unsigned long sp;
+    unsigned long ss;
+} __attribute__((preserve_access_index));
+#endif
+
+// 以下辅助函数屏蔽不同架构 pt_regs 的差异
+
+static __always_inline bool is_compat_task(struct task_struct *task)
+{
+#if defined(__TARGET_ARCH_x86)
+    // x86 上暂不支持 32 位进程
+    return false;
+#else
+    return BPF_CORE_READ(task, thread_info.flags) & _TIF_32BIT;
+#endif
+}
+
+static __always_inline u64 read_syscallno(struct pt_regs *regs)
+{
+#if defined(__TARGET_ARCH_x86)
+    struct pt_regs___x86 *x86_regs = (struct pt_regs___x86 *) regs;
+    return BPF_CORE_READ(x86_regs, orig_ax);
+#else
+    return READ_KERN(regs->syscallno);
+#endif
+}
+
+static __always_inline u64 read_retval(struct pt_regs *regs)
+{
+#if defined(__TARGET_ARCH_x86)
+    struct pt_regs___x86 *x86_regs = (struct pt_regs___x86 *) regs;
+    return BPF_CORE_READ(x86_regs, ax);
+#else
+    return READ_KERN(regs->regs[0]);
+#endif
+}
+
+static __always_inline u64 read_signed_retval(struct pt_regs *regs, u32 is_32bit)
+{
+    // 32 位进程的返回值只有低 32 位有效 符号扩展后才能判断正负
+    u64 ret = read_retval(regs);
+    if (is_32bit) {
+        ret = (u64)(s64)(s32)ret;
+    }
+    return ret;
+}
+
+static __always_inline u64 read_sp(struct pt_regs *regs, u32 is_32bit)
+{
+    u64 sp = 0;
+#if defined(__TARGET_ARCH_x86)
+    struct pt_regs___x86 *x86_regs = (struct pt_regs___x86 *) regs;
+    sp = BPF_CORE_READ(x86_regs, sp);
+#else
+    if (is_32bit) {
+        bpf_probe_read_kernel(&sp, sizeof(sp), &regs->regs[13]);
+    } else {
+        bpf_probe_read_kernel(&sp, sizeof(sp), &regs->sp);
+    }
+#endif
+    return sp;
+}
+
+static __always_inline u64 read_pc(struct pt_regs *regs)
+{
+    u64 pc = 0;
+#if defined(__TARGET_ARCH_x86)
+    struct pt_regs___x86 *x86_regs = (struct pt_regs___x86 *) regs;
+    pc = BPF_CORE_READ(x86_regs, ip);
+#else
+    bpf_probe_read_kernel(&pc, sizeof(pc), &regs->pc);
+#endif
+    return pc;
+}
+
+static __always_inline u64 read_lr(struct pt_regs *regs, u32 is_32bit)
+{
+    u64 lr = 0;
+#if defined(__TARGET_ARCH_x86)
+    // x86 没有 lr 函数入口/系统调用时 返回地址位于栈顶
+    // 对系统调用而言栈顶不一定是返回地址 这里只作为近似的调用来源
+    u64 sp = read_sp(regs, is_32bit);
+    bpf_probe_read_user(&lr, sizeof(lr), (void *) sp);
+#else
+    if (is_32bit) {
+        bpf_probe_read_kernel(&lr, sizeof(lr), &regs->regs[14]);
+    } else {
+        bpf_probe_read_kernel(&lr, sizeof(lr), &regs->regs[30]);
+    }
+#endif
+    return lr;
+}
+
+// 按 ctx_regs_t 的布局保存寄存器 参数寄存器统一放在 regs[0] 开始的位置
+// 这样 reg_index 读参数的逻辑不用区分架构
+static __always_inline void read_ctx_regs(struct pt_regs *regs, ctx_regs_t *saved, bool is_syscall)
+{
+#if defined(__TARGET_ARCH_x86)
+    struct pt_regs___x86 *x86_regs = (struct pt_regs___x86 *) regs;
+    saved->regs[0] = BPF_CORE_READ(x86_regs, di);
+    saved->regs[1] = BPF_CORE_READ(x86_regs, si);
+    saved->regs[2] = BPF_CORE_READ(x86_regs, dx);
+    // 第四个参数 系统调用用 r10 普通函数调用用 rcx
+    if (is_syscall) {
+        saved->regs[3] = BPF_CORE_READ(x86_regs, r10);
+    } else {
+        saved->regs[3] = BPF_CORE_READ(x86_regs, cx);
+    }
+    saved->regs[4] = BPF_CORE_READ(x86_regs, r8);
+    saved->regs[5] = BPF_CORE_READ(x86_regs, r9);
+    saved->regs[6] = BPF_CORE_READ(x86_regs, ax);
+    saved->regs[7] = BPF_CORE_READ(x86_regs, bx);
+    saved->regs[8] = BPF_CORE_READ(x86_regs, bp);
+    saved->regs[9] = BPF_CORE_READ(x86_regs, cx);
+    saved->regs[10] = BPF_CORE_READ(x86_regs, r10);
+    saved->regs[11] = BPF_CORE_READ(x86_regs, r11);
+    saved->regs[12] = BPF_CORE_READ(x86_regs, r12);
+    saved->regs[13] = BPF_CORE_READ(x86_regs, r13);
+    saved->regs[14] = BPF_CORE_READ(x86_regs, r14);
+    saved->regs[15] = BPF_CORE_READ(x86_regs, r15);
+    saved->sp = BPF_CORE_READ(x86_regs, sp);
+    saved->pc = BPF_CORE_READ(x86_regs, ip);
+    // 返回地址放在 lr 对应的位置
+    saved->regs[30] = read_lr(regs, 0);
+#else
+    for (int i = 0; i < 31; i++) {
+        saved->regs[i] = READ_KERN(regs->regs[i]);
+    }
+    saved->sp = READ_KERN(regs->sp);
+    saved->pc = READ_KERN(regs->pc);
+#endif
+}
+
 #endif
\ No newline at end of file
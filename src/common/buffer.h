@@ -194,6 +194,67 @@ static __always_inline int save_str_to_buf(event_data_t *event, void *ptr, u8 in
     return 0;
 }
 
+static __always_inline int save_str_len_to_buf(event_data_t *event, void *ptr, u32 size, u8 index)
+{
+    // 与 save_str_to_buf 一致 但最多读取 size 字节 包含结尾的 \x00
+    // 成功时返回读取的字节数 失败时返回 -1
+
+    if (event->buf_off > ARGS_BUF_SIZE - 1)
+        return -1;
+
+    // Save argument index
+    event->args[event->buf_off] = index;
+
+    // Satisfy verifier for probe read
+    if (event->buf_off > ARGS_BUF_SIZE - (MAX_STRING_SIZE + 1 + sizeof(int)))
+        return -1;
+
+    if (size > MAX_STRING_SIZE)
+        size = MAX_STRING_SIZE;
+    if (size == 0)
+        return -1;
+
+    // Read into buffer
+    int sz =
+        bpf_probe_read_str(&(event->args[event->buf_off + 1 + sizeof(int)]), size, ptr);
+    if (sz >= 0) {
+        barrier();
+        // Satisfy verifier for probe read
+        if (event->buf_off > ARGS_BUF_SIZE - (MAX_STRING_SIZE + 1 + sizeof(int)))
+            return -1;
+
+        __builtin_memcpy(&(event->args[event->buf_off + 1]), &sz, sizeof(int));
+        event->buf_off += sz + sizeof(int) + 1;
+        event->context.argnum++;
+        return sz;
+    }
+
+    return -1;
+}
+
+static __always_inline int save_empty_to_buf(event_data_t *event, u8 index)
+{
+    // 只保存 [index][0] 不需要像 save_bytes_to_buf 那样为数据预留空间
+    // 用于分段读取失败时占位 这样段数始终是固定的 只有剩余空间不足 5 字节时才会失败
+    if (event->buf_off > ARGS_BUF_SIZE - (sizeof(int) + 1))
+        return 0;
+
+    event->args[event->buf_off] = index;
+    int size = 0;
+    __builtin_memcpy(&(event->args[event->buf_off + 1]), &size, sizeof(int));
+    event->buf_off += sizeof(int) + 1;
+    event->context.argnum++;
+    return 1;
+}
+
+static __always_inline int probe_str_len(event_data_t *event, void *ptr)
+{
+    // 只计算字符串剩余部分的长度 最多 MAX_STRING_SIZE 字节 包含结尾的 \x00
+    // 借用 buf_off 之后的空间作为临时缓冲区 不会改变 buf_off
+    if (event->buf_off > ARGS_BUF_SIZE - MAX_STRING_SIZE)
+        return -1;
+    return bpf_probe_read_str(&(event->args[event->buf_off]), MAX_STRING_SIZE, ptr);
+}
 
 static __always_inline int events_perf_submit(program_data_t *p, u32 id)
 {
@@ -7,7 +7,9 @@
 #define MAX_PATH_COMPONENTS   48
 #define MAX_LOOP_COUNT 32
 #define MAX_STRCMP_LEN 256
+#define MAX_CALLER_RANGE_COUNT 32
 #define STRARR_MAGIC_LEN 0xffff0000
+#define STR_LEN_UNTERMINATED 0x100000000
 
 #if defined(__MODULE_STACK)
     #define MAX_OP_COUNT 64
@@ -32,6 +34,7 @@
 #define MAX_STRING_SIZE    4096       // same as PATH_MAX
 #define MAX_BYTES_ARR_SIZE    4096       // same as PATH_MAX
 #define MAX_BUF_READ_SIZE    4096
+#define READ_PAGE_SIZE    4096       // 按 4K 切分 更大的页同样适用
 #define ARGS_BUF_SIZE       32000
 
 // 配合 common_list 使用的 它们的间隔范围都是 0x400
@@ -52,6 +55,10 @@
 #define TRACE_COMMON 0
 #define TRACE_ALL 1
 
+// uid = userId * PER_USER_RANGE + appId
+#define PER_USER_RANGE 100000
+#define TRACE_USER_ALL 0xffffffff
+
 enum buf_idx_e
 {
     STRING_BUF_IDX,
@@ -25,6 +25,9 @@ static __always_inline u64 should_trace(program_data_t *p)
 
     // 线程名放在最前面
     u32* thread_name_flag = bpf_map_lookup_elem(&thread_filter, &p->event->context.comm);
+    if (thread_name_flag == NULL) {
+        thread_name_flag = bpf_map_lookup_elem(&thread_name_match, &context->tid);
+    }
     if (config->thread_whitelist == 1) {
         if (thread_name_flag == NULL) {
             return 0;
@@ -97,14 +100,86 @@ static __always_inline u64 should_trace(program_data_t *p)
     if (((filter->trace_uid_group & GROUP_SHELL) == GROUP_SHELL) && (context->uid == 2000)) {
         return 1;
     }
-    if (((filter->trace_uid_group & GROUP_APP) == GROUP_APP) && (context->uid >= 10000) && (context->uid <= 19999)) {
+    // 多用户和工作资料中的应用 uid 带有 userId 按 appId 判断分组
+    u32 app_id = context->uid % PER_USER_RANGE;
+    u32 user_id = context->uid / PER_USER_RANGE;
+    if (filter->trace_user != TRACE_USER_ALL && filter->trace_user != user_id) {
+        return 0;
+    }
+    if (((filter->trace_uid_group & GROUP_APP) == GROUP_APP) && (app_id >= 10000) && (app_id <= 19999)) {
         return 1;
     }
-    if (((filter->trace_uid_group & GROUP_ISO) == GROUP_ISO) && (context->uid >= 99000) && (context->uid <= 99999)) {
+    if (((filter->trace_uid_group & GROUP_ISO) == GROUP_ISO) && (app_id >= 99000) && (app_id <= 99999)) {
         return 1;
     }
 
     return 0;
 }
 
+static __always_inline bool match_caller(u32 caller_mask, u64 lr)
+{
+    // 没有设置调用来源库 不过滤
+    if (caller_mask == 0)
+        return true;
+
+    #pragma unroll
+    for (u32 i = 0; i < MAX_CALLER_RANGE_COUNT; i++) {
+        u32 key = i;
+        caller_range_t* range = bpf_map_lookup_elem(&caller_ranges, &key);
+        // 用户态保证有效范围是连续存放的
+        if (unlikely(range == NULL) || range->mask == 0)
+            break;
+        if ((range->mask & caller_mask) && lr >= range->start && lr < range->end)
+            return true;
+    }
+    return false;
+}
+
+static __always_inline bool has_point_limit(point_args_t* point_args)
+{
+    return point_args->max_hits > 0 || point_args->skip_first > 0 || point_args->every_nth > 1 || point_args->max_per_second > 0;
+}
+
+// 在所有过滤完成后调用 返回 false 表示本次不输出
+// 为了兼容较低版本的内核 不使用原子操作的返回值 并发时计数可能存在少量偏差
+static __always_inline bool check_point_limit(point_args_t* point_args, u32 point_key)
+{
+    if (!has_point_limit(point_args))
+        return true;
+
+    point_counter_t* counter = bpf_map_lookup_elem(&point_counter, &point_key);
+    if (counter == NULL) {
+        point_counter_t zero = {};
+        bpf_map_update_elem(&point_counter, &point_key, &zero, BPF_NOEXIST);
+        counter = bpf_map_lookup_elem(&point_counter, &point_key);
+        if (unlikely(counter == NULL))
+            return false;
+    }
+
+    __sync_fetch_and_add(&counter->hits, 1);
+    u64 hits = counter->hits;
+    if (hits <= point_args->skip_first)
+        goto drop;
+    if (point_args->every_nth > 1 && (hits - point_args->skip_first) % point_args->every_nth != 0)
+        goto drop;
+    if (point_args->max_hits > 0 && counter->output >= point_args->max_hits)
+        goto drop;
+    if (point_args->max_per_second > 0) {
+        u64 now = bpf_ktime_get_ns();
+        if (now - counter->window_start >= 1000000000) {
+            counter->window_start = now;
+            counter->window_count = 0;
+        }
+        if (counter->window_count >= point_args->max_per_second)
+            goto drop;
+        __sync_fetch_and_add(&counter->window_count, 1);
+    }
+    __sync_fetch_and_add(&counter->output, 1);
+    return true;
+
+drop:
+    __sync_fetch_and_add(&counter->dropped, 1);
+    return false;
+}
+
 #endif
\ No newline at end of file
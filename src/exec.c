@@ -0,0 +1,135 @@
+#include "types.h"
+#include "common/arguments.h"
+#include "common/common.h"
+#include "common/consts.h"
+#include "common/context.h"
+#include "common/filtering.h"
+#include "common/fork.h"
+
+#include "utils.h"
+
+// exec 事件单独使用一个 perf map 不需要寄存器和栈数据
+struct {
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} exec_events SEC(".maps");
+
+// 线程退出事件 用于记录退出码
+struct {
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} task_exit_events SEC(".maps");
+
+// sched_process_exec 触发时 comm 已经是新程序的了 所以在进入 execve 时先记下来
+BPF_LRU_HASH(exec_comm_map, u32, thread_name_t, 1024);
+
+#define MAX_EXEC_ARGV_SIZE 1024
+
+// 系统调用号按调用者自身是否为 32 位进程选择 与编译的是哪个版本无关
+#if defined(__TARGET_ARCH_x86)
+#define NR_EXECVE_64        59
+#define NR_EXECVEAT_64      322
+#define NR_EXECVE_32        11
+#define NR_EXECVEAT_32      358
+#else
+#define NR_EXECVE_64        221
+#define NR_EXECVEAT_64      281
+#define NR_EXECVE_32        11
+#define NR_EXECVEAT_32      387
+#endif
+
+SEC("raw_tracepoint/sys_enter")
+int tracepoint__raw_syscalls__sys_enter(struct bpf_raw_tracepoint_args* ctx)
+{
+    struct task_struct *task = (struct task_struct *) bpf_get_current_task();
+    if (unlikely(task == NULL)) return 0;
+
+    u64 sysno = ctx->args[1];
+    if (is_compat_task(task)) {
+        if (sysno != NR_EXECVE_32 && sysno != NR_EXECVEAT_32) return 0;
+    } else {
+        if (sysno != NR_EXECVE_64 && sysno != NR_EXECVEAT_64) return 0;
+    }
+
+    thread_name_t comm = {};
+    bpf_get_current_comm(&comm, sizeof(comm));
+    u32 tid = bpf_get_current_pid_tgid() & 0xffffffff;
+    bpf_map_update_elem(&exec_comm_map, &tid, &comm, BPF_ANY);
+    return 0;
+}
+
+// TP_PROTO(struct task_struct *p, pid_t old_pid, struct linux_binprm *bprm)
+SEC("raw_tracepoint/sched_process_exec")
+int tracepoint__sched__sched_process_exec(struct bpf_raw_tracepoint_args *ctx)
+{
+    program_data_t p = {};
+    if (!init_program_data(&p, ctx))
+        return 0;
+
+    u32 old_pid = (u32) ctx->args[1];
+    thread_name_t old_comm = {};
+    thread_name_t* saved_comm = bpf_map_lookup_elem(&exec_comm_map, &old_pid);
+    if (saved_comm != NULL) {
+        __builtin_memcpy(&old_comm, saved_comm, sizeof(old_comm));
+        bpf_map_delete_elem(&exec_comm_map, &old_pid);
+    }
+
+    if (!should_trace(&p))
+        return 0;
+
+    struct linux_binprm *bprm = (struct linux_binprm *) ctx->args[2];
+    const char *filename = BPF_CORE_READ(bprm, filename);
+
+    // 此时新程序的参数已经放到了用户栈上
+    struct mm_struct *mm = BPF_CORE_READ(p.event->task, mm);
+    u64 arg_start = BPF_CORE_READ(mm, arg_start);
+    u64 arg_end = BPF_CORE_READ(mm, arg_end);
+    u32 arg_size = 0;
+    if (arg_end > arg_start) {
+        arg_size = arg_end - arg_start;
+    }
+    if (arg_size > MAX_EXEC_ARGV_SIZE) {
+        arg_size = MAX_EXEC_ARGV_SIZE;
+    }
+
+    save_to_submit_buf(p.event, (void *) &old_pid, sizeof(u32), 0);
+    save_str_to_buf(p.event, (void *) filename, 1);
+    save_bytes_to_buf(p.event, (void *) &old_comm, sizeof(old_comm), 2);
+    save_bytes_to_buf(p.event, (void *) arg_start, arg_size, 3);
+
+    p.event->context.eventid = SCHED_PROCESS_EXEC;
+    u32 size = sizeof(event_context_t) + p.event->buf_off;
+    asm volatile("if %[size] < %[max_size] goto +1;\n"
+                 "%[size] = %[max_size];\n"
+                 :
+                 : [size] "r"(size), [max_size] "i"(MAX_EVENT_SIZE));
+    bpf_perf_event_output(ctx, &exec_events, BPF_F_CURRENT_CPU, p.event, size);
+    return 0;
+}
+
+// TP_PROTO(struct task_struct *p)
+SEC("raw_tracepoint/sched_process_exit")
+int tracepoint__sched__sched_process_exit(struct bpf_raw_tracepoint_args *ctx)
+{
+    program_data_t p = {};
+    if (!init_program_data(&p, ctx))
+        return 0;
+
+    if (!should_trace(&p))
+        return 0;
+
+    // exit_code 与 wait 得到的 status 格式一致 高 8 位为退出码 低 7 位为信号
+    u32 exit_code = (u32) BPF_CORE_READ(p.event->task, exit_code);
+    // 线程组内最后一个退出的线程 即进程退出
+    u32 group_dead = BPF_CORE_READ(p.event->task, signal, live.counter) == 0;
+
+    save_to_submit_buf(p.event, (void *) &exit_code, sizeof(u32), 0);
+    save_to_submit_buf(p.event, (void *) &group_dead, sizeof(u32), 1);
+
+    p.event->context.eventid = SCHED_PROCESS_EXIT;
+    u32 size = sizeof(event_context_t) + p.event->buf_off;
+    asm volatile("if %[size] < %[max_size] goto +1;\n"
+                 "%[size] = %[max_size];\n"
+                 :
+                 : [size] "r"(size), [max_size] "i"(MAX_EVENT_SIZE));
+    bpf_perf_event_output(ctx, &task_exit_events, BPF_F_CURRENT_CPU, p.event, size);
+    return 0;
+}
@@ -39,6 +39,8 @@ BPF_HASH(common_filter, u32, common_filter_t, 1);
 BPF_HASH(common_list, u32, u32, 1024);
 
 BPF_HASH(thread_filter, thread_name_t, u32, 40);
+// 通配符形式的线程名规则无法在这里匹配 由用户态根据线程名变化按 tid 计算结果
+BPF_HASH(thread_name_match, u32, u32, 8192);
 BPF_HASH(arg_filter, u64, arg_filter_t, 40);
 BPF_HASH(str_buf, str_buf_t, u32, 256);
 BPF_ARRAY(str_buf_gen, str_buf_t, 1);
@@ -49,6 +51,8 @@ BPF_HASH(op_list, u32, op_config_t, 256);
 BPF_HASH(uprobe_point_args, u32, point_args_t, 6);
 BPF_HASH(sysenter_point_args, u32, point_args_t, 512);
 BPF_HASH(sysexit_point_args, u32, point_args_t, 512);
+BPF_HASH(point_counter, u32, point_counter_t, 512);
 BPF_ARRAY(base_config, config_entry_t, 1);
+BPF_ARRAY(caller_ranges, caller_range_t, MAX_CALLER_RANGE_COUNT);
 
 #endif /* __MAPS_H__ */
\ No newline at end of file
@@ -0,0 +1,112 @@
+#include "types.h"
+#include "common/arguments.h"
+#include "common/common.h"
+#include "common/consts.h"
+#include "common/context.h"
+#include "common/filtering.h"
+#include "common/fork.h"
+
+#include "utils.h"
+
+// 崩溃事件单独使用一个 perf map 用户态对它总是采集寄存器和栈数据
+struct {
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} crash_events SEC(".maps");
+
+#define SIGILL  4
+#define SIGTRAP 5
+#define SIGABRT 6
+#define SIGBUS  7
+#define SIGFPE  8
+#define SIGSEGV 11
+
+#define SI_KERNEL 0x80
+
+static __always_inline bool is_fatal_signal(int sig)
+{
+    return sig == SIGSEGV || sig == SIGBUS || sig == SIGABRT || sig == SIGILL || sig == SIGTRAP;
+}
+
+// 只有硬件异常产生的信号 _sigfault 才有意义 其余的信号这里存放的是 _kill 之类的内容
+// si_code 大于 0 表示由内核产生 SI_KERNEL 则不带地址
+static __always_inline bool has_fault_addr(int sig, int si_code)
+{
+    if (si_code <= 0 || si_code == SI_KERNEL)
+        return false;
+    return sig == SIGSEGV || sig == SIGBUS || sig == SIGFPE || sig == SIGILL || sig == SIGTRAP;
+}
+
+static __always_inline int output_signal(void *ctx, int sig, int si_code, struct kernel_siginfo *info, u32 eventid)
+{
+    program_data_t p = {};
+    if (!init_program_data(&p, ctx))
+        return 0;
+
+    if (!should_trace(&p))
+        return 0;
+
+    u64 fault_addr = 0;
+    if (info != NULL) {
+        si_code = BPF_CORE_READ(info, si_code);
+        if (has_fault_addr(sig, si_code)) {
+            fault_addr = (u64) BPF_CORE_READ(info, _sifields._sigfault._addr);
+        }
+    }
+
+    save_to_submit_buf(p.event, (void *) &sig, sizeof(int), 0);
+    save_to_submit_buf(p.event, (void *) &si_code, sizeof(int), 1);
+    save_to_submit_buf(p.event, (void *) &fault_addr, sizeof(u64), 2);
+
+    p.event->context.eventid = eventid;
+    u32 size = sizeof(event_context_t) + p.event->buf_off;
+    asm volatile("if %[size] < %[max_size] goto +1;\n"
+                 "%[size] = %[max_size];\n"
+                 :
+                 : [size] "r"(size), [max_size] "i"(MAX_EVENT_SIZE));
+    bpf_perf_event_output(ctx, &crash_events, BPF_F_CURRENT_CPU, p.event, size);
+    return 0;
+}
+
+// TP_PROTO(int sig, struct kernel_siginfo *info, struct task_struct *task, int group, int result)
+// signal_generate 在发送信号的上下文中触发 只有线程发给自己的信号 比如硬件异常和 abort 此时的现场才是出错时的现场
+// 信号可能被忽略 或者还没投递进程就被杀掉了 所以在产生时就记录 投递时的重复记录在用户态去掉
+SEC("raw_tracepoint/signal_generate")
+int tracepoint__signal__signal_generate(struct bpf_raw_tracepoint_args *ctx)
+{
+    int sig = (int) ctx->args[0];
+    if (!is_fatal_signal(sig))
+        return 0;
+
+    struct task_struct *task = (struct task_struct *) ctx->args[2];
+    if (task != (struct task_struct *) bpf_get_current_task())
+        return 0;
+
+    // 同一个信号已经在等待投递 之前已经记录过了
+    int result = (int) ctx->args[4];
+    if (result == TRACE_SIGNAL_ALREADY_PENDING)
+        return 0;
+
+    // SEND_SIG_NOINFO 和 SEND_SIG_PRIV 不是有效的指针
+    struct kernel_siginfo *info = (struct kernel_siginfo *) ctx->args[1];
+    int si_code = 0;
+    if ((unsigned long) info <= 1) {
+        if ((unsigned long) info == 1)
+            si_code = SI_KERNEL;
+        info = NULL;
+    }
+    return output_signal(ctx, sig, si_code, info, SIGNAL_GENERATE);
+}
+
+// TP_PROTO(int sig, struct kernel_siginfo *info, struct k_sigaction *ka)
+// signal_deliver 在接收信号的线程中触发 此时 current 就是出错的线程
+// 所以 perf 采集到的用户态寄存器和栈就是出错时的现场
+SEC("raw_tracepoint/signal_deliver")
+int tracepoint__signal__signal_deliver(struct bpf_raw_tracepoint_args *ctx)
+{
+    int sig = (int) ctx->args[0];
+    if (!is_fatal_signal(sig))
+        return 0;
+
+    struct kernel_siginfo *info = (struct kernel_siginfo *) ctx->args[1];
+    return output_signal(ctx, sig, 0, info, SIGNAL_DELIVER);
+}
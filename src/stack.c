@@ -4,36 +4,10 @@
 #include "common/consts.h"
 #include "common/context.h"
 #include "common/filtering.h"
+#include "common/fork.h"
 
 #include "utils.h"
 
-SEC("raw_tracepoint/sched_process_fork")
-int tracepoint__sched__sched_process_fork(struct bpf_raw_tracepoint_args *ctx)
-{
-    long ret = 0;
-    program_data_t p = {};
-    if (!init_program_data(&p, ctx))
-        return 0;
-
-    struct task_struct *parent = (struct task_struct *) ctx->args[0];
-    struct task_struct *child = (struct task_struct *) ctx->args[1];
-
-    u32 parent_ns_pid = get_task_ns_pid(parent);
-    u32 parent_ns_tgid = get_task_ns_tgid(parent);
-    u32 child_ns_pid = get_task_ns_pid(child);
-    u32 child_ns_tgid = get_task_ns_tgid(child);
-
-    u32* pid = bpf_map_lookup_elem(&child_parent_map, &parent_ns_pid);
-    if (unlikely(pid == NULL)) return 0;
-
-    if (*pid == parent_ns_pid){
-        ret = bpf_map_update_elem(&child_parent_map, &child_ns_pid, &parent_ns_pid, BPF_ANY);
-    } else {
-        bpf_printk("[stack] parent pid from map:%d\n", *pid);
-    }
-    return 0;
-}
-
 static __always_inline u32 probe_stack_warp(struct pt_regs* ctx, u32 point_key) {
     program_data_t p = {};
     if (!init_program_data(&p, ctx)) {
@@ -49,12 +23,14 @@ static __always_inline u32 probe_stack_warp(struct pt_regs* ctx, u32 point_key)
     common_filter_t* filter = bpf_map_lookup_elem(&common_filter, &filter_key);
     if (unlikely(filter == NULL)) return 0;
 
-    ctx_regs_t saved_regs = {};
-    for (int i = 0; i < 31; i++) {
-        saved_regs.regs[i] = READ_KERN(ctx->regs[i]);
+    // 按调用来源库过滤 返回处的 hook 点不设置 caller_mask 会因取不到寄存器而跳过
+    if (point_args->caller_mask != 0) {
+        u64 caller_lr = read_lr(ctx, filter->is_32bit);
+        if (!match_caller(point_args->caller_mask, caller_lr)) return 0;
     }
-    saved_regs.sp = READ_KERN(ctx->sp);
-    saved_regs.pc = READ_KERN(ctx->pc);
+
+    ctx_regs_t saved_regs = {};
+    read_ctx_regs(ctx, &saved_regs, false);
 
     if (point_args->enter_key == 0) {
         /* pass */
@@ -71,22 +47,11 @@ static __always_inline u32 probe_stack_warp(struct pt_regs* ctx, u32 point_key)
     }
 
     save_to_submit_buf(p.event, (void *) &point_key, sizeof(u32), 0);
-    u64 lr = 0;
-    u64 sp = 0;
-    if(filter->is_32bit) {
-        bpf_probe_read_kernel(&lr, sizeof(lr), &ctx->regs[14]);
-        save_to_submit_buf(p.event, (void *) &lr, sizeof(u64), 1);
-        bpf_probe_read_kernel(&sp, sizeof(sp), &ctx->regs[13]);
-        save_to_submit_buf(p.event, (void *) &sp, sizeof(u64), 2);
-    }
-    else {
-        bpf_probe_read_kernel(&lr, sizeof(lr), &ctx->regs[30]);
-        save_to_submit_buf(p.event, (void *) &lr, sizeof(u64), 1);
-        bpf_probe_read_kernel(&sp, sizeof(sp), &ctx->sp);
-        save_to_submit_buf(p.event, (void *) &sp, sizeof(u64), 2);
-    }
-    u64 pc = 0;
-    bpf_probe_read_kernel(&pc, sizeof(pc), &ctx->pc);
+    u64 lr = read_lr(ctx, filter->is_32bit);
+    save_to_submit_buf(p.event, (void *) &lr, sizeof(u64), 1);
+    u64 sp = read_sp(ctx, filter->is_32bit);
+    save_to_submit_buf(p.event, (void *) &sp, sizeof(u64), 2);
+    u64 pc = read_pc(ctx);
     save_to_submit_buf(p.event, (void *) &pc, sizeof(u64), 3);
 
     int ctx_index = 0;
@@ -95,6 +60,12 @@ static __always_inline u32 probe_stack_warp(struct pt_regs* ctx, u32 point_key)
     __builtin_memset((void *)op_ctx, 0, sizeof(op_ctx));
 
     op_ctx->reg_0 = saved_regs.regs[0];
+    // 返回处的 hook 点 当前的第一个寄存器即返回值
+    // 包括由进入处派生的返回点 以及直接 hook 在返回处的独立 hook 点
+    op_ctx->ret_value = 0;
+    if (point_args->enter_key != point_key + 1) {
+        op_ctx->ret_value = read_signed_retval(ctx, filter->is_32bit);
+    }
     op_ctx->save_index = 4;
     op_ctx->op_key_index = 0;
 
@@ -105,6 +76,14 @@ static __always_inline u32 probe_stack_warp(struct pt_regs* ctx, u32 point_key)
         return 0;
     }
 
+    if (!check_point_limit(point_args, point_key)) {
+        // 返回处的 hook 点也不再输出
+        if (point_args->enter_key == point_key + 1) {
+            del_regs(UPROBE_ENTER + point_key + 1);
+        }
+        return 0;
+    }
+
     events_perf_submit(&p, UPROBE_ENTER);
     if (filter->signal > 0) {
         bpf_send_signal(filter->signal);
@@ -10,8 +10,17 @@ typedef struct common_filter {
     u32 trace_uid_group;
     u32 signal;
     u32 tsignal;
+    u32 trace_user;
 } common_filter_t;
 
+// 调用来源库的地址范围 mask 对应 hook 点上的 caller_mask
+typedef struct caller_range {
+    u64 start;
+    u64 end;
+    u32 mask;
+    u32 pad;
+} caller_range_t;
+
 typedef struct ctx_regs {
     u64 regs[31];
     u64 sp;
@@ -65,7 +74,12 @@ enum event_id_e
 {
     SYSCALL_ENTER = 456,
     SYSCALL_EXIT,
-    UPROBE_ENTER
+    UPROBE_ENTER,
+    // 459 是 HW_BREAKPOINT 仅在用户态使用
+    SIGNAL_DELIVER = 460,
+    SCHED_PROCESS_EXEC,
+    SCHED_PROCESS_EXIT,
+    SIGNAL_GENERATE
 };
 
 enum op_code_e
@@ -100,7 +114,18 @@ enum op_code_e
     OP_FILTER_STRING,
     OP_SAVE_STRING,
     OP_SAVE_PTR_STRING,
-    OP_READ_STD_STRING
+    OP_READ_STD_STRING,
+    OP_JUMP_ADDR_ZERO,
+    OP_JUMP_BREAK_COUNT_ZERO,
+    OP_SET_READ_LEN_RET_VALUE,
+    OP_SAVE_READ_LEN,
+    OP_SAVE_STRUCT_CHUNK,
+    OP_SAVE_STRING_CHUNK,
+    OP_READ_ART_STRING,
+    OP_LIMIT_BREAK_COUNT,
+    OP_SAVE_STR_LEN,
+    OP_MASK_POINTER_VALUE,
+    OP_SAVE_STRUCT_PAGE_CHUNK
 };
 
 enum arm64_reg_e
@@ -218,6 +243,8 @@ typedef struct op_ctx {
     // 函数执行后会覆盖第一个寄存器
     // 在函数退出时有可能还要用到
     u64 reg_0;
+    // 函数或者系统调用的返回值 仅在返回处有效 32 位进程已做符号扩展
+    u64 ret_value;
 } op_ctx_t;
 
 typedef struct op_config {
@@ -230,10 +257,24 @@ typedef struct op_config {
 typedef struct point_args {
     u32 enter_key;
     u32 signal;
+    u32 caller_mask;
+    u32 max_hits;
+    u32 skip_first;
+    u32 every_nth;
+    u32 max_per_second;
     u32 op_count;
     u32 op_key_list[MAX_OP_COUNT];
 } point_args_t;
 
+// 单个 hook 点的计数 用于限制输出频率 退出时由用户态读取
+typedef struct point_counter {
+    u64 hits;
+    u64 output;
+    u64 dropped;
+    u64 window_start;
+    u64 window_count;
+} point_counter_t;
+
 typedef struct event_context {
     u64 ts;
     u32 eventid;
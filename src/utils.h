@@ -74,6 +74,14 @@ static __noinline u32 read_args(program_data_t* p, point_args_t* point_args, op_
                     op_ctx->read_len = op_ctx->pointer_value;
                 }
                 break;
+            case OP_SET_READ_LEN_RET_VALUE:
+                // 返回值为负数即调用失败 不读取
+                if ((s64)op_ctx->ret_value < 0) {
+                    op_ctx->read_len = 0;
+                } else if (op_ctx->read_len > op_ctx->ret_value) {
+                    op_ctx->read_len = op_ctx->ret_value;
+                }
+                break;
             case OP_SET_READ_COUNT:
                 op_ctx->read_len *= op->value;
                 break;
@@ -155,6 +163,8 @@ static __noinline u32 read_args(program_data_t* p, point_args_t* point_args, op_
                 op_ctx->save_index += 1;
                 break;
             case OP_READ_POINTER:
+                // 32 位进程只读 4 字节 高位需要先清零
+                op_ctx->pointer_value = 0;
                 if (op->pre_code == OP_ADD_OFFSET) {
                     bpf_probe_read_user(&op_ctx->pointer_value, PTR_SIZE, (void*)(op_ctx->read_addr + op->value));
                 } else if (op->pre_code == OP_SUB_OFFSET) {
@@ -250,8 +260,9 @@ static __noinline u32 read_args(program_data_t* p, point_args_t* point_args, op_
                 break;
             case OP_SAVE_PTR_STRING:
             {
-                u64 ptr = op_ctx->read_addr & 0xffffffffffff;
-                bpf_probe_read_user(&ptr, PTR_SIZE, (void*) ptr);
+                u64 addr = op_ctx->read_addr & 0xffffffffffff;
+                u64 ptr = 0;
+                bpf_probe_read_user(&ptr, PTR_SIZE, (void*) addr);
                 save_to_submit_buf(p->event, (void *)&ptr, sizeof(ptr), op_ctx->save_index);
                 op_ctx->save_index += 1;
                 // 每次取出后使用前都要 fix 很坑
@@ -277,12 +288,142 @@ static __noinline u32 read_args(program_data_t* p, point_args_t* point_args, op_
                 if ((value & 1) == 0) {
                     ptr += 1;
                 } else {
-                    ptr += PTR_SIZE * 2;
-                    bpf_probe_read_user(&ptr, sizeof(ptr), (void*) ptr);
+                    // libc++ 长字符串 {cap, size, data} 各占一个指针大小
+                    u64 data_addr = ptr + PTR_SIZE * 2;
+                    ptr = 0;
+                    bpf_probe_read_user(&ptr, PTR_SIZE, (void*) data_addr);
                 }
                 op_ctx->read_addr = ptr;
                 break;
             }
+            case OP_SAVE_READ_LEN: {
+                // 分段读取之前保存要读取的真实长度 用于判断是否截断
+                u64 read_len = op_ctx->read_len;
+                save_to_submit_buf(p->event, (void *)&read_len, sizeof(read_len), op_ctx->save_index);
+                op_ctx->save_index += 1;
+                break;
+            }
+            case OP_SAVE_STRUCT_CHUNK:
+            case OP_SAVE_STRUCT_PAGE_CHUNK: {
+                // 分段读取 本段最多 op->value 字节 读取后 read_addr read_len 指向剩余的部分
+                // 读取失败或者没有剩余时通过 save_empty_to_buf 占位 解析时缺少的段按截断处理
+                // PAGE_CHUNK 的本段不跨越内存页 后面的页不可读时 前面的部分仍然可以读到
+                op_ctx->read_addr = op_ctx->read_addr & 0xffffffffffff;
+                u32 chunk_len = op_ctx->read_len;
+                if (chunk_len > op->value) {
+                    chunk_len = op->value;
+                }
+                if (op_ctx->op_code == OP_SAVE_STRUCT_PAGE_CHUNK) {
+                    u32 page_left = READ_PAGE_SIZE - (op_ctx->read_addr & (READ_PAGE_SIZE - 1));
+                    if (chunk_len > page_left) {
+                        chunk_len = page_left;
+                    }
+                }
+                if (chunk_len > MAX_BYTES_ARR_SIZE) {
+                    chunk_len = MAX_BYTES_ARR_SIZE;
+                }
+                if (chunk_len == 0 || save_bytes_to_buf(p->event, (void *)(op_ctx->read_addr), chunk_len, op_ctx->save_index) == 0) {
+                    save_empty_to_buf(p->event, op_ctx->save_index);
+                    op_ctx->read_len = 0;
+                } else {
+                    op_ctx->read_addr += chunk_len;
+                    op_ctx->read_len -= chunk_len;
+                }
+                op_ctx->save_index += 1;
+                break;
+            }
+            case OP_SAVE_STRING_CHUNK: {
+                // 分段读取字符串 本段最多 op->value 字节 包含结尾的 \x00
+                // read_len 非 0 表示上一段没有遇到结尾 需要接着读取 第一段通过 pre_code 标记
+                op_ctx->read_addr = op_ctx->read_addr & 0xffffffffffff;
+                if (op->pre_code == OP_SET_READ_LEN) {
+                    op_ctx->read_len = 1;
+                    op_ctx->str_len = 0;
+                }
+                int sz = -1;
+                if (op_ctx->read_len != 0) {
+                    sz = save_str_len_to_buf(p->event, (void*) op_ctx->read_addr, op->value, op_ctx->save_index);
+                }
+                if (sz < 0) {
+                    save_empty_to_buf(p->event, op_ctx->save_index);
+                    op_ctx->read_len = 0;
+                } else if (sz == op->value && sz > 1) {
+                    // 段内没有遇到结尾 最后一个字节被替换为了 \x00
+                    op_ctx->read_addr += sz - 1;
+                    op_ctx->str_len += sz - 1;
+                } else {
+                    op_ctx->str_len += sz;
+                    op_ctx->read_len = 0;
+                }
+                op_ctx->save_index += 1;
+                break;
+            }
+            case OP_SAVE_STR_LEN: {
+                // 搭配 OP_SAVE_STRING_CHUNK 使用 保存字符串的长度 遇到结尾时包含 \x00
+                // 读满了仍未遇到结尾 则接着计算剩余部分的长度 仍然没有结尾时通过高位标记
+                u64 str_len = op_ctx->str_len;
+                if (op_ctx->read_len != 0) {
+                    int sz = probe_str_len(p->event, (void*) op_ctx->read_addr);
+                    if (sz <= 0 || sz == MAX_STRING_SIZE) {
+                        // 只记录已经确认的长度
+                        if (sz > 0) {
+                            str_len += sz - 1;
+                        }
+                        str_len |= STR_LEN_UNTERMINATED;
+                    } else {
+                        str_len += sz;
+                    }
+                    op_ctx->read_len = 0;
+                }
+                save_to_submit_buf(p->event, (void *)&str_len, sizeof(str_len), op_ctx->save_index);
+                op_ctx->save_index += 1;
+                break;
+            }
+            case OP_READ_ART_STRING:
+            {
+                // 搭配 OP_SAVE_STRUCT 使用 read_addr 为 mirror::String 的 count 字段地址
+                // count 最低位为 0 表示压缩存储 即每个字符一个字节 否则为 UTF-16
+                u32 count = 0;
+                bpf_probe_read_user(&count, sizeof(count), (void*)(op_ctx->read_addr & 0xffffffffffff));
+                u32 str_size = count >> 1;
+                if ((count & 1) != 0) {
+                    str_size = str_size * 2;
+                }
+                if (op_ctx->read_len > str_size) {
+                    op_ctx->read_len = str_size;
+                }
+                op_ctx->read_addr += op->value;
+                break;
+            }
+            case OP_JUMP_ADDR_ZERO:
+                // 链表遍历到空指针 或者数组首地址为空 跳过后面 value 个操作 同时结束循环
+                if ((op_ctx->read_addr & 0xffffffffffff) == 0) {
+                    op_ctx->loop_count = 0;
+                    op_ctx->break_count = 0;
+                    op_ctx->loop_index = 0;
+                    op_ctx->op_key_index += op->value;
+                }
+                break;
+            case OP_MASK_POINTER_VALUE:
+                // 按指针宽度读取的值 只保留字段本身的宽度
+                if (op->value < 8) {
+                    op_ctx->pointer_value &= ((u64)1 << (op->value * 8)) - 1;
+                }
+                break;
+            case OP_LIMIT_BREAK_COUNT:
+                // 限制循环次数 避免超出操作数上限
+                if (op_ctx->break_count > op->value) {
+                    op_ctx->break_count = op->value;
+                }
+                break;
+            case OP_JUMP_BREAK_COUNT_ZERO:
+                // 元素个数为 0 时 FOR_BREAK 仍然会执行一次循环体 所以需要提前跳过
+                if (op_ctx->break_count == 0) {
+                    op_ctx->loop_count = 0;
+                    op_ctx->loop_index = 0;
+                    op_ctx->op_key_index += op->value;
+                }
+                break;
             default:
                 break;
         }
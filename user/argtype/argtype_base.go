@@ -273,189 +273,182 @@ func (this *ARG_INT8) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool)
 }
 func (this *ARG_INT8) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := int8(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_INT16) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_INT16) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := int16(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_INT32) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_INT32) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := int32(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_INT64) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_INT64) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := int64(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_UINT8) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_UINT8) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := uint8(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_UINT16) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_UINT16) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := uint16(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_UINT32) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
 }
 func (this *ARG_UINT32) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
 	value_fix := uint32(ptr)
-	value_fmt := fmt.Sprintf("%d", value_fix)
+	flags_fmt := ""
 	if this.FlagsConfig != nil {
-		flags_fmt := this.FlagsConfig.Parse(int32(value_fix))
-		switch this.FormatType {
-		case FORMAT_NUM:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_HEX_PURE:
-			return fmt.Sprintf("%x%s", value_fix, flags_fmt)
-		case FORMAT_HEX:
-			return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
-		case FORMAT_DEC:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		case FORMAT_OCT:
-			return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
-		case FORMAT_BIN:
-			return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
-		default:
-			return fmt.Sprintf("%d%s", value_fix, flags_fmt)
-		}
+		flags_fmt = this.FlagsConfig.Parse(int32(value_fix))
+	}
+	switch this.FormatType {
+	case FORMAT_NUM:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_HEX_PURE:
+		return fmt.Sprintf("%x%s", value_fix, flags_fmt)
+	case FORMAT_HEX:
+		return fmt.Sprintf("0x%x%s", value_fix, flags_fmt)
+	case FORMAT_DEC:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
+	case FORMAT_OCT:
+		return fmt.Sprintf("0o%03s%s", strconv.FormatInt(int64(value_fix), 8), flags_fmt)
+	case FORMAT_BIN:
+		return fmt.Sprintf("0b%s%s", strconv.FormatInt(int64(value_fix), 2), flags_fmt)
+	default:
+		return fmt.Sprintf("%d%s", value_fix, flags_fmt)
 	}
-	return value_fmt
 }
 func (this *ARG_UINT64) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
 	return this.Parse(ptr, buf, parse_more)
@@ -738,6 +731,10 @@ func init() {
 
 	Register(&ARG_STRUCT{}, "struct", TYPE_STRUCT, STRUCT, 0)
 	Register(&ARG_ARRAY{}, "array", TYPE_ARRAY, ARRAY, 0)
+	Register(&ARG_CUSTOM{}, "custom_struct", TYPE_CUSTOM, CUSTOM_STRUCT, 0)
+	Register(&ARG_TRAVERSE{}, "traverse_struct", TYPE_TRAVERSE, TRAVERSE_STRUCT, 0)
+	Register(&ARG_CHUNK{}, "chunk_data", TYPE_CHUNK, CHUNK_DATA, 0)
+	Register(&ARG_UTF16{}, "utf16_data", TYPE_UTF16, UTF16_DATA, 0)
 
 	PreRegister()
 
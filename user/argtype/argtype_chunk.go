@@ -0,0 +1,262 @@
+package argtype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "stackplz/user/common"
+	"stackplz/user/util"
+)
+
+// 通过 max_len 指定读取上限的字符串和数据 超过单次读取上限时分为多段读取 解析时重新拼接
+// 数据   [要读取的真实长度] SET_TMP_VALUE [chunk]... MOVE_TMP_VALUE
+// 字符串 SET_TMP_VALUE [chunk]... [字符串长度] MOVE_TMP_VALUE
+// 字符串长度在读满 max_len 后会接着计算剩余部分 超出 max_len 说明被截断了
+// 最后恢复读取地址 这样后面的过滤规则仍然从起始处比较
+// 事件的缓冲区满了之后 后面的段可能连空的 buf 都保存不了 解析时缺少的段按截断处理
+
+type ARG_CHUNK struct {
+	ArgType
+	MaxLen     uint32
+	ChunkCount uint32
+	IsString   bool
+}
+
+func (this *ARG_CHUNK) Clone() IArgType {
+	p, ok := (this.ArgType.Clone()).(*ArgType)
+	if !ok {
+		panic("...")
+	}
+	return &ARG_CHUNK{*p, this.MaxLen, this.ChunkCount, this.IsString}
+}
+
+func (this *ARG_CHUNK) readChunk(buf *bytes.Buffer) ([]byte, bool) {
+	if buf.Len() == 0 {
+		return nil, false
+	}
+	var arg Arg_str
+	if err := binary.Read(buf, binary.LittleEndian, &arg); err != nil {
+		panic(err)
+	}
+	payload := make([]byte, arg.Len)
+	if err := binary.Read(buf, binary.LittleEndian, &payload); err != nil {
+		panic(err)
+	}
+	return payload, true
+}
+
+func (this *ARG_CHUNK) readLen(buf *bytes.Buffer) (uint64, bool) {
+	if buf.Len() == 0 {
+		return 0, false
+	}
+	var arg Arg_reg
+	if err := binary.Read(buf, binary.LittleEndian, &arg); err != nil {
+		panic(err)
+	}
+	return arg.Address, true
+}
+
+func (this *ARG_CHUNK) parseData(buf *bytes.Buffer) ([]byte, string, bool) {
+	// 返回拼接后的内容 真实长度 是否被截断
+	if this.IsString {
+		var data []byte
+		complete := true
+		for i := uint32(0); i < this.ChunkCount; i++ {
+			payload, ok := this.readChunk(buf)
+			if !ok {
+				complete = false
+				break
+			}
+			// 每一段都以 \x00 结尾
+			if len(payload) > 0 && payload[len(payload)-1] == 0 {
+				payload = payload[:len(payload)-1]
+			}
+			data = append(data, payload...)
+		}
+		raw_len, ok := this.readLen(buf)
+		if !complete || !ok {
+			return data, fmt.Sprintf(">%d", len(data)), true
+		}
+		str_len := raw_len & (STR_LEN_UNTERMINATED - 1)
+		if raw_len&STR_LEN_UNTERMINATED != 0 {
+			// 剩余部分也没有遇到结尾 只知道超出了这个长度
+			return data, fmt.Sprintf(">%d", str_len), true
+		}
+		if str_len > uint64(len(data)) {
+			// 长度包含了结尾的 \x00
+			str_len -= 1
+		}
+		return data, fmt.Sprintf("%d", str_len), str_len > uint64(len(data))
+	}
+	real_len, ok := this.readLen(buf)
+	if !ok {
+		return nil, "?", true
+	}
+	var data []byte
+	for i := uint32(0); i < this.ChunkCount; i++ {
+		payload, ok := this.readChunk(buf)
+		if !ok {
+			return data, fmt.Sprintf("%d", real_len), true
+		}
+		data = append(data, payload...)
+	}
+	return data, fmt.Sprintf("%d", real_len), uint64(len(data)) < real_len
+}
+
+func (this *ARG_CHUNK) GetMaxDataSize() uint32 {
+	// 最坏的情况下在事件缓冲区中占用的大小 每段 [index][len] 另外是 [index][u64] 的长度
+	size := this.ChunkCount*5 + 9
+	if this.IsString {
+		// 每段都以 \x00 结尾
+		size += this.ChunkCount
+	}
+	return this.MaxLen + size
+}
+
+func (this *ARG_CHUNK) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
+	if !parse_more {
+		return fmt.Sprintf("0x%x", ptr)
+	}
+	data, real_len, truncated := this.parseData(buf)
+	var content string
+	if this.IsString {
+		content = fmt.Sprintf("(%s)", util.B2STrim(data))
+	} else if this.DumpHex && len(data) > 0 {
+		if this.Color {
+			content = fmt.Sprintf("(\n%s)", util.HexDumpGreen(data))
+		} else {
+			content = fmt.Sprintf("(\n%s)", util.HexDumpPure(data))
+		}
+	} else {
+		content = fmt.Sprintf("(%s)", util.PrettyByteSlice(data))
+	}
+	if truncated {
+		content += fmt.Sprintf("<truncated %d/%s>", len(data), real_len)
+	}
+	return fmt.Sprintf("0x%x%s", ptr, content)
+}
+
+func (this *ARG_CHUNK) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
+	if !parse_more {
+		return &struct {
+			Ptr string `json:"ptr"`
+		}{
+			Ptr: fmt.Sprintf("0x%x", ptr),
+		}
+	}
+	data, real_len, truncated := this.parseData(buf)
+	type ChunkValue struct {
+		Value       string `json:"value,omitempty"`
+		Buffer      string `json:"buffer,omitempty"`
+		CapturedLen string `json:"captured_len"`
+		RealLen     string `json:"real_len"`
+		Truncated   bool   `json:"truncated"`
+	}
+	value := &ChunkValue{}
+	if this.IsString {
+		value.Value = util.B2STrim(data)
+	} else {
+		value.Buffer = util.PrettyByteSlice(data)
+	}
+	value.CapturedLen = fmt.Sprintf("%d", len(data))
+	value.RealLen = real_len
+	value.Truncated = truncated
+	return &struct {
+		Ptr      string      `json:"ptr"`
+		PtrValue *ChunkValue `json:"ptr_value"`
+	}{
+		Ptr:      fmt.Sprintf("0x%x", ptr),
+		PtrValue: value,
+	}
+}
+
+func checkChunkMaxLen(max_len uint32) {
+	if max_len == 0 || max_len > MAX_CHUNK_READ_SIZE {
+		panic(fmt.Sprintf("max_len should be in 1~%d, provided:%d", MAX_CHUNK_READ_SIZE, max_len))
+	}
+}
+
+func newChunk(name string, max_len uint32, is_string bool) *ARG_CHUNK {
+	checkChunkMaxLen(max_len)
+	at, ok := (RegisterNew(name, CHUNK_DATA)).(*ARG_CHUNK)
+	if !ok {
+		panic("...")
+	}
+	at.MaxLen = max_len
+	at.IsString = is_string
+	return at
+}
+
+func (this *ARG_CHUNK) addBufferChunks() {
+	// 调用前 read_len 即为要读取的真实长度
+	this.AddOp(OPC_SAVE_READ_LEN)
+	this.AddOp(OPC_SET_TMP_VALUE)
+	for left := this.MaxLen; left > 0; {
+		chunk_len := left
+		if chunk_len > MAX_BUF_READ_SIZE {
+			chunk_len = MAX_BUF_READ_SIZE
+		}
+		this.AddOp(OPC_SAVE_STRUCT_CHUNK.NewValue(uint64(chunk_len)))
+		this.ChunkCount += 1
+		left -= chunk_len
+	}
+	this.AddOp(OPC_MOVE_TMP_VALUE)
+}
+
+func (this *ARG_CHUNK) addStringChunks() {
+	this.AddOp(OPC_SET_TMP_VALUE)
+	for left := this.MaxLen; left > 0; {
+		// 每段的最后一个字节留给 \x00
+		chunk_len := left
+		if chunk_len > MAX_BUF_READ_SIZE-1 {
+			chunk_len = MAX_BUF_READ_SIZE - 1
+		}
+		if this.ChunkCount == 0 {
+			// 第一段通过 pre_code 标记 需要重置状态
+			this.AddOp(OPC_SAVE_STRING_CHUNK.NewPreCode(OP_SET_READ_LEN).NewValue(uint64(chunk_len + 1)))
+		} else {
+			this.AddOp(OPC_SAVE_STRING_CHUNK.NewValue(uint64(chunk_len + 1)))
+		}
+		this.ChunkCount += 1
+		left -= chunk_len
+	}
+	this.AddOp(OPC_SAVE_STR_LEN)
+	this.AddOp(OPC_MOVE_TMP_VALUE)
+}
+
+func R_STRING_MAX(max_len uint32) IArgType {
+	at := newChunk(fmt.Sprintf("string_max_%d", max_len), max_len, true)
+	at.addStringChunks()
+	return at
+}
+
+func R_STD_STRING_MAX(max_len uint32) IArgType {
+	at := newChunk(fmt.Sprintf("std_max_%d", max_len), max_len, true)
+	at.AddOp(OPC_READ_STD_STRING)
+	at.addStringChunks()
+	return at
+}
+
+func R_BUFFER_LEN_MAX(length, max_len uint32) IArgType {
+	at := newChunk(fmt.Sprintf("buffer_len_%d_max_%d", length, max_len), max_len, false)
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(length)))
+	at.addBufferChunks()
+	return at
+}
+
+func R_BUFFER_REG_MAX(reg_index, max_len uint32) IArgType {
+	at := newChunk(fmt.Sprintf("buffer_reg_%d_max_%d", reg_index, max_len), max_len, false)
+	// 先不做限制 这样才能拿到真实长度
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(^uint32(0))))
+	at.AddOp(BuildReadRegLen(uint64(reg_index)))
+	at.addBufferChunks()
+	return at
+}
+
+func R_BUFFER_RET_MAX(max_len uint32) IArgType {
+	at := newChunk(fmt.Sprintf("buffer_ret_max_%d", max_len), max_len, false)
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(^uint32(0))))
+	at.AddOp(OPC_SET_READ_LEN_RET_VALUE)
+	at.addBufferChunks()
+	return at
+}
@@ -115,7 +115,7 @@ func r_STRING_ARRAY() IArgType {
 	at.AddOp(OPC_SET_BREAK_COUNT.NewValue(uint64(MAX_LOOP_COUNT)))
 	at.AddOp(OPC_FOR_BREAK)
 	at.AddOp(OPC_SAVE_PTR_STRING)
-	at.AddOp(OPC_ADD_OFFSET.NewValue(uint64(unsafe.Sizeof(8))))
+	at.AddOp(OPC_ADD_OFFSET.NewValue(uint64(PTR_SIZE)))
 	at.AddOp(OPC_FOR_BREAK)
 	at.SetParseCB(parse_STRING_ARRAY)
 	return at
@@ -415,6 +415,16 @@ func R_BUFFER_REG(reg_index uint32) IArgType {
 	return at
 }
 
+func R_BUFFER_RET() IArgType {
+	// 以返回值作为读取大小 仅在 sys_exit 或者返回处的 hook 点有效
+	at := RegisterNew("buffer_ret", BUFFER)
+	at.CleanOpList()
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(MAX_BUF_READ_SIZE)))
+	at.AddOp(OPC_SET_READ_LEN_RET_VALUE)
+	at.AddOp(OPC_SAVE_STRUCT)
+	return at
+}
+
 func R_BUFFER_LEN(length uint32) IArgType {
 	if length > MAX_BUF_READ_SIZE {
 		panic(fmt.Sprintf("max buf read size:%d, provided:%d", MAX_BUF_READ_SIZE, length))
@@ -0,0 +1,474 @@
+package argtype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	. "stackplz/user/common"
+	"stackplz/user/util"
+	"strings"
+)
+
+// 配置文件 types 中声明的结构体
+// 读取时先保存结构体本身 然后按字段顺序追加 字符串/指针/变长数组 的读取
+// 解析时按照同样的顺序消费数据 所以 buildFieldOps 和 parseFields 的遍历逻辑必须保持一致
+
+const (
+	FIELD_NUM uint32 = iota
+	FIELD_CHAR
+	FIELD_BUF
+	FIELD_STRING
+	FIELD_STD
+	FIELD_STRUCT
+)
+
+// 通过指针展开结构体的最大层数 避免链表这类自引用的结构无限展开
+var CustomMaxDepth uint32 = 2
+
+type CustomField struct {
+	Name   string
+	Kind   uint32
+	Offset uint32
+	// 单个元素的大小
+	ElemSize uint32
+	// 固定的元素个数 0 表示不是数组
+	Count uint32
+	// 元素个数由同一结构体中的其他字段指示
+	CountField string
+	IsPtr      bool
+	// FIELD_NUM 对应的数字类型 已经应用了 format
+	NumType IArgType
+	Struct  *ARG_CUSTOM
+}
+
+func (this *CustomField) GetElemSize() uint32 {
+	// 结构体类型可能在字段之后才完成布局 所以这里实时获取
+	if this.Kind == FIELD_STRUCT {
+		return this.Struct.Size
+	}
+	return this.ElemSize
+}
+
+func (this *CustomField) IsArray() bool {
+	return this.Count > 0 || this.CountField != ""
+}
+
+func (this *CustomField) GetSize() uint32 {
+	// 字段在结构体中实际占用的大小
+	if this.IsPtr || this.Kind == FIELD_STRING {
+		return PTR_SIZE
+	}
+	if this.CountField != "" {
+		// 结构体末尾的变长数组 不计入结构体大小
+		return 0
+	}
+	if this.Count > 0 {
+		return this.GetElemSize() * this.Count
+	}
+	return this.GetElemSize()
+}
+
+func (this *CustomField) GetAlign() uint32 {
+	if this.IsPtr || this.Kind == FIELD_STRING || this.Kind == FIELD_STD {
+		return PTR_SIZE
+	}
+	if this.Kind == FIELD_STRUCT {
+		return this.Struct.Align
+	}
+	if this.GetElemSize() > 8 || this.GetElemSize() == 0 {
+		return 8
+	}
+	return this.GetElemSize()
+}
+
+type ARG_CUSTOM struct {
+	ARG_STRUCT
+	Fields []*CustomField
+	Align  uint32
+}
+
+func (this *ARG_CUSTOM) Clone() IArgType {
+	p, ok := (this.ARG_STRUCT.Clone()).(*ARG_STRUCT)
+	if !ok {
+		panic("...")
+	}
+	at := &ARG_CUSTOM{*p, nil, this.Align}
+	at.Fields = append(at.Fields, this.Fields...)
+	return at
+}
+
+func (this *ARG_CUSTOM) GetField(name string) *CustomField {
+	for _, field := range this.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func (this *ARG_CUSTOM) GetEnd() uint32 {
+	// 当前已有字段的结束位置
+	var end uint32 = 0
+	for _, field := range this.Fields {
+		if field.Offset+field.GetSize() > end {
+			end = field.Offset + field.GetSize()
+		}
+	}
+	return end
+}
+
+func (this *ARG_CUSTOM) AddField(field *CustomField) {
+	if this.GetField(field.Name) != nil {
+		panic(fmt.Sprintf("duplicate field %s in type %s", field.Name, this.Name))
+	}
+	if field.GetAlign() > this.Align {
+		this.Align = field.GetAlign()
+	}
+	this.Fields = append(this.Fields, field)
+}
+
+func (this *ARG_CUSTOM) moveToBase(path []uint64) {
+	// 从保存的首地址出发 依次取指针 得到当前结构体的地址
+	this.AddOp(OPC_MOVE_TMP_VALUE)
+	for _, offset := range path {
+		this.AddOp(BuildReadPtrAddr(offset))
+	}
+}
+
+func (this *ARG_CUSTOM) BuildOps() {
+	this.CleanOpList()
+	this.AddOp(SaveStruct(uint64(this.Size)))
+	// 保存结构体首地址 后续字段都基于它计算 注意要在 SAVE_STRUCT 修正地址之后
+	this.AddOp(OPC_SET_TMP_VALUE)
+	this.buildFieldOps(this, []uint64{}, 0, 0)
+}
+
+func (this *ARG_CUSTOM) buildFieldOps(root *ARG_CUSTOM, path []uint64, base uint64, depth uint32) {
+	for _, field := range this.Fields {
+		offset := base + uint64(field.Offset)
+		switch {
+		case field.Kind == FIELD_STRING:
+			root.moveToBase(path)
+			root.AddOp(BuildReadPtrAddr(offset))
+			root.AddOp(OPC_SAVE_STRING)
+		case field.Kind == FIELD_STD:
+			root.moveToBase(path)
+			root.AddOp(OPC_ADD_OFFSET.NewValue(offset))
+			root.AddOp(OPC_READ_STD_STRING)
+			root.AddOp(OPC_SAVE_STRING)
+		case field.Kind == FIELD_STRUCT && field.IsPtr && !field.IsArray():
+			if depth+1 > CustomMaxDepth {
+				break
+			}
+			child_path := append(path[:len(path):len(path)], offset)
+			root.moveToBase(child_path)
+			root.AddOp(SaveStruct(uint64(field.Struct.Size)))
+			field.Struct.buildFieldOps(root, child_path, 0, depth+1)
+		case field.IsPtr || field.CountField != "":
+			root.moveToBase(path)
+			if field.CountField != "" {
+				// 先设定上限 再取计数字段的值作为元素个数 最后乘以元素大小
+				count_field := this.GetField(field.CountField)
+				root.AddOp(OPC_SET_READ_LEN.NewValue(uint64(MAX_BUF_READ_SIZE / field.GetElemSize())))
+				// 读取按指针宽度进行 计数字段更窄时需要去掉相邻字段的内容
+				if count_field.ElemSize < PTR_SIZE {
+					root.AddOp(BuildReadPtr(base + uint64(count_field.Offset)))
+					root.AddOp(BuildMaskPtrLen(uint64(count_field.ElemSize)))
+				} else {
+					root.AddOp(BuildReadPtrLen(base + uint64(count_field.Offset)))
+				}
+				root.AddOp(OPC_SET_READ_COUNT.NewValue(uint64(field.GetElemSize())))
+			} else if field.Count > 0 {
+				root.AddOp(OPC_SET_READ_LEN.NewValue(uint64(field.GetElemSize() * field.Count)))
+			} else {
+				root.AddOp(OPC_SET_READ_LEN.NewValue(uint64(field.GetElemSize())))
+			}
+			if field.IsPtr {
+				root.AddOp(BuildReadPtrAddr(offset))
+			} else {
+				root.AddOp(OPC_ADD_OFFSET.NewValue(offset))
+			}
+			root.AddOp(OPC_SAVE_STRUCT)
+		case field.Kind == FIELD_STRUCT && field.Count == 0:
+			// 内嵌的结构体 地址在当前结构体内 直接累加偏移
+			field.Struct.buildFieldOps(root, path, offset, depth)
+		}
+	}
+}
+
+// 按声明顺序输出的字段集合
+type CustomStructValue struct {
+	Names  []string
+	Texts  []string
+	Values []any
+}
+
+func (this *CustomStructValue) Add(name, text string, value any) {
+	this.Names = append(this.Names, name)
+	this.Texts = append(this.Texts, text)
+	this.Values = append(this.Values, value)
+}
+
+func (this *CustomStructValue) Format() string {
+	var fields []string
+	for i, name := range this.Names {
+		fields = append(fields, fmt.Sprintf("%s=%s", name, this.Texts[i]))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(fields, ", "))
+}
+
+func (this *CustomStructValue) MarshalJSON() ([]byte, error) {
+	// map 会打乱字段顺序 这里手动拼接
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, name := range this.Names {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(this.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+func readCustomRecord(buf *bytes.Buffer) []byte {
+	var arg Arg_str
+	if err := binary.Read(buf, binary.LittleEndian, &arg); err != nil {
+		panic(err)
+	}
+	payload := make([]byte, arg.Len)
+	if arg.Len > 0 {
+		if err := binary.Read(buf, binary.LittleEndian, &payload); err != nil {
+			panic(err)
+		}
+	}
+	return payload
+}
+
+func readCustomValue(data []byte, offset, size uint32) uint64 {
+	if uint32(len(data)) < offset+size {
+		return 0
+	}
+	var value uint64 = 0
+	for i := size; i > 0; i-- {
+		value = value<<8 | uint64(data[offset+i-1])
+	}
+	return value
+}
+
+func sliceCustomData(data []byte, offset, size uint32) []byte {
+	if uint32(len(data)) < offset+size {
+		return nil
+	}
+	return data[offset : offset+size]
+}
+
+func cutCString(data []byte) []byte {
+	if index := bytes.IndexByte(data, 0); index != -1 {
+		return data[:index]
+	}
+	return data
+}
+
+func (this *CustomField) formatElems(data []byte, count uint32, addr uint64) (string, any) {
+	// 格式化连续存放的 count 个元素
+	switch this.Kind {
+	case FIELD_CHAR:
+		text := util.PrettyByteSlice(cutCString(data[:count]))
+		return fmt.Sprintf("(%s)", text), text
+	case FIELD_BUF:
+		text := util.PrettyByteSlice(data[:count])
+		return fmt.Sprintf("(%s)", text), text
+	}
+	var texts []string
+	var values []any
+	for i := uint32(0); i < count; i++ {
+		elem_offset := i * this.GetElemSize()
+		if this.Kind == FIELD_STRUCT {
+			elem := sliceCustomData(data, elem_offset, this.GetElemSize())
+			value := this.Struct.parseFields(elem, addr+uint64(elem_offset), nil, 0, false)
+			texts = append(texts, value.Format())
+			values = append(values, value)
+		} else {
+			value := readCustomValue(data, elem_offset, this.GetElemSize())
+			texts = append(texts, this.NumType.Parse(value, nil, false))
+			values = append(values, this.NumType.ParseJson(value, nil, false))
+		}
+	}
+	return fmt.Sprintf("[%s]", strings.Join(texts, ", ")), values
+}
+
+func (this *ARG_CUSTOM) parseFields(data []byte, addr uint64, buf *bytes.Buffer, depth uint32, follow bool) *CustomStructValue {
+	// follow 为 false 时表示没有对应的读取操作 比如数组中的结构体 这时只解析已有的数据
+	result := &CustomStructValue{}
+	for _, field := range this.Fields {
+		offset := field.Offset
+		field_addr := addr + uint64(offset)
+		var text string
+		var value any
+		switch {
+		case field.Kind == FIELD_STRING:
+			ptr := readCustomValue(data, offset, PTR_SIZE)
+			text = fmt.Sprintf("0x%x", ptr)
+			if follow {
+				str := util.B2STrim(readCustomRecord(buf))
+				text = fmt.Sprintf("0x%x(%s)", ptr, str)
+			}
+			value = text
+		case field.Kind == FIELD_STD:
+			text = fmt.Sprintf("0x%x", field_addr)
+			if follow {
+				str := util.B2STrim(readCustomRecord(buf))
+				text = fmt.Sprintf("0x%x(%s)", field_addr, str)
+			}
+			value = text
+		case field.Kind == FIELD_STRUCT && field.IsPtr && !field.IsArray():
+			ptr := readCustomValue(data, offset, PTR_SIZE)
+			text = fmt.Sprintf("0x%x", ptr)
+			value = text
+			if follow && depth+1 <= CustomMaxDepth {
+				child_data := readCustomRecord(buf)
+				if uint32(len(child_data)) != field.Struct.Size {
+					child_data = nil
+				}
+				// 即使读取失败 也要把后续字段的数据消费掉
+				child := field.Struct.parseFields(child_data, ptr, buf, depth+1, true)
+				if child_data != nil {
+					text = fmt.Sprintf("0x%x%s", ptr, child.Format())
+					value = &struct {
+						Ptr      string             `json:"ptr"`
+						PtrValue *CustomStructValue `json:"ptr_value"`
+					}{
+						Ptr:      fmt.Sprintf("0x%x", ptr),
+						PtrValue: child,
+					}
+				}
+			}
+		case field.IsPtr || field.CountField != "":
+			ptr := readCustomValue(data, offset, PTR_SIZE)
+			if !field.IsPtr {
+				ptr = field_addr
+			}
+			text = fmt.Sprintf("0x%x", ptr)
+			value = text
+			if follow {
+				elems := readCustomRecord(buf)
+				if len(elems) == 0 {
+					break
+				}
+				count := uint32(len(elems)) / field.GetElemSize()
+				if field.CountField != "" {
+					count_field := this.GetField(field.CountField)
+					real_count := readCustomValue(data, count_field.Offset, count_field.GetElemSize())
+					if real_count < uint64(count) {
+						count = uint32(real_count)
+					}
+				} else if field.Count > 0 && field.Count < count {
+					count = field.Count
+				}
+				elems_text, elems_value := field.formatElems(elems, count, ptr)
+				if !field.IsArray() && field.Kind == FIELD_NUM && count == 1 {
+					// 指向单个数字 与 *int 的输出保持一致
+					v := readCustomValue(elems, 0, field.GetElemSize())
+					elems_text = fmt.Sprintf("(%s)", field.NumType.Parse(v, nil, false))
+					elems_value = field.NumType.ParseJson(v, nil, false)
+				}
+				if field.IsPtr {
+					text = fmt.Sprintf("0x%x%s", ptr, elems_text)
+				} else {
+					text = elems_text
+				}
+				value = &struct {
+					Ptr      string `json:"ptr"`
+					PtrValue any    `json:"ptr_value"`
+				}{
+					Ptr:      fmt.Sprintf("0x%x", ptr),
+					PtrValue: elems_value,
+				}
+			}
+		case field.Kind == FIELD_STRUCT && field.Count == 0:
+			child_data := sliceCustomData(data, offset, field.GetElemSize())
+			child := field.Struct.parseFields(child_data, field_addr, buf, depth, follow)
+			text = child.Format()
+			value = child
+		case field.Count > 0:
+			elems := sliceCustomData(data, offset, field.GetElemSize()*field.Count)
+			if elems == nil {
+				elems = make([]byte, field.GetElemSize()*field.Count)
+			}
+			text, value = field.formatElems(elems, field.Count, field_addr)
+		default:
+			v := readCustomValue(data, offset, field.GetElemSize())
+			text = field.NumType.Parse(v, nil, false)
+			value = field.NumType.ParseJson(v, nil, false)
+		}
+		result.Add(field.Name, text, value)
+	}
+	return result
+}
+
+func (this *ARG_CUSTOM) parseValue(ptr uint64, buf *bytes.Buffer) *CustomStructValue {
+	data := readCustomRecord(buf)
+	if uint32(len(data)) != this.Size {
+		data = nil
+	}
+	// 即使结构体读取失败 也需要把后续字段的数据消费掉
+	value := this.parseFields(data, ptr, buf, 0, true)
+	if data == nil {
+		return nil
+	}
+	return value
+}
+
+func (this *ARG_CUSTOM) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
+	if !parse_more {
+		return fmt.Sprintf("0x%x", ptr)
+	}
+	value := this.parseValue(ptr, buf)
+	if value == nil {
+		return fmt.Sprintf("0x%x", ptr)
+	}
+	return fmt.Sprintf("0x%x%s", ptr, value.Format())
+}
+
+func (this *ARG_CUSTOM) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
+	if parse_more {
+		value := this.parseValue(ptr, buf)
+		if value != nil {
+			return &struct {
+				Ptr      string             `json:"ptr"`
+				PtrValue *CustomStructValue `json:"ptr_value"`
+			}{
+				Ptr:      fmt.Sprintf("0x%x", ptr),
+				PtrValue: value,
+			}
+		}
+	}
+	return &struct {
+		Ptr string `json:"ptr"`
+	}{
+		Ptr: fmt.Sprintf("0x%x", ptr),
+	}
+}
+
+func R_CUSTOM_STRUCT(name string) *ARG_CUSTOM {
+	// 先注册一个空的结构体 字段和读取操作在布局确定之后再补充
+	// 这样字段中可以通过指针引用自身或者后声明的类型
+	at, ok := (RegisterNew(name, CUSTOM_STRUCT)).(*ARG_CUSTOM)
+	if !ok {
+		panic("...")
+	}
+	at.Align = 1
+	return at
+}
@@ -0,0 +1,268 @@
+package argtype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "stackplz/user/common"
+	"strings"
+)
+
+// 遍历结构体数组或者链表 元素类型复用已有的结构体定义
+// 每个元素之前保存一次元素地址 最后保存一个 0 作为结束标志 解析时据此判断元素个数
+// 数组 [count] (SAVE_REG) JUMP_BREAK_COUNT_ZERO JUMP_ADDR_ZERO FOR_BREAK [addr][elem] 下一个元素 FOR_BREAK [0]
+// 链表 [max]   JUMP_ADDR_ZERO FOR_BREAK [addr][elem] 取 next 指针 JUMP_ADDR_ZERO FOR_BREAK [next] [0]
+// 链表因为达到 max 结束时 会先保存下一个节点的地址 解析时据此判断是否被截断
+// 以寄存器指定元素个数的数组 会先保存寄存器的值 即真实的元素个数
+
+type ARG_TRAVERSE struct {
+	ARG_STRUCT
+	ElemType IArgType
+	IsList   bool
+	// 实际循环的次数上限
+	MaxCount uint32
+	// 固定个数的数组 配置的元素个数 可能超过 MaxCount
+	RealCount uint32
+	// 是否保存了寄存器指定的元素个数
+	SaveCount bool
+	// 循环体重复执行带来的额外循环次数 按 MaxCount 估算
+	LoopSteps uint32
+}
+
+func (this *ARG_TRAVERSE) Clone() IArgType {
+	p, ok := (this.ARG_STRUCT.Clone()).(*ARG_STRUCT)
+	if !ok {
+		panic("...")
+	}
+	return &ARG_TRAVERSE{*p, this.ElemType, this.IsList, this.MaxCount, this.RealCount, this.SaveCount, this.LoopSteps}
+}
+
+func checkTraverseElem(elem IArgType) {
+	// 只支持一层循环 元素的读取操作中不能再有循环 也不能改动循环计数
+	for _, op_key := range elem.GetOpList() {
+		switch OPM.GetOp(op_key).Code {
+		case OP_FOR_BREAK, OP_SAVE_PTR_STRING, OP_RESET_CTX, OP_SET_BREAK_COUNT, OP_SET_BREAK_COUNT_REG_VALUE, OP_SET_BREAK_COUNT_POINTER_VALUE, OP_LIMIT_BREAK_COUNT:
+			panic(fmt.Sprintf("type %s can not be used as list/array element", elem.GetName()))
+		}
+	}
+	if elem.GetSize() == 0 {
+		panic(fmt.Sprintf("type %s has no size, can not be used as list/array element", elem.GetName()))
+	}
+}
+
+func clampLoopCount(count uint32) uint32 {
+	if count == 0 || count > MAX_LOOP_COUNT {
+		return MAX_LOOP_COUNT
+	}
+	return count
+}
+
+func (this *ARG_TRAVERSE) addElemOps() {
+	// 循环体的开头部分 共 len(ElemType.GetOpList()) + 3 个操作
+	this.AddOp(OPC_SAVE_ADDR)
+	this.AddOp(OPC_SET_TMP_VALUE)
+	this.AddOpList(this.ElemType)
+	this.AddOp(OPC_MOVE_TMP_VALUE)
+}
+
+func (this *ARG_TRAVERSE) addEndOps() {
+	// 跳转的目标 保存结束标志
+	this.AddOp(OPC_RESET_CTX)
+	this.AddOp(OPC_SAVE_ADDR)
+}
+
+func (this *ARG_TRAVERSE) setLoopSteps(body_start, body_end int) {
+	// 循环体 包括结尾的 FOR_BREAK 最多执行 MaxCount 次 而静态计算时只算了一次
+	body_steps := OPM.CountSteps(this.GetOpList()[body_start:body_end])
+	if this.MaxCount > 1 {
+		this.LoopSteps = (this.MaxCount - 1) * body_steps
+	}
+}
+
+func (this *ARG_TRAVERSE) GetMaxSteps() uint32 {
+	// 按元素个数最多的情况 估算在 eBPF 中需要执行的循环次数
+	return OPM.CountSteps(this.GetOpList()) + this.LoopSteps
+}
+
+func (this *ARG_TRAVERSE) readAddr(buf *bytes.Buffer) (uint64, bool) {
+	// 操作数用尽时 内核会在中途停止读取 没有结束标志
+	if buf.Len() == 0 {
+		return 0, false
+	}
+	var elem_addr Arg_reg
+	if err := binary.Read(buf, binary.LittleEndian, &elem_addr); err != nil {
+		panic(err)
+	}
+	return elem_addr.Address, true
+}
+
+func (this *ARG_TRAVERSE) parseElems(buf *bytes.Buffer, fn func(uint64)) (count uint32, real_count string, truncated bool) {
+	// 返回读取到的元素个数 真实的元素个数 是否被截断
+	real := uint64(this.RealCount)
+	if this.SaveCount {
+		value, ok := this.readAddr(buf)
+		if !ok {
+			return 0, "?", true
+		}
+		real = value
+	}
+	defer func() {
+		// 数据不完整时 元素的解析会读到末尾 按截断处理
+		if err := recover(); err != nil {
+			if buf.Len() != 0 {
+				panic(err)
+			}
+			truncated = true
+			real_count = "?"
+		}
+	}()
+	for {
+		addr, ok := this.readAddr(buf)
+		if !ok {
+			return count, "?", true
+		}
+		if addr == 0 {
+			break
+		}
+		if this.IsList && count == this.MaxCount {
+			// 链表达到了上限 这里是下一个节点的地址 后面还有结束标志
+			this.readAddr(buf)
+			return count, fmt.Sprintf(">%d", count), true
+		}
+		fn(addr)
+		count += 1
+	}
+	if !this.IsList && count == this.MaxCount && real > uint64(count) {
+		return count, fmt.Sprintf("%d", real), true
+	}
+	return count, fmt.Sprintf("%d", count), false
+}
+
+func (this *ARG_TRAVERSE) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
+	if !parse_more {
+		return fmt.Sprintf("0x%x", ptr)
+	}
+	var results []string
+	count, real_count, truncated := this.parseElems(buf, func(addr uint64) {
+		results = append(results, this.ElemType.Parse(addr, buf, true))
+	})
+	content := fmt.Sprintf("0x%x[%s]", ptr, strings.Join(results, ", "))
+	if truncated {
+		content += fmt.Sprintf("<truncated %d/%s>", count, real_count)
+	}
+	return content
+}
+
+func (this *ARG_TRAVERSE) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
+	if !parse_more {
+		return &struct {
+			Ptr string `json:"ptr"`
+		}{
+			Ptr: fmt.Sprintf("0x%x", ptr),
+		}
+	}
+	results := []any{}
+	_, real_count, truncated := this.parseElems(buf, func(addr uint64) {
+		results = append(results, this.ElemType.ParseJson(addr, buf, true))
+	})
+	return &struct {
+		Ptr       string `json:"ptr"`
+		PtrValue  []any  `json:"ptr_value"`
+		RealCount string `json:"real_count"`
+		Truncated bool   `json:"truncated"`
+	}{
+		Ptr:       fmt.Sprintf("0x%x", ptr),
+		PtrValue:  results,
+		RealCount: real_count,
+		Truncated: truncated,
+	}
+}
+
+func newTraverse(name string, elem IArgType, is_list bool) *ARG_TRAVERSE {
+	at, ok := (RegisterNew(name, TRAVERSE_STRUCT)).(*ARG_TRAVERSE)
+	if !ok {
+		panic("...")
+	}
+	at.ElemType = elem
+	at.IsList = is_list
+	return at
+}
+
+func R_STRUCT_LIST(elem IArgType, next_offset uint64, max_count uint32) IArgType {
+	// 沿着 next 指针遍历链表 最多 max_count 个节点 超过 MAX_LOOP_COUNT 时按截断输出
+	name := fmt.Sprintf("list:%s+%d#%d", elem.GetName(), next_offset, max_count)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	checkTraverseElem(elem)
+	at := newTraverse(name, elem, true)
+	at.MaxCount = clampLoopCount(max_count)
+	at.AddOp(OPC_SET_BREAK_COUNT.NewValue(uint64(at.MaxCount)))
+	// 跳过 FOR_BREAK 循环体 读取 next JUMP_ADDR_ZERO FOR_BREAK SAVE_ADDR
+	elem_count := uint32(len(elem.GetOpList())) + 3
+	at.AddOp(OPC_JUMP_ADDR_ZERO.NewValue(uint64(elem_count + 5)))
+	at.AddOp(OPC_FOR_BREAK)
+	body_start := len(at.GetOpList())
+	at.addElemOps()
+	at.AddOp(BuildReadPtrAddr(next_offset))
+	// 遇到空指针时 跳过 FOR_BREAK SAVE_ADDR
+	at.AddOp(OPC_JUMP_ADDR_ZERO.NewValue(2))
+	at.AddOp(OPC_FOR_BREAK)
+	at.setLoopSteps(body_start, len(at.GetOpList()))
+	// 达到上限时 保存下一个节点的地址
+	at.AddOp(OPC_SAVE_ADDR)
+	at.addEndOps()
+	return at
+}
+
+func newStructArray(name string, elem IArgType, max_count uint32, count_ops ...*OpConfig) *ARG_TRAVERSE {
+	checkTraverseElem(elem)
+	at := newTraverse(name, elem, false)
+	at.MaxCount = max_count
+	for _, op := range count_ops {
+		at.AddOp(op)
+	}
+	// 跳过 (JUMP_ADDR_ZERO) FOR_BREAK 循环体 ADD_OFFSET FOR_BREAK
+	elem_count := uint32(len(elem.GetOpList())) + 3
+	at.AddOp(OPC_JUMP_BREAK_COUNT_ZERO.NewValue(uint64(elem_count + 4)))
+	at.AddOp(OPC_JUMP_ADDR_ZERO.NewValue(uint64(elem_count + 3)))
+	at.AddOp(OPC_FOR_BREAK)
+	body_start := len(at.GetOpList())
+	at.addElemOps()
+	at.AddOp(OPC_ADD_OFFSET.NewValue(uint64(elem.GetSize())))
+	at.AddOp(OPC_FOR_BREAK)
+	at.setLoopSteps(body_start, len(at.GetOpList()))
+	at.addEndOps()
+	return at
+}
+
+func R_STRUCT_ARRAY(elem IArgType, count uint32) IArgType {
+	// 固定个数的结构体数组 超过 MAX_LOOP_COUNT 时按截断输出
+	name := fmt.Sprintf("array:%s#%d", elem.GetName(), count)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	max_count := count
+	if max_count > MAX_LOOP_COUNT {
+		max_count = MAX_LOOP_COUNT
+	}
+	at := newStructArray(name, elem, max_count, OPC_SET_BREAK_COUNT.NewValue(uint64(max_count)))
+	at.RealCount = count
+	return at
+}
+
+func R_STRUCT_ARRAY_REG(elem IArgType, reg_index, max_count uint32) IArgType {
+	// 以寄存器的值作为元素个数 最多读取 max_count 个 同时保存真实的元素个数
+	max_count = clampLoopCount(max_count)
+	name := fmt.Sprintf("array:%s#reg%d#%d", elem.GetName(), reg_index, max_count)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	count_ops := []*OpConfig{BuildReadRegBreakCount(uint64(reg_index)), OPC_SAVE_REG}
+	if max_count < MAX_LOOP_COUNT {
+		count_ops = append(count_ops, OPC_LIMIT_BREAK_COUNT.NewValue(uint64(max_count)))
+	}
+	at := newStructArray(name, elem, max_count, count_ops...)
+	at.SaveCount = true
+	return at
+}
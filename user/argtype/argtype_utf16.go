@@ -0,0 +1,261 @@
+package argtype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	. "stackplz/user/common"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// UTF-16 编码的字符串和数据 以及 ART 中的 java.lang.String 即 mirror::String
+// u16str     SET_READ_LEN [page_chunk] [page_chunk] 固定读取 最多 MaxChars 个字符 解析时以 \x00\x00 作为结尾
+// u16buf     SET_READ_LEN SAVE_STRUCT 长度以字符个数计
+// art_string [count] READ_ART_STRING [value] 根据 count 的最低位判断是 Latin-1 还是 UTF-16
+
+const (
+	UTF16_KIND_STRING uint32 = iota
+	UTF16_KIND_BUFFER
+	UTF16_KIND_ART_STRING
+)
+
+// u16str 按内存页分段读取 不超过 MAX_BUF_READ_SIZE 的范围最多跨越两个页
+// 后面的页不可读时 只会丢失后面的段
+const UTF16_CHUNK_COUNT = 2
+
+// mirror::String 中 count 字段与 value 字段的距离 即中间的 hash_code_
+const ART_STRING_VALUE_OFFSET = 8
+
+type ARG_UTF16 struct {
+	ArgType
+	Kind       uint32
+	MaxChars   uint32
+	ChunkCount uint32
+}
+
+func (this *ARG_UTF16) Clone() IArgType {
+	p, ok := (this.ArgType.Clone()).(*ArgType)
+	if !ok {
+		panic("...")
+	}
+	return &ARG_UTF16{*p, this.Kind, this.MaxChars, this.ChunkCount}
+}
+
+func (this *ARG_UTF16) readPayload(buf *bytes.Buffer) []byte {
+	var arg Arg_str
+	if err := binary.Read(buf, binary.LittleEndian, &arg); err != nil {
+		panic(err)
+	}
+	payload := make([]byte, arg.Len)
+	if err := binary.Read(buf, binary.LittleEndian, &payload); err != nil {
+		panic(err)
+	}
+	return payload
+}
+
+func toUTF16Units(data []byte) []uint16 {
+	// 多出来的单个字节直接丢弃
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return units
+}
+
+func prettyRunes(runes []rune) string {
+	var out strings.Builder
+	for _, r := range runes {
+		if unicode.IsPrint(r) {
+			out.WriteRune(r)
+		} else if r < 0x100 {
+			out.WriteString(fmt.Sprintf("\\x%02x", r))
+		} else {
+			out.WriteString(fmt.Sprintf("\\u%04x", r))
+		}
+	}
+	return out.String()
+}
+
+func (this *ARG_UTF16) parseData(buf *bytes.Buffer) ([]rune, uint32, string, bool) {
+	// 返回解码后的内容 实际读取的字符个数 真实的字符个数 是否被截断
+	switch this.Kind {
+	case UTF16_KIND_STRING:
+		var data []byte
+		for i := uint32(0); i < this.ChunkCount; i++ {
+			data = append(data, this.readPayload(buf)...)
+		}
+		units := toUTF16Units(data)
+		for i, unit := range units {
+			if unit == 0 {
+				return utf16.Decode(units[:i]), uint32(i), fmt.Sprintf("%d", i), false
+			}
+		}
+		count := uint32(len(units))
+		if count == this.MaxChars {
+			// 读满了也没有遇到结尾 只知道超出了上限
+			return utf16.Decode(units), count, fmt.Sprintf(">%d", count), true
+		}
+		// 后面的段读取失败了 原样输出已经读到的部分
+		return utf16.Decode(units), count, fmt.Sprintf("%d", count), false
+	case UTF16_KIND_BUFFER:
+		units := toUTF16Units(this.readPayload(buf))
+		count := uint32(len(units))
+		return utf16.Decode(units), count, fmt.Sprintf("%d", count), false
+	case UTF16_KIND_ART_STRING:
+		count_data := this.readPayload(buf)
+		data := this.readPayload(buf)
+		if len(count_data) != 4 {
+			return nil, 0, "0", false
+		}
+		count := binary.LittleEndian.Uint32(count_data)
+		real_len := count >> 1
+		var runes []rune
+		if count&1 == 0 {
+			// 压缩存储 即 Latin-1 每个字符一个字节
+			for _, b := range data {
+				runes = append(runes, rune(b))
+			}
+		} else {
+			runes = utf16.Decode(toUTF16Units(data))
+		}
+		captured := uint32(len(data))
+		if count&1 != 0 {
+			captured = uint32(len(data) / 2)
+		}
+		return runes, captured, fmt.Sprintf("%d", real_len), captured < real_len
+	default:
+		panic(fmt.Sprintf("unknown utf16 kind:%d", this.Kind))
+	}
+}
+
+func (this *ARG_UTF16) GetMaxDataSize() uint32 {
+	// 最坏的情况下在事件缓冲区中占用的大小 每段 [index][len]
+	switch this.Kind {
+	case UTF16_KIND_STRING:
+		return this.MaxChars*2 + this.ChunkCount*5
+	case UTF16_KIND_ART_STRING:
+		return 4 + MAX_BUF_READ_SIZE + 5*2
+	default:
+		return MAX_BUF_READ_SIZE + 5
+	}
+}
+
+func (this *ARG_UTF16) Parse(ptr uint64, buf *bytes.Buffer, parse_more bool) string {
+	if !parse_more {
+		return fmt.Sprintf("0x%x", ptr)
+	}
+	// 文本输出时转义不可打印的字符 json 中保留原始内容
+	value, captured, real_len, truncated := this.parseData(buf)
+	content := fmt.Sprintf("(%s)", prettyRunes(value))
+	if truncated {
+		content += fmt.Sprintf("<truncated %d/%s>", captured, real_len)
+	}
+	return fmt.Sprintf("0x%x%s", ptr, content)
+}
+
+func (this *ARG_UTF16) ParseJson(ptr uint64, buf *bytes.Buffer, parse_more bool) any {
+	if !parse_more {
+		return &struct {
+			Ptr string `json:"ptr"`
+		}{
+			Ptr: fmt.Sprintf("0x%x", ptr),
+		}
+	}
+	value, captured, real_len, truncated := this.parseData(buf)
+	type UTF16Value struct {
+		Value       string `json:"value"`
+		CapturedLen string `json:"captured_len"`
+		RealLen     string `json:"real_len"`
+		Truncated   bool   `json:"truncated"`
+	}
+	return &struct {
+		Ptr      string      `json:"ptr"`
+		PtrValue *UTF16Value `json:"ptr_value"`
+	}{
+		Ptr: fmt.Sprintf("0x%x", ptr),
+		PtrValue: &UTF16Value{
+			Value:       string(value),
+			CapturedLen: fmt.Sprintf("%d", captured),
+			RealLen:     real_len,
+			Truncated:   truncated,
+		},
+	}
+}
+
+func newUTF16(name string, kind uint32) *ARG_UTF16 {
+	at, ok := (RegisterNew(name, UTF16_DATA)).(*ARG_UTF16)
+	if !ok {
+		panic("...")
+	}
+	at.Kind = kind
+	return at
+}
+
+func R_UTF16_STRING(max_chars uint32) IArgType {
+	// 以 \x00\x00 结尾的 UTF-16LE 字符串 最多读取 max_chars 个字符
+	if max_chars == 0 || max_chars > MAX_BUF_READ_SIZE/2 {
+		panic(fmt.Sprintf("u16str max_len should be in 1~%d, provided:%d", MAX_BUF_READ_SIZE/2, max_chars))
+	}
+	name := fmt.Sprintf("u16str_%d", max_chars)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	at := newUTF16(name, UTF16_KIND_STRING)
+	at.MaxChars = max_chars
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(max_chars * 2)))
+	at.AddOp(OPC_SET_TMP_VALUE)
+	for i := 0; i < UTF16_CHUNK_COUNT; i++ {
+		at.AddOp(OPC_SAVE_STRUCT_PAGE_CHUNK.NewValue(uint64(MAX_BUF_READ_SIZE)))
+	}
+	at.ChunkCount = UTF16_CHUNK_COUNT
+	at.AddOp(OPC_MOVE_TMP_VALUE)
+	return at
+}
+
+func R_UTF16_BUFFER_LEN(length uint32) IArgType {
+	// 固定读取 length 个字符
+	if length > MAX_BUF_READ_SIZE/2 {
+		panic(fmt.Sprintf("max u16buf read size:%d, provided:%d", MAX_BUF_READ_SIZE/2, length))
+	}
+	name := fmt.Sprintf("u16buf_len_%d", length)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	at := newUTF16(name, UTF16_KIND_BUFFER)
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(length * 2)))
+	at.AddOp(OPC_SAVE_STRUCT)
+	return at
+}
+
+func R_UTF16_BUFFER_REG(reg_index uint32) IArgType {
+	// 以寄存器的值作为字符个数
+	name := fmt.Sprintf("u16buf_reg_%d", reg_index)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	at := newUTF16(name, UTF16_KIND_BUFFER)
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(MAX_BUF_READ_SIZE / 2)))
+	at.AddOp(BuildReadRegLen(uint64(reg_index)))
+	at.AddOp(OPC_SET_READ_COUNT.NewValue(2))
+	at.AddOp(OPC_SAVE_STRUCT)
+	return at
+}
+
+func R_ART_STRING(count_offset uint64) IArgType {
+	// mirror::String 对象 count_offset 为 count 字段在对象中的偏移
+	// count = (length << 1) | flag 其中 flag 为 0 表示压缩存储 之后是 hash_code_ 和 value
+	name := fmt.Sprintf("art_string_%d", count_offset)
+	if at := FindArgTypeByName(name); at != nil {
+		return at
+	}
+	at := newUTF16(name, UTF16_KIND_ART_STRING)
+	at.AddOp(OPC_ADD_OFFSET.NewValue(count_offset))
+	at.AddOp(OPC_SET_READ_LEN.NewValue(4))
+	at.AddOp(OPC_SAVE_STRUCT)
+	at.AddOp(OPC_SET_READ_LEN.NewValue(uint64(MAX_BUF_READ_SIZE)))
+	at.AddOp(OPC_READ_ART_STRING.NewValue(ART_STRING_VALUE_OFFSET))
+	at.AddOp(OPC_SAVE_STRUCT)
+	return at
+}
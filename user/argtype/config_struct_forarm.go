@@ -10,6 +10,9 @@ import (
 	"strings"
 )
 
+// 目标进程的指针大小
+const PTR_SIZE = 4
+
 type Utsname struct {
 	Sysname    [65]uint8
 	Nodename   [65]uint8
@@ -37,4 +37,8 @@ const (
 	TYPE_STACK_T
 	TYPE_POLLFD
 	TYPE_STAT
+	TYPE_CUSTOM
+	TYPE_TRAVERSE
+	TYPE_CHUNK
+	TYPE_UTF16
 )
@@ -197,7 +197,8 @@ func GetArgType(type_index uint32) IArgType {
 	return p
 }
 
-func GetArgTypeByName(name string) IArgType {
+func FindArgTypeByName(name string) IArgType {
+	// 找不到时返回 nil 由调用方决定如何处理
 	for _, arg_type := range arg_types {
 		if arg_type.GetName() == name {
 			return arg_type
@@ -206,7 +207,15 @@ func GetArgTypeByName(name string) IArgType {
 			return arg_type
 		}
 	}
-	panic(fmt.Sprintf("GetArgType failed, name=%s not exists", name))
+	return nil
+}
+
+func GetArgTypeByName(name string) IArgType {
+	arg_type := FindArgTypeByName(name)
+	if arg_type == nil {
+		panic(fmt.Sprintf("GetArgType failed, name=%s not exists", name))
+	}
+	return arg_type
 }
 
 func PreRegister() {
@@ -37,6 +37,17 @@ const (
 	OP_SAVE_STRING
 	OP_SAVE_PTR_STRING
 	OP_READ_STD_STRING
+	OP_JUMP_ADDR_ZERO
+	OP_JUMP_BREAK_COUNT_ZERO
+	OP_SET_READ_LEN_RET_VALUE
+	OP_SAVE_READ_LEN
+	OP_SAVE_STRUCT_CHUNK
+	OP_SAVE_STRING_CHUNK
+	OP_READ_ART_STRING
+	OP_LIMIT_BREAK_COUNT
+	OP_SAVE_STR_LEN
+	OP_MASK_POINTER_VALUE
+	OP_SAVE_STRUCT_PAGE_CHUNK
 )
 
 type BaseOpConfig struct {
@@ -140,6 +151,18 @@ func (this *OpManager) GetOpInfo(index uint32) string {
 	return fmt.Sprintf("%s %s %s %d", code_name, pre_code_name, post_code_name, op.Value)
 }
 
+func (this *OpManager) CountSteps(op_keys []uint32) uint32 {
+	// eBPF 中每执行一个操作计一次循环 有 post_code 的操作计两次
+	var steps uint32 = 0
+	for _, op_key := range op_keys {
+		steps += 1
+		if this.GetOp(op_key).PostCode != OP_SKIP {
+			steps += 1
+		}
+	}
+	return steps
+}
+
 func (this *OpManager) AddOp(op *OpConfig) *OpConfig {
 	for _, v := range this.OpList {
 		if v.SameAs(op) {
@@ -293,6 +316,17 @@ var OPC_FILTER_BUFFER = ROP("FILTER_BUFFER", OP_FILTER_BUFFER)
 var OPC_FILTER_STRING = ROP("FILTER_STRING", OP_FILTER_STRING)
 var OPC_SAVE_PTR_STRING = ROP("SAVE_PTR_STRING", OP_SAVE_PTR_STRING)
 var OPC_READ_STD_STRING = ROP("READ_STD_STRING", OP_READ_STD_STRING)
+var OPC_JUMP_ADDR_ZERO = ROP("JUMP_ADDR_ZERO", OP_JUMP_ADDR_ZERO)
+var OPC_JUMP_BREAK_COUNT_ZERO = ROP("JUMP_BREAK_COUNT_ZERO", OP_JUMP_BREAK_COUNT_ZERO)
+var OPC_SET_READ_LEN_RET_VALUE = ROP("SET_READ_LEN_RET_VALUE", OP_SET_READ_LEN_RET_VALUE)
+var OPC_SAVE_READ_LEN = ROP("SAVE_READ_LEN", OP_SAVE_READ_LEN)
+var OPC_SAVE_STRUCT_CHUNK = ROP("SAVE_STRUCT_CHUNK", OP_SAVE_STRUCT_CHUNK)
+var OPC_SAVE_STRING_CHUNK = ROP("SAVE_STRING_CHUNK", OP_SAVE_STRING_CHUNK)
+var OPC_READ_ART_STRING = ROP("READ_ART_STRING", OP_READ_ART_STRING)
+var OPC_LIMIT_BREAK_COUNT = ROP("LIMIT_BREAK_COUNT", OP_LIMIT_BREAK_COUNT)
+var OPC_SAVE_STR_LEN = ROP("SAVE_STR_LEN", OP_SAVE_STR_LEN)
+var OPC_MASK_POINTER_VALUE = ROP("MASK_POINTER_VALUE", OP_MASK_POINTER_VALUE)
+var OPC_SAVE_STRUCT_PAGE_CHUNK = ROP("SAVE_STRUCT_PAGE_CHUNK", OP_SAVE_STRUCT_PAGE_CHUNK)
 
 func BuildReadRegBreakCount(reg_index uint64) *OpConfig {
 	op := OpConfig{}
@@ -334,6 +368,27 @@ func BuildReadPtrLen(offset uint64) *OpConfig {
 	return &op
 }
 
+func BuildReadPtr(offset uint64) *OpConfig {
+	op := OpConfig{}
+	op.Name = fmt.Sprintf("%s_%d", "READ_PTR", offset)
+	op.Code = OP_READ_POINTER
+	op.PreCode = OP_ADD_OFFSET
+	op.PostCode = OP_SKIP
+	op.Value = offset
+	return &op
+}
+
+// 搭配 BuildReadPtr 使用 字段宽度小于指针时 截取读到的值再作为读取长度
+func BuildMaskPtrLen(byte_size uint64) *OpConfig {
+	op := OpConfig{}
+	op.Name = fmt.Sprintf("%s_%d", "MASK_PTR_AS_READ_LEN", byte_size)
+	op.Code = OP_MASK_POINTER_VALUE
+	op.PreCode = OP_SKIP
+	op.PostCode = OP_SET_READ_LEN_POINTER_VALUE
+	op.Value = byte_size
+	return &op
+}
+
 func BuildReadPtrAddr(offset uint64) *OpConfig {
 	op := OpConfig{}
 	op.Name = fmt.Sprintf("%s_%d", "READ_PTR_AS_ADDR", offset)
@@ -7,7 +7,11 @@ const SYSCALL_MAX_OP_COUNT = 256
 const STACK_MAX_OP_COUNT = 64
 const MAX_STRCMP_LEN = 256
 const MAX_BUF_READ_SIZE = 4096
+const MAX_CHUNK_READ_SIZE = MAX_BUF_READ_SIZE * 4
+const READ_PAGE_SIZE = 0x1000
 const STRARR_MAGIC_LEN = 0xffff0000
+const STR_LEN_UNTERMINATED = 0x100000000
+const ARGS_BUF_SIZE = 32000
 
 const (
 	REG_ARM_R0 uint32 = iota
@@ -65,6 +69,12 @@ var RegsArmNameMap map[string]uint32 = map[string]uint32{
 	"sp":  REG_ARM_SP,
 	"lr":  REG_ARM_LR,
 	"pc":  REG_ARM_PC,
+	// 按编号的别名
+	"r11": REG_ARM_FP,
+	"r12": REG_ARM_IP,
+	"r13": REG_ARM_SP,
+	"r14": REG_ARM_LR,
+	"r15": REG_ARM_PC,
 }
 
 const (
@@ -176,6 +186,20 @@ var RegsIdxMap map[uint32]string = map[uint32]string{
 	REG_ARM64_PC:  "pc",
 }
 
+// 64 位进程 perf 采样到的寄存器布局 默认为 arm64 其他架构在各自的文件中覆盖
+// 没有 lr 的架构 PerfRegLR 设置为 PerfRegsCount
+// RegsNameMap RegsIdxMap 对应 eBPF 中 ctx 寄存器的下标 与 perf 的布局不一定相同 不要混用
+var (
+	PerfRegsNameMap map[string]uint32 = RegsNameMap
+	PerfRegsIdxMap  map[uint32]string = RegsIdxMap
+	PerfRegsCount   uint32            = REG_ARM64_MAX
+	PerfRegMask     uint64            = (1 << REG_ARM64_MAX) - 1
+	PerfRegFP       uint32            = REG_ARM64_X29
+	PerfRegLR       uint32            = REG_ARM64_LR
+	PerfRegSP       uint32            = REG_ARM64_SP
+	PerfRegPC       uint32            = REG_ARM64_PC
+)
+
 const (
 	CONST_ARGTYPE_START uint32 = iota
 	POINTER
@@ -232,6 +256,10 @@ const (
 	INT_SOCKET_FLAGS
 	INT_FILE_FLAGS
 	INT16_PERM_FLAGS
+	CUSTOM_STRUCT
+	TRAVERSE_STRUCT
+	CHUNK_DATA
+	UTF16_DATA
 	CONST_ARGTYPE_END
 )
 
@@ -241,4 +269,7 @@ const (
 	BRK_EVENT
 	UPROBE_EVENT
 	SYSCALL_EVENT
+	CRASH_EVENT
+	EXEC_EVENT
+	TASK_EXIT_EVENT
 )
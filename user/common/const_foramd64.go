@@ -0,0 +1,118 @@
+//go:build amd64 && !forarm
+// +build amd64,!forarm
+
+package common
+
+import "fmt"
+
+// ctx_regs_t 中的寄存器布局 与 src/common/arch.h 中 read_ctx_regs 保持一致
+// 参数寄存器放在最前面 arg3 对系统调用是 r10 对普通函数是 rcx
+var RegsX86CtxNameMap map[string]uint32 = map[string]uint32{
+	"rdi":      0,
+	"rsi":      1,
+	"rdx":      2,
+	"arg3":     3,
+	"r8":       4,
+	"r9":       5,
+	"rax":      6,
+	"rbx":      7,
+	"rbp":      8,
+	"rcx":      9,
+	"r10":      10,
+	"r11":      11,
+	"r12":      12,
+	"r13":      13,
+	"r14":      14,
+	"r15":      15,
+	"ret_addr": REG_ARM64_LR,
+	"rsp":      REG_ARM64_SP,
+	"rip":      REG_ARM64_PC,
+}
+
+// perf 采样只返回 mask 中的寄存器 ds es fs gs 对 64 位进程不可用 所以下标是压缩后的
+// https://elixir.bootlin.com/linux/v5.10/source/arch/x86/include/uapi/asm/perf_regs.h
+const (
+	REG_X86_RAX uint32 = iota
+	REG_X86_RBX
+	REG_X86_RCX
+	REG_X86_RDX
+	REG_X86_RSI
+	REG_X86_RDI
+	REG_X86_RBP
+	REG_X86_RSP
+	REG_X86_RIP
+	REG_X86_FLAGS
+	REG_X86_CS
+	REG_X86_SS
+	REG_X86_R8
+	REG_X86_R9
+	REG_X86_R10
+	REG_X86_R11
+	REG_X86_R12
+	REG_X86_R13
+	REG_X86_R14
+	REG_X86_R15
+	REG_X86_MAX
+)
+
+var RegsX86NameMap map[string]uint32 = map[string]uint32{
+	"rax":   REG_X86_RAX,
+	"rbx":   REG_X86_RBX,
+	"rcx":   REG_X86_RCX,
+	"rdx":   REG_X86_RDX,
+	"rsi":   REG_X86_RSI,
+	"rdi":   REG_X86_RDI,
+	"rbp":   REG_X86_RBP,
+	"rsp":   REG_X86_RSP,
+	"rip":   REG_X86_RIP,
+	"flags": REG_X86_FLAGS,
+	"cs":    REG_X86_CS,
+	"ss":    REG_X86_SS,
+	"r8":    REG_X86_R8,
+	"r9":    REG_X86_R9,
+	"r10":   REG_X86_R10,
+	"r11":   REG_X86_R11,
+	"r12":   REG_X86_R12,
+	"r13":   REG_X86_R13,
+	"r14":   REG_X86_R14,
+	"r15":   REG_X86_R15,
+	// 与 arm64 通用的名字
+	"sp": REG_X86_RSP,
+	"pc": REG_X86_RIP,
+}
+
+func GetRegIndex(reg string) uint32 {
+	value, ok := RegsX86CtxNameMap[reg]
+	if !ok {
+		panic(fmt.Sprintf("ParseAsReg failed =>%s<=", reg))
+	}
+	return value
+}
+
+// ctx 寄存器下标对应的名称 与 GetRegIndex 相反
+func GetRegName(index uint32) (string, bool) {
+	for name, value := range RegsX86CtxNameMap {
+		if value == index {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func init() {
+	PerfRegsNameMap = RegsX86NameMap
+	PerfRegsIdxMap = make(map[uint32]string)
+	for name, index := range RegsX86NameMap {
+		if name == "sp" || name == "pc" {
+			continue
+		}
+		PerfRegsIdxMap[index] = name
+	}
+	PerfRegsCount = REG_X86_MAX
+	// ax ~ ss 为 bit0 ~ bit11 r8 ~ r15 为 bit16 ~ bit23
+	PerfRegMask = 0xfff | (0xff << 16)
+	PerfRegFP = REG_X86_RBP
+	PerfRegLR = REG_X86_MAX
+	PerfRegSP = REG_X86_RSP
+	PerfRegPC = REG_X86_RIP
+}
@@ -6,9 +6,21 @@ package common
 import "fmt"
 
 func GetRegIndex(reg string) uint32 {
+	// 32 位进程的 r0 ~ r14 依次保存在 regs[0] ~ regs[14] 中 pc 则是单独的字段
+	if reg == "pc" || reg == "r15" {
+		return REG_ARM64_PC
+	}
 	value, ok := RegsArmNameMap[reg]
 	if !ok {
 		panic(fmt.Sprintf("ParseAsReg failed =>%s<=", reg))
 	}
 	return value
 }
+
+func GetRegName(index uint32) (string, bool) {
+	if index == REG_ARM64_PC {
+		return "pc", true
+	}
+	name, ok := RegsArmIdxMap[index]
+	return name, ok
+}
@@ -1,5 +1,5 @@
-//go:build !forarm
-// +build !forarm
+//go:build !forarm && !amd64
+// +build !forarm,!amd64
 
 package common
 
@@ -12,3 +12,8 @@ func GetRegIndex(reg string) uint32 {
 	}
 	return value
 }
+
+func GetRegName(index uint32) (string, bool) {
+	name, ok := RegsIdxMap[index]
+	return name, ok
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 按调用来源库过滤 每组库占用 caller_mask 的一位
+// 第一组固定为 --caller 指定的全局设定 配置文件中 hook 点的 caller 字段可以单独指定
+const MAX_CALLER_GROUP = 32
+
+// 与 ebpf 中的 caller_range_t 对应
+type CallerRange struct {
+	Start uint64
+	End   uint64
+	Mask  uint32
+	Pad   uint32
+}
+
+type CallerConfig struct {
+	Groups     [][]string
+	GlobalMask uint32
+}
+
+func (this *CallerConfig) IsEnable() bool {
+	return len(this.Groups) > 0
+}
+
+func (this *CallerConfig) addGroup(libs []string) (uint32, error) {
+	var items []string
+	for _, lib := range libs {
+		lib = strings.TrimSpace(lib)
+		if lib != "" {
+			items = append(items, lib)
+		}
+	}
+	if len(items) == 0 {
+		return 0, errors.New("caller library is empty")
+	}
+	key := strings.Join(items, ",")
+	for index, group := range this.Groups {
+		if strings.Join(group, ",") == key {
+			return 1 << index, nil
+		}
+	}
+	if len(this.Groups) >= MAX_CALLER_GROUP {
+		return 0, errors.New(fmt.Sprintf("max caller group count is %d", MAX_CALLER_GROUP))
+	}
+	this.Groups = append(this.Groups, items)
+	return 1 << (len(this.Groups) - 1), nil
+}
+
+func MatchCallerLib(name, lib_path string) bool {
+	// 可以是完整路径 也可以只是库名
+	return name == lib_path || name == filepath.Base(lib_path)
+}
+
+// 返回包含该库的所有组的 mask
+func (this *CallerConfig) GetMask(lib_path string) uint32 {
+	var mask uint32 = 0
+	for index, group := range this.Groups {
+		for _, name := range group {
+			if MatchCallerLib(name, lib_path) {
+				mask |= 1 << index
+				break
+			}
+		}
+	}
+	return mask
+}
+
+func (this *CallerConfig) pointMask(libs []string) (uint32, error) {
+	if len(libs) == 0 {
+		return this.GlobalMask, nil
+	}
+	return this.addGroup(libs)
+}
+
+func (this *ModuleConfig) Parse_Caller(gconfig *GlobalConfig) error {
+	if gconfig.Caller != "" {
+		mask, err := this.Caller.addGroup(strings.Split(gconfig.Caller, ","))
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse --caller %s failed, err:%v", gconfig.Caller, err))
+		}
+		this.Caller.GlobalMask = mask
+	}
+	for _, point := range this.SysCallConf.PointArgs {
+		mask, err := this.Caller.pointMask(point.CallerLibs)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse caller for %s failed, err:%v", point.Name, err))
+		}
+		point.CallerMask = mask
+	}
+	for _, point := range this.StackUprobeConf.Points {
+		if point.IsExitPoint() {
+			continue
+		}
+		mask, err := this.Caller.pointMask(point.CallerLibs)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse caller for %s failed, err:%v", point.Name, err))
+		}
+		point.CallerMask = mask
+	}
+	return nil
+}
@@ -0,0 +1,526 @@
+package config
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"stackplz/user/argtype"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// 通过库中的 DWARF 调试信息生成 types 声明 然后按自定义结构体的方式注册
+// 参数类型写作 dwarf:struct session_ctx 或者 dwarf:session_ctx
+
+const DWARF_TYPE_PREFIX = "dwarf:"
+
+var dwarf_cache = make(map[string]*dwarf.Data)
+var dwarf_bases_cache = make(map[string]map[*dwarf.StructType][]dwarfBase)
+
+// 已注册的类型来自哪个文件 同名的类型不能再从其他文件加载
+var dwarf_type_paths = make(map[string]string)
+
+func loadDwarf(path string) (*dwarf.Data, error) {
+	if data, ok := dwarf_cache[path]; ok {
+		return data, nil
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := f.DWARF()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("load dwarf from %s failed, err:%v", path, err))
+	}
+	dwarf_cache[path] = data
+	return data, nil
+}
+
+// C++ 的基类 debug/dwarf 的 StructType 中只有 DW_TAG_member 所以单独解析 DW_TAG_inheritance
+type dwarfBase struct {
+	st      *dwarf.StructType
+	offset  int64
+	virtual bool
+}
+
+func dwarfMemberLocation(entry *dwarf.Entry) (int64, bool) {
+	switch v := entry.Val(dwarf.AttrDataMemberLoc).(type) {
+	case nil:
+		return 0, true
+	case int64:
+		return v, true
+	case []byte:
+		// DWARF 2 中为位置表达式 常见的只有 DW_OP_plus_uconst
+		if len(v) < 2 || v[0] != 0x23 {
+			return 0, false
+		}
+		var value int64
+		var shift uint
+		for _, b := range v[1:] {
+			value |= int64(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func loadDwarfBases(path string, data *dwarf.Data) (map[*dwarf.StructType][]dwarfBase, error) {
+	if bases, ok := dwarf_bases_cache[path]; ok {
+		return bases, nil
+	}
+	// data.Type 按偏移缓存类型 所以这里得到的 StructType 与成员类型中引用的是同一个
+	bases := make(map[*dwarf.StructType][]dwarfBase)
+	var parents []*dwarf.Entry
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			if len(parents) > 0 {
+				parents = parents[:len(parents)-1]
+			}
+			continue
+		}
+		if entry.Tag == dwarf.TagInheritance && len(parents) > 0 {
+			parent := parents[len(parents)-1]
+			if parent.Tag != dwarf.TagStructType && parent.Tag != dwarf.TagClassType {
+				continue
+			}
+			base_offset, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+			if !ok {
+				continue
+			}
+			t, err := data.Type(parent.Offset)
+			if err != nil {
+				return nil, err
+			}
+			base_t, err := data.Type(base_offset)
+			if err != nil {
+				return nil, err
+			}
+			st, ok := t.(*dwarf.StructType)
+			if !ok {
+				continue
+			}
+			base_st, ok := stripDwarfType(base_t).(*dwarf.StructType)
+			if !ok {
+				continue
+			}
+			base := dwarfBase{st: base_st}
+			location, ok := dwarfMemberLocation(entry)
+			virtuality, _ := entry.Val(dwarf.AttrVirtuality).(int64)
+			base.offset = location
+			base.virtual = !ok || virtuality != 0
+			bases[st] = append(bases[st], base)
+		}
+		if entry.Children {
+			parents = append(parents, entry)
+		}
+	}
+	dwarf_bases_cache[path] = bases
+	return bases, nil
+}
+
+func stripDwarfType(t dwarf.Type) dwarf.Type {
+	// 去掉 typedef 和 const/volatile 修饰
+	for {
+		switch v := t.(type) {
+		case *dwarf.TypedefType:
+			t = v.Type
+		case *dwarf.QualType:
+			t = v.Type
+		default:
+			return t
+		}
+	}
+}
+
+func qualifyDwarfName(scopes []string, name string) string {
+	// 匿名的命名空间和非类型的作用域不计入名称
+	var items []string
+	for _, scope := range scopes {
+		if scope != "" {
+			items = append(items, scope)
+		}
+	}
+	return strings.Join(append(items, name), "::")
+}
+
+func findDwarfStruct(data *dwarf.Data, name string) (*dwarf.StructType, error) {
+	// struct xxx / class xxx / union xxx / xxx
+	tags := []dwarf.Tag{dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType, dwarf.TagTypedef}
+	items := strings.SplitN(name, " ", 2)
+	if len(items) == 2 {
+		switch items[0] {
+		case "struct":
+			tags = []dwarf.Tag{dwarf.TagStructType}
+		case "class":
+			tags = []dwarf.Tag{dwarf.TagClassType}
+		case "union":
+			tags = []dwarf.Tag{dwarf.TagUnionType}
+		}
+		name = strings.TrimSpace(items[1])
+	}
+	// 按带命名空间的完整名称匹配 没有写命名空间且全局作用域中没有时 按最后一级查找 但必须唯一
+	qualified_name := strings.Contains(name, "::")
+	var candidate *dwarf.StructType
+	var candidate_names []string
+	var scopes []string
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			// 子节点结束
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		}
+		entry_name, _ := entry.Val(dwarf.AttrName).(string)
+		full_name := qualifyDwarfName(scopes, entry_name)
+		if entry.Children {
+			scope := ""
+			switch entry.Tag {
+			case dwarf.TagNamespace, dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType:
+				scope = entry_name
+			}
+			scopes = append(scopes, scope)
+		}
+		if entry_name == "" || !slices.Contains(tags, entry.Tag) {
+			continue
+		}
+		if full_name != name && (qualified_name || entry_name != name) {
+			continue
+		}
+		// 跳过前置声明
+		if declaration, _ := entry.Val(dwarf.AttrDeclaration).(bool); declaration {
+			continue
+		}
+		t, err := data.Type(entry.Offset)
+		if err != nil {
+			return nil, err
+		}
+		st, ok := stripDwarfType(t).(*dwarf.StructType)
+		if !ok || st.Incomplete {
+			continue
+		}
+		if full_name == name {
+			return st, nil
+		}
+		if !slices.Contains(candidate_names, full_name) {
+			candidate = st
+			candidate_names = append(candidate_names, full_name)
+		}
+	}
+	if len(candidate_names) == 1 {
+		return candidate, nil
+	}
+	if len(candidate_names) > 1 {
+		return nil, errors.New(fmt.Sprintf("type %s is ambiguous in dwarf, plz use the full name, candidates: %s", name, strings.Join(candidate_names, ", ")))
+	}
+	return nil, errors.New(fmt.Sprintf("can not find complete type %s in dwarf", name))
+}
+
+func dwarfIntName(size int64, signed bool) string {
+	prefix := "uint"
+	if signed {
+		prefix = "int"
+	}
+	switch size {
+	case 1, 2, 4, 8:
+		return fmt.Sprintf("%s%d", prefix, size*8)
+	default:
+		return ""
+	}
+}
+
+func isDwarfStdString(st *dwarf.StructType) bool {
+	// libc++ 的 std::string 即 basic_string<char, ...>
+	return strings.HasPrefix(st.StructName, "basic_string<char,") && st.ByteSize == int64(argtype.PTR_SIZE*3)
+}
+
+type dwarfBitGroup struct {
+	names []string
+	start int64
+	end   int64
+}
+
+// 位域在结构体中的位置 以位计 [start, end)
+func dwarfBitRange(field *dwarf.StructField) (int64, int64) {
+	if field.ByteSize != 0 {
+		// DWARF 2/3 的写法 BitOffset 为从存储单元最高位开始的偏移 这里按小端换算
+		start := field.ByteOffset*8 + field.ByteSize*8 - field.BitOffset - field.BitSize
+		return start, start + field.BitSize
+	}
+	// DWARF 4 的写法 DataBitOffset 为相对结构体起始的偏移
+	start := field.ByteOffset*8 + field.DataBitOffset
+	return start, start + field.BitSize
+}
+
+func (this *dwarfBitGroup) toField() FieldConfig {
+	byte_start := this.start / 8
+	byte_size := (this.end+7)/8 - byte_start
+	config := FieldConfig{}
+	config.Name = strings.Join(this.names, "|")
+	config.Offset = fmt.Sprintf("%d", byte_start)
+	config.Type = dwarfIntName(byte_size, false)
+	config.Format = "hex"
+	if config.Type == "" {
+		config.Type = "buf"
+		config.Count = fmt.Sprintf("%d", byte_size)
+		config.Format = ""
+	}
+	return config
+}
+
+type DwarfTypeBuilder struct {
+	root     string
+	maxDepth uint32
+	names    map[*dwarf.StructType][]string
+	bases    map[*dwarf.StructType][]dwarfBase
+	configs  []TypeConfig
+	err      error
+}
+
+func (this *DwarfTypeBuilder) buildStruct(st *dwarf.StructType, level uint32) string {
+	// 同一个结构体在不同层级展开的深度不同 所以按层级分别生成
+	if names, ok := this.names[st]; ok && uint32(len(names)) > level && names[level] != "" {
+		return names[level]
+	}
+	name := this.root
+	if len(this.configs) > 0 {
+		name = fmt.Sprintf("%s#%d", this.root, len(this.configs))
+	}
+	for uint32(len(this.names[st])) <= level {
+		this.names[st] = append(this.names[st], "")
+	}
+	this.names[st][level] = name
+	index := len(this.configs)
+	this.configs = append(this.configs, TypeConfig{})
+
+	type_config := TypeConfig{}
+	type_config.Name = name
+	type_config.Size = fmt.Sprintf("%d", st.ByteSize)
+	this.addFields(&type_config, st, 0, level)
+	if len(type_config.Fields) == 0 {
+		type_config.Fields = append(type_config.Fields, FieldConfig{Name: "data", Type: "buf", Offset: "0", Count: type_config.Size})
+	}
+	this.configs[index] = type_config
+	return name
+}
+
+func (this *DwarfTypeBuilder) addFields(type_config *TypeConfig, st *dwarf.StructType, base_offset int64, level uint32) {
+	// 基类的成员先于派生类 按基类在对象中的偏移展开
+	for _, base := range this.bases[st] {
+		if base.virtual {
+			// 虚基类的位置要运行时通过虚表才能确定
+			if this.err == nil {
+				this.err = errors.New(fmt.Sprintf("type %s has virtual base %s, not supported", st.StructName, base.st.StructName))
+			}
+			continue
+		}
+		this.addFields(type_config, base.st, base_offset+base.offset, level)
+	}
+	// 位域没有办法单独读取 共用字节的位域合并为一个字段 按所在的字节整体以十六进制输出
+	var bits *dwarfBitGroup
+	for i, field := range st.Field {
+		if field.BitSize != 0 {
+			field_name := field.Name
+			if field_name == "" {
+				field_name = fmt.Sprintf("anon_%d", i)
+			}
+			bit_start, bit_end := dwarfBitRange(field)
+			bit_start += base_offset * 8
+			bit_end += base_offset * 8
+			if bits != nil && bit_start/8 < (bits.end+7)/8 {
+				bits.names = append(bits.names, field_name)
+				if bit_end > bits.end {
+					bits.end = bit_end
+				}
+				continue
+			}
+			if bits != nil {
+				type_config.Fields = append(type_config.Fields, bits.toField())
+			}
+			bits = &dwarfBitGroup{[]string{field_name}, bit_start, bit_end}
+			continue
+		}
+		if bits != nil {
+			type_config.Fields = append(type_config.Fields, bits.toField())
+			bits = nil
+		}
+		field_config, ok := this.buildField(field.Type, level)
+		if !ok {
+			continue
+		}
+		field_config.Name = field.Name
+		if field_config.Name == "" {
+			field_config.Name = fmt.Sprintf("anon_%d", i)
+		}
+		field_config.Offset = fmt.Sprintf("%d", base_offset+field.ByteOffset)
+		type_config.Fields = append(type_config.Fields, field_config)
+	}
+	if bits != nil {
+		type_config.Fields = append(type_config.Fields, bits.toField())
+	}
+}
+
+func (this *DwarfTypeBuilder) buildField(t dwarf.Type, level uint32) (FieldConfig, bool) {
+	config := FieldConfig{}
+	t = stripDwarfType(t)
+	switch v := t.(type) {
+	case *dwarf.CharType, *dwarf.UcharType:
+		if t.Size() == 1 {
+			config.Type = "char"
+		} else {
+			config.Type = dwarfIntName(t.Size(), false)
+		}
+	case *dwarf.IntType, *dwarf.EnumType:
+		config.Type = dwarfIntName(t.Size(), true)
+	case *dwarf.UintType, *dwarf.BoolType:
+		config.Type = dwarfIntName(t.Size(), false)
+	case *dwarf.FloatType:
+		config.Type = dwarfIntName(t.Size(), false)
+		config.Format = "hex"
+	case *dwarf.PtrType:
+		config.Type = "ptr"
+		elem := stripDwarfType(v.Type)
+		switch e := elem.(type) {
+		case *dwarf.CharType, *dwarf.UcharType:
+			if elem.Size() == 1 {
+				config.Type = "str"
+			}
+		case *dwarf.StructType:
+			if !e.Incomplete && e.ByteSize > 0 && level+1 <= this.maxDepth {
+				config.Type = "*" + this.buildStruct(e, level+1)
+			} else {
+				config.Format = "hex"
+			}
+		default:
+			config.Format = "hex"
+		}
+	case *dwarf.StructType:
+		if v.Incomplete || v.ByteSize <= 0 {
+			return config, false
+		}
+		if isDwarfStdString(v) {
+			config.Type = "std"
+		} else if level+1 <= this.maxDepth {
+			config.Type = this.buildStruct(v, level+1)
+		} else {
+			config.Type = "buf"
+			config.Count = fmt.Sprintf("%d", v.ByteSize)
+		}
+	case *dwarf.ArrayType:
+		// 柔性数组没有固定的元素个数 跳过
+		if v.Count <= 0 || v.Size() <= 0 {
+			return config, false
+		}
+		elem, ok := this.buildField(v.Type, level)
+		if !ok || elem.Count != "" || elem.Type == "std" || elem.Type == "buf" {
+			// 多维数组等情况 直接按字节输出
+			config.Type = "buf"
+			config.Count = fmt.Sprintf("%d", v.Size())
+			return config, true
+		}
+		config.Type = elem.Type
+		config.Format = elem.Format
+		if elem.Type == "str" || strings.HasPrefix(elem.Type, "*") {
+			config.Type = "ptr"
+			config.Format = "hex"
+		}
+		config.Count = fmt.Sprintf("%d", v.Count)
+	default:
+		if t.Size() <= 0 {
+			return config, false
+		}
+		config.Type = "buf"
+		config.Count = fmt.Sprintf("%d", t.Size())
+	}
+	if config.Type == "" {
+		// 不常见的大小
+		if t.Size() <= 0 {
+			return config, false
+		}
+		config.Type = "buf"
+		config.Count = fmt.Sprintf("%d", t.Size())
+		config.Format = ""
+	}
+	return config, true
+}
+
+// -w 中的 dwarf:ns::Foo:x1 以第一个单独的 : 分隔类型名与读取位置
+func SplitDwarfArg(arg_str string) (string, string) {
+	for i := 0; i < len(arg_str); i++ {
+		if arg_str[i] != ':' {
+			continue
+		}
+		if i+1 < len(arg_str) && arg_str[i+1] == ':' {
+			i += 1
+			continue
+		}
+		return arg_str[:i], arg_str[i+1:]
+	}
+	return arg_str, ""
+}
+
+func IsDwarfType(type_name string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(type_name, "*"), DWARF_TYPE_PREFIX)
+}
+
+func RegisterDwarfType(type_name, path string) error {
+	// 注册后的类型名即参数中的写法 重复使用时直接复用 但不能是来自其他文件的同名类型
+	type_name = strings.TrimPrefix(type_name, "*")
+	if argtype.FindArgTypeByName(type_name) != nil {
+		if loaded_path := dwarf_type_paths[type_name]; loaded_path != path {
+			return errors.New(fmt.Sprintf("%s already loaded from %s, can not load it again from %s", type_name, loaded_path, path))
+		}
+		return nil
+	}
+	if path == "" {
+		return errors.New(fmt.Sprintf("no library to load dwarf for %s", type_name))
+	}
+	data, err := loadDwarf(path)
+	if err != nil {
+		return err
+	}
+	st, err := findDwarfStruct(data, strings.TrimSpace(strings.TrimPrefix(type_name, DWARF_TYPE_PREFIX)))
+	if err != nil {
+		return err
+	}
+	bases, err := loadDwarfBases(path, data)
+	if err != nil {
+		return err
+	}
+	builder := &DwarfTypeBuilder{}
+	builder.root = type_name
+	builder.maxDepth = argtype.CustomMaxDepth
+	builder.names = make(map[*dwarf.StructType][]string)
+	builder.bases = bases
+	builder.buildStruct(st, 0)
+	if builder.err != nil {
+		return builder.err
+	}
+	if err := RegisterTypes(builder.configs); err != nil {
+		return err
+	}
+	dwarf_type_paths[type_name] = path
+	return nil
+}
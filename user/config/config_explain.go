@@ -0,0 +1,268 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"stackplz/user/argtype"
+	. "stackplz/user/common"
+	"strings"
+)
+
+// explain 子命令使用 不加载 eBPF 程序
+// 展示命令行或配置文件解析后的 hook 点、参数的 op 序列、过滤规则以及将要写入 map 的内容
+
+type ExplainOp struct {
+	Key  uint32 `json:"key"`
+	Info string `json:"info"`
+}
+
+type ExplainArg struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Reg       string      `json:"reg"`
+	PointType string      `json:"point_type"`
+	Filters   []uint32    `json:"filters"`
+	Ops       []ExplainOp `json:"ops"`
+}
+
+type ExplainPoint struct {
+	Kind     string       `json:"kind"`
+	Key      uint32       `json:"key"`
+	Name     string       `json:"name"`
+	Library  string       `json:"library,omitempty"`
+	RealPath string       `json:"real_path,omitempty"`
+	Offset   string       `json:"offset,omitempty"`
+	Symbol   string       `json:"symbol,omitempty"`
+	Thumb    bool         `json:"thumb,omitempty"`
+	EnterKey uint32       `json:"enter_key"`
+	Signal   uint32       `json:"signal"`
+	Caller   uint32       `json:"caller_mask"`
+	Limit    string       `json:"limit,omitempty"`
+	OpCount  uint32       `json:"op_count"`
+	Args     []ExplainArg `json:"args"`
+}
+
+type ExplainFilter struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Index  uint32 `json:"index"`
+	NumVal uint64 `json:"num_val"`
+	StrVal string `json:"str_val"`
+	StrLen uint32 `json:"str_len"`
+}
+
+type ExplainMapEntry struct {
+	Map   string `json:"map"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Explain struct {
+	Points  []ExplainPoint    `json:"points"`
+	Filters []ExplainFilter   `json:"filters"`
+	Maps    []ExplainMapEntry `json:"maps"`
+}
+
+func explainPointType(point_type uint32) string {
+	switch point_type {
+	case EBPF_SYS_ENTER:
+		return "sys_enter"
+	case EBPF_SYS_EXIT:
+		return "sys_exit"
+	case EBPF_SYS_ALL:
+		return "sys_all"
+	case EBPF_UPROBE_ENTER:
+		return "uprobe"
+	default:
+		return fmt.Sprintf("unknown(%d)", point_type)
+	}
+}
+
+func explainFilterType(filter_type uint32) string {
+	switch filter_type {
+	case EQUAL_FILTER:
+		return "equal"
+	case GREATER_FILTER:
+		return "greater"
+	case LESS_FILTER:
+		return "less"
+	case WHITELIST_FILTER:
+		return "whitelist"
+	case BLACKLIST_FILTER:
+		return "blacklist"
+	case REPLACE_FILTER:
+		return "replace"
+	default:
+		return "unknown"
+	}
+}
+
+func explainRegName(reg_index uint32) string {
+	if reg_index == REG_ARM64_MAX {
+		return "ret"
+	}
+	if name, ok := GetRegName(reg_index); ok {
+		return name
+	}
+	return fmt.Sprintf("reg%d", reg_index)
+}
+
+func explainOps(op_list []uint32) []ExplainOp {
+	ops := []ExplainOp{}
+	for _, op_key := range op_list {
+		ops = append(ops, ExplainOp{op_key, argtype.OPM.GetOpInfo(op_key)})
+	}
+	return ops
+}
+
+func explainArgs(point_args []*PointArg) []ExplainArg {
+	args := []ExplainArg{}
+	for _, point_arg := range point_args {
+		arg := ExplainArg{}
+		arg.Name = point_arg.Name
+		arg.Type = point_arg.GetTypeName()
+		arg.Reg = explainRegName(point_arg.RegIndex)
+		if len(point_arg.ExtraOpList) > 0 {
+			arg.Reg = "custom"
+		}
+		arg.PointType = explainPointType(point_arg.PointType)
+		arg.Filters = point_arg.FilterIndexList
+		arg.Ops = explainOps(point_arg.GetOpList())
+		args = append(args, arg)
+	}
+	return args
+}
+
+func (this *Explain) addMap(map_name, key, value string) {
+	this.Maps = append(this.Maps, ExplainMapEntry{map_name, key, value})
+}
+
+func (this *ModuleConfig) GetExplain() *Explain {
+	explain := &Explain{}
+	explain.Points = []ExplainPoint{}
+	explain.Filters = []ExplainFilter{}
+	explain.Maps = []ExplainMapEntry{}
+
+	// uprobe 的 hook 点
+	for _, uprobe_point := range this.StackUprobeConf.Points {
+		config := uprobe_point.GetConfig()
+		point := ExplainPoint{}
+		point.Kind = "uprobe"
+		point.Key = uprobe_point.Index
+		point.Name = uprobe_point.Name
+		point.Library = uprobe_point.GetPath()
+		point.RealPath = uprobe_point.RealFilePath
+		point.Offset = fmt.Sprintf("0x%x", uprobe_point.Offset)
+		point.Symbol = uprobe_point.Symbol
+		point.Thumb = uprobe_point.Thumb
+		point.EnterKey = config.EnterKey
+		point.Signal = config.Signal
+		point.Caller = config.CallerMask
+		point.Limit = config.PointLimit.String()
+		point.OpCount = config.OpCount
+		point.Args = explainArgs(uprobe_point.PointArgs)
+		explain.Points = append(explain.Points, point)
+	}
+
+	// syscall 的 hook 点 只展示实际追踪的
+	if this.SysCallConf.Enable {
+		for _, nr := range this.SysCallConf.SysWhitelist {
+			syscall_point := this.SysCallConf.GetSyscallPointByNR(nr)
+			enter_config := syscall_point.GetEnterConfig()
+			exit_config := syscall_point.GetExitConfig()
+			for _, point_type := range []uint32{EBPF_SYS_ENTER, EBPF_SYS_EXIT} {
+				config := enter_config
+				point_args := syscall_point.EnterPointArgs
+				if point_type == EBPF_SYS_EXIT {
+					config = exit_config
+					point_args = syscall_point.ExitPointArgs
+				}
+				point := ExplainPoint{}
+				point.Kind = explainPointType(point_type)
+				point.Key = syscall_point.Nr
+				point.Name = syscall_point.Name
+				point.EnterKey = config.EnterKey
+				point.Signal = config.Signal
+				point.Caller = config.CallerMask
+				point.Limit = config.PointLimit.String()
+				point.OpCount = config.OpCount
+				point.Args = explainArgs(point_args)
+				explain.Points = append(explain.Points, point)
+			}
+		}
+	}
+
+	// 参数过滤规则 即 arg_filter 中的内容
+	for _, filter := range GetFilters() {
+		value := filter.ToEbpfValue()
+		item := ExplainFilter{}
+		item.Name = fmt.Sprintf("f%d", filter.Filter_index-1)
+		item.Type = explainFilterType(filter.Filter_type)
+		item.Index = filter.Filter_index
+		item.NumVal = value.Num_val
+		item.StrLen = value.Str_len
+		if value.Str_len > 0 && value.Str_len <= uint32(len(value.Str_val)) {
+			item.StrVal = hex.EncodeToString(value.Str_val[:value.Str_len])
+		}
+		explain.Filters = append(explain.Filters, item)
+	}
+
+	// 与模块启动时写入 map 的内容一致
+	entries := this.GetFilterMapEntries()
+	entries = append(entries, this.GetArgMapEntries()...)
+	entries = append(entries, this.GetStackMapEntries()...)
+	if this.SysCallConf.Enable {
+		entries = append(entries, this.GetSyscallMapEntries()...)
+	}
+	for _, entry := range entries {
+		explain.addMap(entry.Map, entry.KeyInfo, entry.ValueInfo)
+	}
+	return explain
+}
+
+func (this *Explain) Json() string {
+	data, err := json.MarshalIndent(this, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (this *Explain) String() string {
+	var lines []string
+	for _, point := range this.Points {
+		head := fmt.Sprintf("[%s] %s key:%d", point.Kind, point.Name, point.Key)
+		if point.Kind == "uprobe" {
+			head += fmt.Sprintf(" lib:%s offset:%s", point.Library, point.Offset)
+			if point.Symbol != "" {
+				head += " sym:" + point.Symbol
+			}
+			if point.Thumb {
+				head += " thumb"
+			}
+		}
+		head += fmt.Sprintf(" enter_key:%d signal:%d caller_mask:0x%x op_count:%d", point.EnterKey, point.Signal, point.Caller, point.OpCount)
+		if point.Limit != "" {
+			head += " limit:" + point.Limit
+		}
+		lines = append(lines, head)
+		for _, arg := range point.Args {
+			lines = append(lines, fmt.Sprintf("    arg %s type:%s reg:%s point_type:%s filters:%v", arg.Name, arg.Type, arg.Reg, arg.PointType, arg.Filters))
+			for _, op := range arg.Ops {
+				lines = append(lines, fmt.Sprintf("        op_key:%3d %s", op.Key, op.Info))
+			}
+		}
+	}
+	if len(this.Filters) > 0 {
+		lines = append(lines, "filters:")
+		for _, filter := range this.Filters {
+			lines = append(lines, fmt.Sprintf("    %s index:%d type:%s num_val:0x%x str_len:%d str_val:%s", filter.Name, filter.Index, filter.Type, filter.NumVal, filter.StrLen, filter.StrVal))
+		}
+	}
+	lines = append(lines, "maps:")
+	for _, entry := range this.Maps {
+		lines = append(lines, fmt.Sprintf("    %s[%s] = %s", entry.Map, entry.Key, entry.Value))
+	}
+	return strings.Join(lines, "\n")
+}
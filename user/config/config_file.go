@@ -17,11 +17,18 @@ type ParamConfig struct {
 	Filter []string `json:"filter"`
 	Reg    string   `json:"reg"`
 	ReadOp string   `json:"read_op"`
+	Next   string   `json:"next"`
+	Max    uint32   `json:"max"`
+	Count  string   `json:"count"`
+	MaxLen uint32   `json:"max_len"`
+	Offset string   `json:"offset"`
 }
 
 type PointConfig struct {
-	Name   string        `json:"name"`
-	Signal string        `json:"signal"`
+	Name   string   `json:"name"`
+	Signal string   `json:"signal"`
+	Caller []string `json:"caller"`
+	PointLimit
 	Params []ParamConfig `json:"params"`
 }
 
@@ -35,13 +42,58 @@ type IFileConfig interface {
 }
 
 type FileConfig struct {
-	Type string `json:"type"`
+	Type  string       `json:"type"`
+	Types []TypeConfig `json:"types"`
 }
 
 func (this *FileConfig) GetType() string {
 	return this.Type
 }
 
+func (this *ParamConfig) GetElemType() string {
+	// list:struct foo / array:pollfd 取元素的类型名 其他情况原样返回
+	type_name := strings.TrimPrefix(this.Type, "*")
+	for _, prefix := range []string{"list:", "array:"} {
+		if strings.HasPrefix(type_name, prefix) {
+			elem_name := strings.TrimSpace(strings.TrimPrefix(type_name, prefix))
+			return strings.TrimSpace(strings.TrimPrefix(elem_name, "struct "))
+		}
+	}
+	return this.Type
+}
+
+func (this *ParamConfig) GetTraverseType() argtype.IArgType {
+	// 链表通过 next 指定下一个节点指针在结构体中的偏移 max 为最多读取的节点数
+	// 数组通过 count 指定元素个数 可以是数字或者寄存器 为寄存器时可以通过 max 限制读取个数
+	// 受限于 eBPF 的循环次数 两者都最多读取 MAX_LOOP_COUNT 个元素 超出时按截断输出
+	type_name := strings.TrimPrefix(this.Type, "*")
+	is_list := strings.HasPrefix(type_name, "list:")
+	if !is_list && !strings.HasPrefix(type_name, "array:") {
+		return nil
+	}
+	elem := argtype.GetArgTypeByName(this.GetElemType())
+	if is_list {
+		var next_offset uint64 = 0
+		if this.Next != "" {
+			offset, err := strconv.ParseUint(strings.TrimPrefix(this.Next, "+"), 0, 64)
+			if err != nil {
+				panic(fmt.Sprintf("parse next %s for %s failed", this.Next, this.Type))
+			}
+			next_offset = offset
+		}
+		return argtype.R_STRUCT_LIST(elem, next_offset, this.Max)
+	}
+	if this.Count == "" {
+		panic(fmt.Sprintf("count is required for %s", this.Type))
+	}
+	count, err := strconv.ParseUint(this.Count, 0, 32)
+	if err != nil {
+		// 以寄存器的值作为元素个数
+		return argtype.R_STRUCT_ARRAY_REG(elem, GetRegIndex(this.Count), this.Max)
+	}
+	return argtype.R_STRUCT_ARRAY(elem, uint32(count))
+}
+
 func (this *ParamConfig) GetPointArg(arg_index, point_type uint32) *PointArg {
 	// 参数名省略时 以 a{index} 这样的形式作为名字
 	arg_name := fmt.Sprintf("a%d", arg_index)
@@ -76,20 +128,79 @@ func (this *ParamConfig) GetPointArg(arg_index, point_type uint32) *PointArg {
 	switch type_name {
 	case "buf":
 		// buf 类型需要给定读取的大小 但是这个大小有可能是通过寄存器指定
-		at := argtype.R_BUFFER_LEN(256)
-		if this.Size != "" {
+		// 指定了 max_len 时以其作为读取上限 超出单次读取上限的部分分段读取
+		var at argtype.IArgType
+		if this.Size == "ret" {
+			// 以返回值作为读取大小 返回值为负数时不读取
+			// uprobe 的 hook 点需要位于返回处 由 Parse_FileConfig 检查
+			if point_type == EBPF_SYS_ENTER {
+				panic(fmt.Sprintf("size ret of %s is only for syscall exit, set more to exit", arg_name))
+			}
+			if this.MaxLen > 0 {
+				at = argtype.R_BUFFER_RET_MAX(this.MaxLen)
+			} else {
+				at = argtype.R_BUFFER_RET()
+			}
+		} else if this.Size != "" {
 			size, err := strconv.ParseUint(this.Size, 0, 32)
 			if err == nil {
 				// 以指定长度作为读取大小
-				at = argtype.R_BUFFER_LEN(uint32(size))
+				if this.MaxLen > 0 {
+					at = argtype.R_BUFFER_LEN_MAX(uint32(size), this.MaxLen)
+				} else {
+					at = argtype.R_BUFFER_LEN(uint32(size))
+				}
 			} else {
 				// 以寄存器的值作为读取大小
-				at = argtype.R_BUFFER_REG(GetRegIndex(this.Size))
+				if this.MaxLen > 0 {
+					at = argtype.R_BUFFER_REG_MAX(GetRegIndex(this.Size), this.MaxLen)
+				} else {
+					at = argtype.R_BUFFER_REG(GetRegIndex(this.Size))
+				}
 			}
+		} else if this.MaxLen > 0 {
+			at = argtype.R_BUFFER_LEN_MAX(this.MaxLen, this.MaxLen)
+		} else {
+			at = argtype.R_BUFFER_LEN(256)
 		}
 		point_arg.SetTypeIndex(at.GetTypeIndex())
 		// 这个设定用于指示是否进一步读取和解析
 		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+	case "u16str":
+		// 以字符个数计 默认最多读取 256 个字符
+		max_chars := uint32(256)
+		if this.MaxLen > 0 {
+			max_chars = this.MaxLen
+		}
+		at := argtype.R_UTF16_STRING(max_chars)
+		point_arg.SetTypeIndex(at.GetTypeIndex())
+		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+	case "u16buf":
+		// 与 buf 一样 但大小以字符个数计
+		at := argtype.R_UTF16_BUFFER_LEN(256)
+		if this.Size != "" {
+			size, err := strconv.ParseUint(this.Size, 0, 32)
+			if err == nil {
+				at = argtype.R_UTF16_BUFFER_LEN(uint32(size))
+			} else {
+				at = argtype.R_UTF16_BUFFER_REG(GetRegIndex(this.Size))
+			}
+		}
+		point_arg.SetTypeIndex(at.GetTypeIndex())
+		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+	case "art_string":
+		// mirror::String 的 count 字段偏移 默认为 8 即紧跟在对象头之后
+		count_offset := uint64(8)
+		if this.Offset != "" {
+			offset, err := strconv.ParseUint(this.Offset, 0, 32)
+			if err != nil {
+				panic(fmt.Sprintf("parse art_string offset %s failed", this.Offset))
+			}
+			count_offset = offset
+		}
+		at := argtype.R_ART_STRING(count_offset)
+		point_arg.SetTypeIndex(at.GetTypeIndex())
+		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
 	case "iovec":
 		at := argtype.R_IOVEC_REG(this.Size)
 		point_arg.SetTypeIndex(at.GetTypeIndex())
@@ -113,13 +224,32 @@ func (this *ParamConfig) GetPointArg(arg_index, point_type uint32) *PointArg {
 	case "str", "std":
 		// 根据名称指定类型
 		// 支持自定义类型 但是需要提前在配置文件中写好
-		point_arg.SetTypeByName(type_name)
+		if this.MaxLen > 0 {
+			// 读取更长的字符串 超出部分截断
+			if type_name == "str" {
+				point_arg.SetTypeIndex(argtype.R_STRING_MAX(this.MaxLen).GetTypeIndex())
+			} else {
+				point_arg.SetTypeIndex(argtype.R_STD_STRING_MAX(this.MaxLen).GetTypeIndex())
+			}
+		} else {
+			point_arg.SetTypeByName(type_name)
+		}
 		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
 	case "int", "uint", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64":
 		point_arg.SetTypeByName(type_name)
 	default:
-		// 没有列举出来的 case 认为是内置的结构体
-		point_arg.SetTypeByName(type_name)
+		if at := this.GetTraverseType(); at != nil {
+			// list:xxx array:xxx 即结构体链表或者结构体数组
+			point_arg.SetTypeIndex(at.GetTypeIndex())
+		} else {
+			// 没有列举出来的 case 认为是内置的结构体 或者是 types 中声明的结构体
+			point_arg.SetTypeByName(type_name)
+		}
+		point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+	}
+
+	if this.MaxLen > 0 && type_name != "buf" && type_name != "str" && type_name != "std" && type_name != "u16str" {
+		panic(fmt.Sprintf("max_len of %s is only for str/std/buf/u16str", arg_name))
 	}
 
 	// 有一层指针的情形 配置中在类型最前面加*即可 不需要额外定义
@@ -21,6 +21,7 @@ type CommonFilter struct {
 	trace_uid_group uint32
 	signal          uint32
 	tsignal         uint32
+	trace_user      uint32
 }
 
 type ThreadFilter struct {
@@ -7,7 +7,9 @@ import (
     "io"
     "os"
     "path/filepath"
+    "runtime"
     "stackplz/assets"
+    "stackplz/user/util"
     "strings"
 
     "golang.org/x/exp/slices"
@@ -48,6 +50,31 @@ type GlobalConfig struct {
     BrkAddr     string
     BrkLib      string
     BrkLen      uint64
+    BrkArgs     string
+    FlightRecorder uint32
+    FRSysCall      string
+    FRPoint        []string
+    FRSignal       string
+    Crash          bool
+    CrashDir       string
+    Summary        bool
+    SummaryBy      string
+    SummaryInterval uint32
+    FlameGraph     string
+    Caller         string
+    StackMatch     []string
+    MaxEvents      uint64
+    Duration       string
+    ExitWithTarget bool
+    AmStart        string
+    NoFollowExec   bool
+    ProcTree       bool
+    User           string
+    PackagesList   string
+    Comm           string
+    Exe            string
+    NoPreload      bool
+    ProcTreeInterval uint32
     LogFile     string
     DumpFile    string
     ParseFile   string
@@ -67,6 +94,8 @@ type GlobalConfig struct {
     SysCall     string
     NoSysCall   string
     ConfigFiles []string
+    DebugFile   string
+    StructDepth uint32
 }
 
 func NewGlobalConfig() *GlobalConfig {
@@ -74,6 +103,11 @@ func NewGlobalConfig() *GlobalConfig {
 }
 
 func (this *GlobalConfig) RestoreAssets() error {
+    // 预置的栈回溯库只有安卓 arm64 版本
+    if runtime.GOARCH != "arm64" || !util.IsAndroid() {
+        this.NoPreload = true
+        return nil
+    }
     lib_path := "preload_libs/libstackplz.so"
     if this.SdkInt == 0 {
         this.SdkInt = 29
@@ -106,11 +140,14 @@ func (this *GlobalConfig) FindLibInApk(library string, sconfig *StackUprobeConfi
     // 在常规的情况下都没找到 尝试在 apk 文件中搜索 split apk 安装后的名字都是 split_config 开头
     // - base.apk!/lib/arm64-v8a/
     // - split_config.arm64_v8a.apk!lib/arm64-v8a/
-    // 目前不管 armeabi-v7a
+    // 32 位进程则是 armeabi-v7a
     // - base.apk!/lib/armeabi-v7a/
     // - split_config.armeabi_v7a.apk!lib/armeabi-v7a/
 
     lib_search_paths := []string{"lib/arm64-v8a"}
+    if this.Is32Bit() {
+        lib_search_paths = []string{"lib/armeabi-v7a"}
+    }
     for _, apk_path := range this.LibraryDirs {
         // 确保只检查 .apk
         if !strings.HasSuffix(apk_path, ".apk") {
@@ -0,0 +1,25 @@
+//go:build amd64 && !forarm
+// +build amd64,!forarm
+
+package config
+
+func (this *GlobalConfig) Is32Bit() bool {
+	return false
+}
+
+func (this *GlobalConfig) GetSyscallConfigFile() string {
+	return "user/config/config_syscall_x86_64.json"
+}
+
+func (this *GlobalConfig) InitLibraryDirs() {
+	// 常见发行版的系统库路径
+	lib_search_path := []string{
+		"/lib/x86_64-linux-gnu",
+		"/usr/lib/x86_64-linux-gnu",
+		"/lib64",
+		"/usr/lib64",
+		"/usr/lib",
+		"/lib",
+	}
+	this.LibraryDirs = append(this.LibraryDirs, lib_search_path...)
+}
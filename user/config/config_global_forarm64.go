@@ -1,5 +1,5 @@
-//go:build !forarm
-// +build !forarm
+//go:build !forarm && !amd64
+// +build !forarm,!amd64
 
 package config
 
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 单个 hook 点的输出限制 在 ebpf 中通过 point_counter 计数
+// 与 ebpf 中 point_args_t 的对应字段顺序一致
+type PointLimit struct {
+	MaxHits      uint32 `json:"max_hits"`
+	SkipFirst    uint32 `json:"skip_first"`
+	EveryNth     uint32 `json:"every_nth"`
+	MaxPerSecond uint32 `json:"max_per_second"`
+}
+
+func (this *PointLimit) IsEnable() bool {
+	return this.MaxHits > 0 || this.SkipFirst > 0 || this.EveryNth > 1 || this.MaxPerSecond > 0
+}
+
+func (this *PointLimit) String() string {
+	var items []string
+	if this.SkipFirst > 0 {
+		items = append(items, fmt.Sprintf("skip_first=%d", this.SkipFirst))
+	}
+	if this.EveryNth > 1 {
+		items = append(items, fmt.Sprintf("every_nth=%d", this.EveryNth))
+	}
+	if this.MaxHits > 0 {
+		items = append(items, fmt.Sprintf("max_hits=%d", this.MaxHits))
+	}
+	if this.MaxPerSecond > 0 {
+		items = append(items, fmt.Sprintf("max_per_second=%d", this.MaxPerSecond))
+	}
+	return strings.Join(items, ",")
+}
+
+// max_hits=100,skip_first=10,every_nth=5,max_per_second=50
+func (this *PointLimit) Parse(limit_str string) error {
+	for _, item := range strings.Split(limit_str, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return errors.New(fmt.Sprintf("parse limit %s failed, format like max_hits=100", item))
+		}
+		value, err := strconv.ParseUint(kv[1], 0, 32)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse limit %s failed, err:%v", item, err))
+		}
+		switch kv[0] {
+		case "max_hits":
+			this.MaxHits = uint32(value)
+		case "skip_first":
+			this.SkipFirst = uint32(value)
+		case "every_nth":
+			this.EveryNth = uint32(value)
+		case "max_per_second":
+			this.MaxPerSecond = uint32(value)
+		default:
+			return errors.New(fmt.Sprintf("unknown limit %s, choose:max_hits,skip_first,every_nth,max_per_second", kv[0]))
+		}
+	}
+	return nil
+}
+
+// 与 ebpf 中的 point_counter_t 对应
+type PointCounter struct {
+	Hits        uint64
+	Output      uint64
+	Dropped     uint64
+	WindowStart uint64
+	WindowCount uint64
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"stackplz/user/argtype"
+	"stackplz/user/util"
+	"strings"
+	"unsafe"
+)
+
+// 启动时写入 eBPF map 的内容 模块的 update_* 按此写入 explain 按此展示 两者不会出现偏差
+// Key Value 指向与 eBPF 中布局一致的数据 KeyInfo ValueInfo 为 explain 展示用的文本
+
+const (
+	THREAD_NAME_WHITELIST uint32 = 1
+	THREAD_NAME_BLACKLIST uint32 = 2
+)
+
+type MapEntry struct {
+	Map       string
+	Key       unsafe.Pointer
+	Value     unsafe.Pointer
+	KeyInfo   string
+	ValueInfo string
+}
+
+type MapEntries []MapEntry
+
+func (this *MapEntries) add(map_name string, key, value unsafe.Pointer, key_info, value_info string) {
+	*this = append(*this, MapEntry{map_name, key, value, key_info, value_info})
+}
+
+func (this *MapEntries) addCommonList(items []uint32, offset uint32) {
+	for _, v := range items {
+		key := v + offset
+		this.add("common_list", unsafe.Pointer(&key), unsafe.Pointer(&key), fmt.Sprintf("%d", key), fmt.Sprintf("%s+%d", util.START_OFFSETS[offset], v))
+	}
+}
+
+func (this *MapEntries) addThreadFilter(name string, flag uint32) {
+	if len(name) > 16 {
+		panic(fmt.Sprintf("[%s] thread name max len is 16", name))
+	}
+	key := ThreadFilter{}
+	copy(key.ThreadName[:], name)
+	value := flag
+	value_info := "whitelist"
+	if flag == THREAD_NAME_BLACKLIST {
+		value_info = "blacklist"
+	}
+	this.add("thread_filter", unsafe.Pointer(&key), unsafe.Pointer(&value), name, value_info)
+}
+
+func opKeysInfo(op_count uint32, op_list []uint32) string {
+	var items []string
+	for _, op_key := range op_list[:op_count] {
+		items = append(items, fmt.Sprintf("%d", op_key))
+	}
+	return fmt.Sprintf("op_count=%d op_keys=[%s]", op_count, strings.Join(items, ","))
+}
+
+// 进程和线程过滤相关的 map 各模块都会写入
+func (this *ModuleConfig) GetFilterMapEntries() MapEntries {
+	entries := MapEntries{}
+
+	var zero_key uint32 = 0
+	config_map := this.GetConfigMap()
+	entries.add("base_config", unsafe.Pointer(&zero_key), unsafe.Pointer(&config_map), "0", fmt.Sprintf("stackplz_pid=%d thread_whitelist=%d", config_map.stackplz_pid, config_map.thread_whitelist))
+	common_filter := this.GetCommonFilter()
+	entries.add("common_filter", unsafe.Pointer(&zero_key), unsafe.Pointer(&common_filter), "0", fmt.Sprintf("is_32bit=%d trace_mode=%d trace_uid_group=0x%x signal=%d tsignal=%d trace_user=%d", common_filter.is_32bit, common_filter.trace_mode, common_filter.trace_uid_group, common_filter.signal, common_filter.tsignal, common_filter.trace_user))
+
+	entries.addCommonList(this.UidWhitelist, util.UID_WHITELIST_START)
+	entries.addCommonList(this.UidBlacklist, util.UID_BLACKLIST_START)
+	entries.addCommonList(this.PidWhitelist, util.PID_WHITELIST_START)
+	entries.addCommonList(this.PidBlacklist, util.PID_BLACKLIST_START)
+	entries.addCommonList(this.TidWhitelist, util.TID_WHITELIST_START)
+	entries.addCommonList(this.TidBlacklist, util.TID_BLACKLIST_START)
+
+	// 这个可以合并到 common_list 后面改进
+	for _, v := range this.PidWhitelist {
+		pid := v
+		entries.add("child_parent_map", unsafe.Pointer(&pid), unsafe.Pointer(&pid), fmt.Sprintf("%d", pid), fmt.Sprintf("%d", pid))
+	}
+
+	// 带通配符的线程名由 ThreadNameMatcher 在运行时匹配
+	for _, v := range this.DefaultThreadBlacklist() {
+		entries.addThreadFilter(v, THREAD_NAME_BLACKLIST)
+	}
+	for _, v := range this.TNameBlacklist {
+		if !IsThreadNameGlob(v) {
+			entries.addThreadFilter(v, THREAD_NAME_BLACKLIST)
+		}
+	}
+	for _, v := range this.TNameWhitelist {
+		if !IsThreadNameGlob(v) {
+			entries.addThreadFilter(v, THREAD_NAME_WHITELIST)
+		}
+	}
+	return entries
+}
+
+// 参数读取和过滤相关的 map 只有 stack 和 syscall 模块需要
+func (this *ModuleConfig) GetArgMapEntries() MapEntries {
+	entries := MapEntries{}
+	for _, filter := range GetFilters() {
+		key := uint64(filter.Filter_index)
+		value := filter.ToEbpfValue()
+		str_val := ""
+		if value.Str_len > 0 && value.Str_len <= uint32(len(value.Str_val)) {
+			str_val = hex.EncodeToString(value.Str_val[:value.Str_len])
+		}
+		entries.add("arg_filter", unsafe.Pointer(&key), unsafe.Pointer(&value), fmt.Sprintf("%d", key), fmt.Sprintf("type=%d str_len=%d str_val=%s num_val=0x%x", value.Filter_type, value.Str_len, str_val, value.Num_val))
+	}
+
+	op_list := argtype.GetALLOpList()
+	var op_keys []uint32
+	for op_key := range op_list {
+		op_keys = append(op_keys, op_key)
+	}
+	sort.Slice(op_keys, func(i, j int) bool {
+		return op_keys[i] < op_keys[j]
+	})
+	for _, op_key := range op_keys {
+		key := op_key
+		op := op_list[op_key]
+		entries.add("op_list", unsafe.Pointer(&key), unsafe.Pointer(&op), fmt.Sprintf("%d", key), fmt.Sprintf("code=%d pre_code=%d post_code=%d value=%d (%s)", op.Code, op.PreCode, op.PostCode, op.Value, argtype.OPM.GetOpInfo(op_key)))
+	}
+	return entries
+}
+
+// stack 模块 uprobe hook 点的参数配置
+func (this *ModuleConfig) GetStackMapEntries() MapEntries {
+	entries := MapEntries{}
+	if !this.StackUprobeConf.IsEnable() {
+		return entries
+	}
+	for _, uprobe_point := range this.StackUprobeConf.Points {
+		key := uprobe_point.Index
+		value := uprobe_point.GetConfig()
+		entries.add("uprobe_point_args", unsafe.Pointer(&key), unsafe.Pointer(&value), fmt.Sprintf("%d", key), opKeysInfo(value.OpCount, value.OpKeyList[:]))
+	}
+	return entries
+}
+
+// syscall 模块 系统调用号的过滤以及每个系统调用进入和返回时的参数配置
+func (this *ModuleConfig) GetSyscallMapEntries() MapEntries {
+	entries := MapEntries{}
+	entries.addCommonList(this.SysCallConf.SysWhitelist, util.SYS_WHITELIST_START)
+	entries.addCommonList(this.SysCallConf.SysBlacklist, util.SYS_BLACKLIST_START)
+	for _, syscall_point := range this.SysCallConf.PointArgs {
+		key := syscall_point.Nr
+		value := syscall_point.GetEnterConfig()
+		entries.add("sysenter_point_args", unsafe.Pointer(&key), unsafe.Pointer(&value), fmt.Sprintf("%d", key), opKeysInfo(value.OpCount, value.OpKeyList[:]))
+	}
+	for _, syscall_point := range this.SysCallConf.PointArgs {
+		key := syscall_point.Nr
+		value := syscall_point.GetExitConfig()
+		entries.add("sysexit_point_args", unsafe.Pointer(&key), unsafe.Pointer(&value), fmt.Sprintf("%d", key), opKeysInfo(value.OpCount, value.OpKeyList[:]))
+	}
+	return entries
+}
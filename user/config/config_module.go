@@ -8,6 +8,7 @@ import (
     "io/ioutil"
     "log"
     "os"
+    "path/filepath"
     "regexp"
     "stackplz/user/argtype"
     . "stackplz/user/common"
@@ -28,6 +29,15 @@ type StackUprobeConfig struct {
     Points       []*UprobeArgs
     DumpHex      bool
     Color        bool
+    DebugFile    string
+}
+
+func (this *StackUprobeConfig) GetDebugFile() string {
+    // 没有单独指定调试文件时 从目标库中读取 DWARF 信息
+    if this.DebugFile != "" {
+        return this.DebugFile
+    }
+    return this.LibPath
 }
 
 func ParseStrAsNum(v string) (uint64, error) {
@@ -115,6 +125,46 @@ func (this *StackUprobeConfig) ParseArgType(arg_str string, point_arg *PointArg)
         point_arg.SetGroupType(EBPF_UPROBE_ENTER)
     case "ptr":
         point_arg.SetTypeIndex(POINTER)
+    case "u16str":
+        // UTF-16LE 字符串 命令行默认最多读取 256 个字符
+        point_arg.SetTypeIndex(argtype.R_UTF16_STRING(256).GetTypeIndex())
+        point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+    case "art_string":
+        // java.lang.String 即 mirror::String* 命令行使用默认的 count 偏移
+        point_arg.SetTypeIndex(argtype.R_ART_STRING(8).GetTypeIndex())
+        point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+    case "u16buf":
+        // 与 buf 一样 大小以字符个数计
+        // 0x89ab[u16buf:x1] 命中hook点时读取 x0 处x1寄存器个数的 UTF-16 字符
+        at := argtype.R_UTF16_BUFFER_LEN(256)
+        u16_items := strings.SplitN(read_op_str, ":", 2)
+        size_str := u16_items[0]
+        if len(u16_items) == 2 {
+            read_op_str = u16_items[1]
+        } else {
+            read_op_str = ""
+        }
+        if size_str != "" {
+            size, err := strconv.ParseUint(size_str, 0, 32)
+            if err == nil {
+                at = argtype.R_UTF16_BUFFER_LEN(uint32(size))
+            } else {
+                at = argtype.R_UTF16_BUFFER_REG(GetRegIndex(size_str))
+            }
+        }
+        point_arg.SetTypeIndex(at.GetTypeIndex())
+        point_arg.SetGroupType(EBPF_UPROBE_ENTER)
+    case "dwarf":
+        // dwarf:session_ctx:x1 即按 DWARF 中 session_ctx 的定义读取 x1 指向的结构体
+        dwarf_name, dwarf_read_op := SplitDwarfArg(read_op_str)
+        dwarf_type := DWARF_TYPE_PREFIX + dwarf_name
+        read_op_str = dwarf_read_op
+        err = RegisterDwarfType(dwarf_type, this.GetDebugFile())
+        if err != nil {
+            return err
+        }
+        point_arg.SetTypeByName(dwarf_type)
+        point_arg.SetGroupType(EBPF_UPROBE_ENTER)
     case "ptr_arr", "uint_arr", "int_arr":
         arr_items := strings.SplitN(read_op_str, ":", 2)
         var count_str = ""
@@ -146,6 +196,7 @@ func (this *StackUprobeConfig) ParseArgType(arg_str string, point_arg *PointArg)
         // 0x89ab[buf:64,int] 命中hook点时读取 x0 处64字节数据 读取 x1 值
         // 0x89ab[buf:64:sp+0x20-0x8] 命中hook点时读取 sp+0x20-0x8 处64字节数据
         // 0x89ab[buf:x1:sp+0x20-0x8] 命中hook点时读取 sp+0x20-0x8 处x1寄存器大小字节数据
+        // 0x89ab[buf:ret]0x89f0 在返回处读取 x0 处返回值大小字节数据 只能用于返回处或者 sys_exit
         // 命令行读取的时候默认读取大小为 256 可以指定为比这个更大的数 但是不能超过 4096
         at := argtype.R_BUFFER_LEN(256)
         buf_items := strings.SplitN(read_op_str, ":", 2)
@@ -159,7 +210,9 @@ func (this *StackUprobeConfig) ParseArgType(arg_str string, point_arg *PointArg)
         } else {
             return errors.New(fmt.Sprintf("parse buf arg_str:%s failed", arg_str))
         }
-        if size_str != "" {
+        if size_str == "ret" {
+            at = argtype.R_BUFFER_RET()
+        } else if size_str != "" {
             // base 指定为 0 的时候 会自动判断是不是16进制 但必须有 0x/0X 前缀
             size, err := strconv.ParseUint(size_str, 0, 32)
             if err == nil {
@@ -291,6 +344,8 @@ func (this *StackUprobeConfig) Parse_FileConfig(config *UprobeFileConfig) (err e
         if point_config.Signal != "" {
             hook_point.KillSignal = util.ParseSignal(point_config.Signal)
         }
+        hook_point.CallerLibs = point_config.Caller
+        hook_point.Limit = point_config.PointLimit
 
         // strstr / strstr+0x4 / 0xA94E8
         items := strings.Split(point_config.Name, "+")
@@ -319,9 +374,25 @@ func (this *StackUprobeConfig) Parse_FileConfig(config *UprobeFileConfig) (err e
         }
 
         for arg_index, param := range point_config.Params {
+            // list:dwarf:xxx 这类则需要注册元素的类型
+            if IsDwarfType(param.GetElemType()) {
+                err = RegisterDwarfType(param.GetElemType(), this.GetDebugFile())
+                if err != nil {
+                    return err
+                }
+            }
             point_arg := param.GetPointArg(uint32(arg_index), EBPF_UPROBE_ENTER)
             hook_point.PointArgs = append(hook_point.PointArgs, point_arg)
         }
+        if err := hook_point.CheckRetValue(); err != nil {
+            return errors.New(fmt.Sprintf("parse for %s failed, err:%v", point_config.Name, err))
+        }
+        if err := CheckMaxSteps(point_config.Name, hook_point.PointArgs, STACK_MAX_OP_COUNT); err != nil {
+            return err
+        }
+        if err := CheckMaxDataSize(point_config.Name, hook_point.PointArgs); err != nil {
+            return err
+        }
         this.Points = append(this.Points, hook_point)
     }
     return nil
@@ -337,9 +408,17 @@ func (this *StackUprobeConfig) Parse_HookPoint(configs []string) (err error) {
 
     // strstr+0x0[str,str] 命中 strstr + 0x0 时将x0和x1读取为字符串
     // write[int,buf:128,int] 命中 write 时将x0读取为int、x1读取为字节数组、x2读取为int
+    // strstr[str,str]@max_hits=100,every_nth=10 @ 之后为输出限制
     for point_index, config_str := range configs {
         exit_read := false
         bind_syscall := false
+        var limit PointLimit
+        if index := strings.Index(config_str, "@"); index >= 0 {
+            if err := limit.Parse(config_str[index+1:]); err != nil {
+                return errors.New(fmt.Sprintf("parse for %s failed, err:%v", config_str, err))
+            }
+            config_str = config_str[:index]
+        }
         if strings.HasSuffix(config_str, "]s") {
             // 临时方案 将 uprobe 用法绑定到 syscall 上
             config_str = config_str[:len(config_str)-1]
@@ -370,6 +449,7 @@ func (this *StackUprobeConfig) Parse_HookPoint(configs []string) (err error) {
             hook_point.BindSyscall = bind_syscall
             hook_point.ExitRead = exit_read
             hook_point.ExitOffset = exit_offset
+            hook_point.Limit = limit
             hook_point.Index = uint32(point_index)
             hook_point.Offset = 0x0
             hook_point.LibPath = this.LibPath
@@ -409,6 +489,15 @@ func (this *StackUprobeConfig) Parse_HookPoint(configs []string) (err error) {
                     hook_point.PointArgs = append(hook_point.PointArgs, point_arg)
                 }
             }
+            if err := hook_point.CheckRetValue(); err != nil {
+                return errors.New(fmt.Sprintf("parse for %s failed, err:%v", config_str, err))
+            }
+            if err := CheckMaxSteps(config_str, hook_point.PointArgs, STACK_MAX_OP_COUNT); err != nil {
+                return err
+            }
+            if err := CheckMaxDataSize(config_str, hook_point.PointArgs); err != nil {
+                return err
+            }
             this.Points = append(this.Points, hook_point)
         } else {
             return errors.New(fmt.Sprintf("parse for %s failed", config_str))
@@ -424,6 +513,27 @@ func (this *StackUprobeConfig) Parse_HookPoint(configs []string) (err error) {
     return nil
 }
 
+// 32 位 arm 库中 thumb 函数的符号值最低位为 1 uprobe 要落在去掉最低位的地址上
+// 所以提前解析符号 换算为相对库文件的偏移 同时记录是否为 thumb 指令
+func (this *StackUprobeConfig) ResolveArmPoints() error {
+    for _, point := range this.Points {
+        if point.Symbol != "" {
+            sym, sym_offset, err := util.FindElfSymbolOffset(point.LibPath, point.Symbol)
+            if err != nil {
+                return err
+            }
+            point.Offset += sym_offset
+            point.Thumb = sym.Thumb
+            point.Symbol = ""
+        } else if point.Offset&1 == 1 {
+            // 直接给出偏移时 以最低位标记 thumb
+            point.Offset &^= 1
+            point.Thumb = true
+        }
+    }
+    return nil
+}
+
 type PointFilter struct {
     FilterIndexList []uint32
 }
@@ -544,7 +654,19 @@ func (this *SyscallConfig) Parse_FileConfig(config *SyscallFileConfig) (err erro
             b_point_args = append(b_point_args, b_p)
 
         }
-        point := &SyscallPoint{point_config.Nr, point_config.Name, a_point_args, b_point_args}
+        if err := CheckMaxSteps(point_config.Name, a_point_args, SYSCALL_MAX_OP_COUNT); err != nil {
+            return err
+        }
+        if err := CheckMaxDataSize(point_config.Name, a_point_args); err != nil {
+            return err
+        }
+        if err := CheckMaxSteps(point_config.Name, b_point_args, SYSCALL_MAX_OP_COUNT); err != nil {
+            return err
+        }
+        if err := CheckMaxDataSize(point_config.Name, b_point_args); err != nil {
+            return err
+        }
+        point := &SyscallPoint{point_config.Nr, point_config.Name, a_point_args, b_point_args, point_config.Caller, 0, point_config.PointLimit}
         this.PointArgs = append(this.PointArgs, point)
     }
 
@@ -748,6 +870,9 @@ type ModuleConfig struct {
 
     SelfPid     uint32
     PkgNamelist []string
+    // --comm --exe 指定的目标 运行中新出现的匹配进程也会被追踪
+    CommNamelist []string
+    ExeNamelist  []string
 
     UidWhitelist   []uint32
     UidBlacklist   []uint32
@@ -779,6 +904,11 @@ type ModuleConfig struct {
     BrkLen      uint64
     BrkType     uint32
     BrkKernel   bool
+    BrkArgs     []*PointArg
+    FlameGraph  string
+    NoFollowExec bool
+    Crash       bool
+    CrashDir    string
     Color       bool
     DumpHandle  *os.File
     FmtJson     bool
@@ -788,6 +918,14 @@ type ModuleConfig struct {
     ShowUid     bool
 
     Name            string
+    Recorder        FlightRecorderConfig
+    Summary         SummaryConfig
+    Caller          CallerConfig
+    StackMatch      StackMatchConfig
+    Session         SessionConfig
+    ProcTree        ProcTreeConfig
+    TraceUser       uint32
+    Users           []uint32
     StackUprobeConf *StackUprobeConfig
     SysCallConf     *SyscallConfig
 }
@@ -852,13 +990,22 @@ func (this *ModuleConfig) InitCommonConfig(gconfig *GlobalConfig) {
     this.ShowTime = gconfig.ShowTime
     this.ShowUid = gconfig.ShowUid
 
+    this.FlameGraph = gconfig.FlameGraph
+    this.NoFollowExec = gconfig.NoFollowExec
+    this.Crash = gconfig.Crash
+    this.CrashDir = gconfig.CrashDir
+
     this.AutoResume = gconfig.AutoResume
     this.KillSignal = util.ParseSignal(gconfig.KillSignal)
     this.TKillSignal = util.ParseSignal(gconfig.TKillSignal)
 
+    // 自定义结构体的读取操作在注册时生成 所以要在加载配置之前设定
+    argtype.CustomMaxDepth = gconfig.StructDepth
+
     this.StackUprobeConf = &StackUprobeConfig{}
     this.StackUprobeConf.SetDumpHex(this.DumpHex)
     this.StackUprobeConf.SetColor(this.Color)
+    this.StackUprobeConf.DebugFile = gconfig.DebugFile
 
     this.SysCallConf = &SyscallConfig{}
     this.SysCallConf.SetDebug(this.Debug)
@@ -884,6 +1031,11 @@ func (this *ModuleConfig) LoadConfig(gconfig *GlobalConfig) {
         if err != nil {
             panic(err)
         }
+        // 自定义类型需要在解析 points 之前注册
+        err = RegisterTypes(base_config.Types)
+        if err != nil {
+            panic(err)
+        }
         switch base_config.Type {
         case "uprobe":
             config := &UprobeFileConfig{}
@@ -916,6 +1068,29 @@ func (this *ModuleConfig) LoadConfig(gconfig *GlobalConfig) {
     }
 }
 
+func (this *ModuleConfig) Parse_BrkArgs(args_str string) error {
+    // [str:x0,buf:32:x1] 断点命中时按 uprobe 参数的语法读取
+    if !strings.HasPrefix(args_str, "[") || !strings.HasSuffix(args_str, "]") {
+        return errors.New(fmt.Sprintf("parse brk args %s failed, format like [str:x0,buf:32:x1]", args_str))
+    }
+    args_str = args_str[1 : len(args_str)-1]
+    if args_str == "" {
+        return nil
+    }
+    for arg_index, arg_str := range strings.Split(args_str, ",") {
+        arg_name := fmt.Sprintf("arg_%d", arg_index)
+        point_arg := NewUprobePointArg(arg_name, POINTER, uint32(arg_index))
+        if err := this.StackUprobeConf.ParseArgType(arg_str, point_arg); err != nil {
+            return err
+        }
+        if point_arg.UseRetValue() {
+            return errors.New(fmt.Sprintf("parse brk args %s failed, buf:ret is not supported", args_str))
+        }
+        this.BrkArgs = append(this.BrkArgs, point_arg)
+    }
+    return nil
+}
+
 func (this *ModuleConfig) Info() string {
     // 调用号信息
     return fmt.Sprintf("-")
@@ -963,6 +1138,11 @@ func (this *ModuleConfig) Parse_Namelist(list_key, name_list string) {
         panic(fmt.Sprintf("max %s count is %d, provided count:%d", list_key, MAX_COUNT, len(items)))
     }
     for _, v := range items {
+        if IsThreadNameGlob(v) {
+            if _, err := filepath.Match(v, ""); err != nil {
+                panic(fmt.Sprintf("bad thread name pattern %s, err:%v", v, err))
+            }
+        }
         switch list_key {
         case "TNameWhitelist":
             this.TNameWhitelist = append(this.TNameWhitelist, v)
@@ -974,6 +1154,11 @@ func (this *ModuleConfig) Parse_Namelist(list_key, name_list string) {
     }
 }
 
+// 是否有需要在运行中动态匹配的目标进程
+func (this *ModuleConfig) HasRuntimeTarget() bool {
+    return len(this.PkgNamelist) > 0 || len(this.CommNamelist) > 0 || len(this.ExeNamelist) > 0
+}
+
 func (this *ModuleConfig) GetCommonFilter() CommonFilter {
     filter := CommonFilter{}
     if this.Is32Bit {
@@ -987,6 +1172,7 @@ func (this *ModuleConfig) GetCommonFilter() CommonFilter {
     filter.trace_uid_group = this.TraceGroup
     filter.signal = this.KillSignal
     filter.tsignal = this.TKillSignal
+    filter.trace_user = this.TraceUser
     return filter
 }
 
@@ -0,0 +1,435 @@
+package config
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"stackplz/user/argtype"
+	. "stackplz/user/common"
+	"strconv"
+	"strings"
+)
+
+// 离线模拟参数读取 不需要内核参与
+// 寄存器和内存来自 core 文件或者 json 描述 /proc/pid/mem 的快照可以作为 json 中的 file 加载
+// 模拟得到的数据和 eBPF 提交的一致 可以直接交给 argtype 解析 方便验证 -w 或配置文件的写法
+
+type MemRegion struct {
+	Addr uint64
+	Data []byte
+}
+
+type SimMemory struct {
+	Regions []MemRegion
+}
+
+func NewSimMemory() *SimMemory {
+	return &SimMemory{}
+}
+
+func (this *SimMemory) AddRegion(addr uint64, data []byte) {
+	this.Regions = append(this.Regions, MemRegion{Addr: addr, Data: data})
+	sort.Slice(this.Regions, func(i, j int) bool {
+		return this.Regions[i].Addr < this.Regions[j].Addr
+	})
+}
+
+func (this *SimMemory) ReadMemory(addr uint64, size uint32) ([]byte, error) {
+	// 允许跨越多个相邻的区域 中间有空洞则视为读取失败
+	result := make([]byte, 0, size)
+	cur := addr
+	for _, region := range this.Regions {
+		if uint32(len(result)) == size {
+			break
+		}
+		end := region.Addr + uint64(len(region.Data))
+		if cur < region.Addr || cur >= end {
+			continue
+		}
+		left := uint64(size) - uint64(len(result))
+		if cur+left > end {
+			left = end - cur
+		}
+		result = append(result, region.Data[cur-region.Addr:cur-region.Addr+left]...)
+		cur += left
+	}
+	if uint32(len(result)) != size {
+		return nil, errors.New(fmt.Sprintf("read memory at 0x%x failed, want:%d got:%d", addr, size, len(result)))
+	}
+	return result, nil
+}
+
+func LoadCoreFile(path string, tid uint32) ([]uint64, *SimMemory, error) {
+	// 内存来自 PT_LOAD 段 寄存器来自 NT_PRSTATUS
+	// tid 为 0 时使用第一个线程 即触发 coredump 的线程
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if f.Type != elf.ET_CORE {
+		return nil, nil, errors.New(fmt.Sprintf("%s is not a core file", path))
+	}
+	mem := NewSimMemory()
+	var regs []uint64
+	for _, prog := range f.Progs {
+		switch prog.Type {
+		case elf.PT_LOAD:
+			if prog.Filesz == 0 {
+				continue
+			}
+			data := make([]byte, prog.Filesz)
+			if _, err := prog.ReadAt(data, 0); err != nil {
+				return nil, nil, err
+			}
+			mem.AddRegion(prog.Vaddr, data)
+		case elf.PT_NOTE:
+			if regs != nil {
+				continue
+			}
+			data := make([]byte, prog.Filesz)
+			if _, err := prog.ReadAt(data, 0); err != nil {
+				return nil, nil, err
+			}
+			regs, err = parseCoreRegs(f, data, tid)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if regs == nil {
+		return nil, nil, errors.New(fmt.Sprintf("can not find NT_PRSTATUS for tid %d in %s", tid, path))
+	}
+	return regs, mem, nil
+}
+
+func parseCoreRegs(f *elf.File, data []byte, tid uint32) ([]uint64, error) {
+	// elf_prstatus 中 pr_pid 和 pr_reg 的偏移 32 位和 64 位不同
+	var pid_offset, reg_offset, reg_count int
+	switch f.Machine {
+	case elf.EM_AARCH64:
+		// x0 ~ x30 sp pc pstate 与 REG_ARM64_* 的顺序一致
+		pid_offset, reg_offset, reg_count = 32, 112, 34
+	case elf.EM_ARM:
+		// r0 ~ r15 cpsr orig_r0
+		pid_offset, reg_offset, reg_count = 24, 72, 18
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported core machine %s", f.Machine.String()))
+	}
+	reg_size := 8
+	if f.Class == elf.ELFCLASS32 {
+		reg_size = 4
+	}
+	for len(data) >= 12 {
+		name_size := int(f.ByteOrder.Uint32(data[0:4]))
+		desc_size := int(f.ByteOrder.Uint32(data[4:8]))
+		note_type := elf.NType(f.ByteOrder.Uint32(data[8:12]))
+		desc_start := 12 + int(alignUp(uint32(name_size), 4))
+		desc_end := desc_start + desc_size
+		if desc_end > len(data) {
+			break
+		}
+		desc := data[desc_start:desc_end]
+		data = data[desc_start+int(alignUp(uint32(desc_size), 4)):]
+		if note_type != elf.NT_PRSTATUS || len(desc) < reg_offset+reg_count*reg_size {
+			continue
+		}
+		if tid != 0 && f.ByteOrder.Uint32(desc[pid_offset:pid_offset+4]) != tid {
+			continue
+		}
+		regs := make([]uint64, REG_ARM64_MAX+1)
+		for i := 0; i < reg_count; i++ {
+			offset := reg_offset + i*reg_size
+			var value uint64
+			if reg_size == 4 {
+				value = uint64(f.ByteOrder.Uint32(desc[offset : offset+4]))
+			} else {
+				value = f.ByteOrder.Uint64(desc[offset : offset+8])
+			}
+			index := uint32(i)
+			if f.Machine == elf.EM_ARM && i == 15 {
+				index = REG_ARM64_PC
+			} else if f.Machine == elf.EM_ARM && i > 15 {
+				continue
+			}
+			if index <= REG_ARM64_MAX {
+				regs[index] = value
+			}
+		}
+		return regs, nil
+	}
+	return nil, nil
+}
+
+type SimMemConfig struct {
+	Addr string `json:"addr"`
+	Hex  string `json:"hex"`
+	Str  string `json:"str"`
+	File string `json:"file"`
+}
+
+type SimFixture struct {
+	PointType string            `json:"point_type"`
+	PtrSize   uint32            `json:"ptr_size"`
+	RetValue  string            `json:"ret_value"`
+	Types     []TypeConfig      `json:"types"`
+	Params    []ParamConfig     `json:"params"`
+	Regs      map[string]string `json:"regs"`
+	Memory    []SimMemConfig    `json:"memory"`
+	Core      string            `json:"core"`
+	Tid       uint32            `json:"tid"`
+	Expect    []string          `json:"expect"`
+	ExpectErr string            `json:"expect_error"`
+	path      string
+}
+
+func parseRegIndex(name string) (index uint32, err error) {
+	// GetRegIndex 遇到不支持的名称会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("unknown reg %s", name))
+		}
+	}()
+	return GetRegIndex(name), nil
+}
+
+func LoadSimFixture(path string) (*SimFixture, error) {
+	// {"params": [{"type": "str", "reg": "x0"}], "regs": {"x0": "0x1000"}, "memory": [{"addr": "0x1000", "str": "hello"}]}
+	// params 与配置文件中的写法一致 str 会自动补上结尾的 \x00 file 和 core 为相对 json 所在目录的路径
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &SimFixture{}
+	if err := json.Unmarshal(content, fixture); err != nil {
+		return nil, errors.New(fmt.Sprintf("parse fixture %s failed, err:%v", path, err))
+	}
+	fixture.path = path
+	return fixture, nil
+}
+
+func (this *SimFixture) resolvePath(file_path string) string {
+	if filepath.IsAbs(file_path) {
+		return file_path
+	}
+	return filepath.Join(filepath.Dir(this.path), file_path)
+}
+
+func (this *SimFixture) GetPointType() (uint32, error) {
+	switch this.PointType {
+	case "", "uprobe":
+		return EBPF_UPROBE_ENTER, nil
+	case "syscall":
+		return EBPF_SYS_ALL, nil
+	default:
+		return 0, errors.New(fmt.Sprintf("unknown point_type %s, choose uprobe or syscall", this.PointType))
+	}
+}
+
+func (this *SimFixture) LoadContext() ([]uint64, *SimMemory, error) {
+	// core 文件提供初始的寄存器和内存 regs 和 memory 在此基础上覆盖和补充
+	var regs []uint64
+	var mem *SimMemory
+	if this.Core != "" {
+		var err error
+		regs, mem, err = LoadCoreFile(this.resolvePath(this.Core), this.Tid)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		regs = make([]uint64, REG_ARM64_MAX+1)
+		mem = NewSimMemory()
+	}
+	for name, value_str := range this.Regs {
+		// 负数按补码保存
+		value, err := strconv.ParseUint(value_str, 0, 64)
+		if err != nil {
+			signed_value, err := strconv.ParseInt(value_str, 0, 64)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("parse reg %s value %s failed", name, value_str))
+			}
+			value = uint64(signed_value)
+		}
+		index, err := parseRegIndex(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for uint32(len(regs)) <= index {
+			regs = append(regs, 0)
+		}
+		regs[index] = value
+	}
+	for _, config := range this.Memory {
+		addr, err := strconv.ParseUint(config.Addr, 0, 64)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("parse memory addr %s failed", config.Addr))
+		}
+		var data []byte
+		switch {
+		case config.Hex != "":
+			data, err = hex.DecodeString(config.Hex)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("parse memory hex at %s failed, err:%v", config.Addr, err))
+			}
+		case config.Str != "":
+			data = append([]byte(config.Str), 0)
+		case config.File != "":
+			data, err = os.ReadFile(this.resolvePath(config.File))
+			if err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, errors.New(fmt.Sprintf("memory at %s has no content", config.Addr))
+		}
+		mem.AddRegion(addr, data)
+	}
+	return regs, mem, nil
+}
+
+func (this *SimFixture) GetPointArgs(point_type uint32) (point_args []*PointArg, err error) {
+	// 参数的写法有误时 GetPointArg 会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			point_args = nil
+			err = errors.New(fmt.Sprintf("parse params failed, err:%v", r))
+		}
+	}()
+	// 与配置文件一致 先声明结构体 params 中才能使用
+	if err := RegisterTypes(this.Types); err != nil {
+		return nil, err
+	}
+	for arg_index, param := range this.Params {
+		point_args = append(point_args, param.GetPointArg(uint32(arg_index), point_type))
+	}
+	max_steps := uint32(STACK_MAX_OP_COUNT)
+	if point_type != EBPF_UPROBE_ENTER {
+		max_steps = SYSCALL_MAX_OP_COUNT
+	}
+	if err := CheckMaxSteps(this.path, point_args, max_steps); err != nil {
+		return nil, err
+	}
+	if err := CheckMaxDataSize(this.path, point_args); err != nil {
+		return nil, err
+	}
+	return point_args, nil
+}
+
+func (this *SimFixture) Run() (*SimResult, error) {
+	point_type, err := this.GetPointType()
+	if err != nil {
+		return nil, err
+	}
+	point_args, err := this.GetPointArgs(point_type)
+	if err != nil {
+		return nil, err
+	}
+	regs, mem, err := this.LoadContext()
+	if err != nil {
+		return nil, err
+	}
+	var ret_value uint64 = 0
+	if this.RetValue != "" {
+		value, err := strconv.ParseInt(this.RetValue, 0, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("parse ret_value %s failed", this.RetValue))
+		}
+		ret_value = uint64(value)
+	}
+	ptr_size := this.PtrSize
+	if ptr_size == 0 {
+		ptr_size = 8
+	}
+	return SimulatePointArgs(point_args, regs, mem, ptr_size, point_type, ret_value)
+}
+
+func (this *SimFixture) Check(result *SimResult) error {
+	// 没有给出 expect 时不做检查
+	if len(this.Expect) == 0 {
+		return nil
+	}
+	if len(this.Expect) != len(result.Args) {
+		return errors.New(fmt.Sprintf("expect %d args, got %d", len(this.Expect), len(result.Args)))
+	}
+	for i, expect := range this.Expect {
+		if result.Args[i] != expect {
+			return errors.New(fmt.Sprintf("arg %d mismatch\n\texpect: %s\n\tgot:    %s", i, expect, result.Args[i]))
+		}
+	}
+	return nil
+}
+
+// 有 expect_error 时检查错误的写法能够被正确拒绝 否则检查解析结果
+func (this *SimFixture) Verify() (*SimResult, error) {
+	result, err := this.Run()
+	if this.ExpectErr != "" {
+		if err == nil {
+			return nil, errors.New(fmt.Sprintf("expect error %q, got nil", this.ExpectErr))
+		}
+		if !strings.Contains(err.Error(), this.ExpectErr) {
+			return nil, errors.New(fmt.Sprintf("expect error %q, got %v", this.ExpectErr, err))
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := this.Check(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type SimResult struct {
+	Data []byte
+	Skip bool
+	Args []string
+	Json []any
+}
+
+func SimulatePointArgs(point_args []*PointArg, regs []uint64, mem IMemReader, ptr_size uint32, point_type uint32, ret_value uint64) (result *SimResult, err error) {
+	// 按 hook 点的全部参数拼接 op 然后解析 与 eBPF 的处理流程一致
+	// 操作数上限与对应的 eBPF 程序一致 uprobe 为 64 syscall 为 256
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = errors.New(fmt.Sprintf("simulate failed, err:%v", r))
+		}
+	}()
+	op_list := []uint32{}
+	for _, point_arg := range point_args {
+		op_list = append(op_list, point_arg.GetOpList()...)
+	}
+	max_op_count := uint32(STACK_MAX_OP_COUNT)
+	if point_type != EBPF_UPROBE_ENTER {
+		max_op_count = SYSCALL_MAX_OP_COUNT
+	}
+	vm := NewOpVM(regs, mem, max_op_count)
+	vm.PtrSize = ptr_size
+	vm.RetValue = ret_value
+	buf, skip := vm.Run(op_list, 0)
+	if vm.Err != nil {
+		return nil, vm.Err
+	}
+	result = &SimResult{}
+	result.Data = buf.Bytes()
+	result.Skip = skip
+	text_buf := bytes.NewBuffer(result.Data)
+	json_buf := bytes.NewBuffer(result.Data)
+	for _, point_arg := range point_args {
+		var ptr argtype.Arg_reg
+		if err := binary.Read(text_buf, binary.LittleEndian, &ptr); err != nil {
+			return result, errors.New(fmt.Sprintf("read arg %s failed, err:%v", point_arg.Name, err))
+		}
+		result.Args = append(result.Args, point_arg.Parse(ptr.Address, text_buf, point_type))
+		binary.Read(json_buf, binary.LittleEndian, &ptr)
+		result.Json = append(result.Json, point_arg.ParseJson(ptr.Address, json_buf, point_type))
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"path/filepath"
+	"stackplz/user/common"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 用例按 arm64 的寄存器名称编写 其他架构下参数寄存器同样从下标 0 开始依次存放
+func hostRegName(name string) string {
+	if !strings.HasPrefix(name, "x") {
+		return name
+	}
+	index, err := strconv.ParseUint(name[1:], 10, 32)
+	if err != nil || index > 5 {
+		return name
+	}
+	if _, err := parseRegIndex(name); err == nil {
+		return name
+	}
+	if host_name, ok := common.GetRegName(uint32(index)); ok {
+		return host_name
+	}
+	return name
+}
+
+func TestSimFixtures(t *testing.T) {
+	paths, err := filepath.Glob("../../test/sim/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixture found under test/sim")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			fixture, err := LoadSimFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			regs := make(map[string]string)
+			for name, value := range fixture.Regs {
+				regs[hostRegName(name)] = value
+			}
+			fixture.Regs = regs
+			for i := range fixture.Params {
+				param := &fixture.Params[i]
+				param.Reg = hostRegName(param.Reg)
+				param.Size = hostRegName(param.Size)
+				param.Count = hostRegName(param.Count)
+			}
+			if _, err := fixture.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package config
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"stackplz/user/argtype"
+	. "stackplz/user/common"
+)
+
+// 用户态的 op 解释器 语义与 src/utils.h 中的 read_args 保持一致
+// 用于没有 eBPF 程序参与读取参数的场景 比如硬件断点命中时
+// 生成的数据格式和 eBPF 提交的一致 所以可以直接交给 PointArg.Parse 解析
+
+type IMemReader interface {
+	ReadMemory(addr uint64, size uint32) ([]byte, error)
+}
+
+type OpContext struct {
+	SaveIndex      uint8
+	RegIndex       uint32
+	LoopCount      uint32
+	BreakCount     uint32
+	ApplyFilter    bool
+	SkipFlag       bool
+	MatchWhitelist bool
+	MatchBlacklist bool
+	LoopIndex      uint32
+	OpKeyIndex     uint32
+	OpCode         uint32
+	PostCode       uint32
+	StrLen         uint32
+	ReadLen        uint32
+	ReadAddr       uint64
+	RegValue       uint64
+	PointerValue   uint64
+	TmpValue       uint64
+	Reg0           uint64
+	RetValue       uint64
+}
+
+type OpVM struct {
+	Regs       []uint64
+	Mem        IMemReader
+	PtrSize    uint32
+	MaxOpCount uint32
+	RetValue   uint64
+	Err        error
+	ctx        OpContext
+	buf        *bytes.Buffer
+}
+
+func NewOpVM(regs []uint64, mem IMemReader, max_op_count uint32) *OpVM {
+	// max_op_count 为对应 eBPF 程序的操作数上限 stack 为 64 syscall 为 256
+	vm := &OpVM{}
+	vm.Regs = regs
+	vm.Mem = mem
+	vm.PtrSize = 8
+	vm.MaxOpCount = max_op_count
+	return vm
+}
+
+func (this *OpVM) GetContext() *OpContext {
+	return &this.ctx
+}
+
+func (this *OpVM) fixAddr(addr uint64) uint64 {
+	// fix memory tag
+	return addr & 0xffffffffffff
+}
+
+func (this *OpVM) readPointer(addr uint64) uint64 {
+	data, err := this.Mem.ReadMemory(addr, this.PtrSize)
+	if err != nil {
+		// 与 bpf_probe_read_user 失败时一致 结果为 0
+		return 0
+	}
+	if this.PtrSize == 4 {
+		return uint64(binary.LittleEndian.Uint32(data))
+	}
+	return binary.LittleEndian.Uint64(data)
+}
+
+func (this *OpVM) readString(addr uint64, max_size uint32) ([]byte, bool) {
+	// 按页读取直到遇到 \x00 最多读取 max_size 与 bpf_probe_read_str 行为一致
+	var result []byte
+	for uint32(len(result)) < max_size {
+		cur := addr + uint64(len(result))
+		chunk_size := uint32(0x1000 - cur%0x1000)
+		if left := max_size - uint32(len(result)); chunk_size > left {
+			chunk_size = left
+		}
+		data, err := this.Mem.ReadMemory(cur, chunk_size)
+		// 快照之类的内存可能不是整页的 逐步缩小读取大小
+		for err != nil && chunk_size > 1 {
+			chunk_size /= 2
+			data, err = this.Mem.ReadMemory(cur, chunk_size)
+		}
+		if err != nil {
+			if len(result) == 0 {
+				return nil, false
+			}
+			break
+		}
+		if index := bytes.IndexByte(data, 0); index != -1 {
+			return append(result, data[:index+1]...), true
+		}
+		result = append(result, data...)
+	}
+	if uint32(len(result)) == max_size {
+		result[len(result)-1] = 0
+		return result, true
+	}
+	return append(result, 0), true
+}
+
+func (this *OpVM) saveValue(value uint64) {
+	// [index][value]
+	this.buf.WriteByte(this.ctx.SaveIndex)
+	binary.Write(this.buf, binary.LittleEndian, value)
+}
+
+func (this *OpVM) saveBytes(data []byte, size uint32) {
+	// [index][size][bytes]
+	this.buf.WriteByte(this.ctx.SaveIndex)
+	binary.Write(this.buf, binary.LittleEndian, size)
+	this.buf.Write(data)
+}
+
+func (this *OpVM) getFilter(filter_index uint64) (ArgFilter, bool) {
+	for _, filter := range GetFilters() {
+		if uint64(filter.Filter_index) == filter_index {
+			return filter, true
+		}
+	}
+	return ArgFilter{}, false
+}
+
+func (this *OpVM) Run(op_key_list []uint32, save_index uint8) (*bytes.Buffer, bool) {
+	this.ctx = OpContext{}
+	this.ctx.SaveIndex = save_index
+	this.Err = nil
+	if len(this.Regs) > 0 {
+		this.ctx.Reg0 = this.Regs[0]
+	}
+	// 模拟返回处的 hook 点时使用 与 eBPF 一样 32 位进程需要符号扩展
+	this.ctx.RetValue = this.RetValue
+	if this.PtrSize == 4 {
+		this.ctx.RetValue = uint64(int64(int32(this.RetValue)))
+	}
+	this.buf = bytes.NewBuffer(nil)
+	var op *argtype.OpConfig = nil
+	for i := uint32(0); i < this.MaxOpCount; i++ {
+		if op != nil && this.ctx.PostCode != argtype.OP_SKIP {
+			this.ctx.OpCode = this.ctx.PostCode
+			this.ctx.PostCode = argtype.OP_SKIP
+		} else {
+			if this.ctx.OpKeyIndex >= uint32(len(op_key_list)) {
+				break
+			}
+			op = argtype.OPM.GetOp(op_key_list[this.ctx.OpKeyIndex])
+			this.ctx.OpCode = op.Code
+			this.ctx.PostCode = op.PostCode
+			this.ctx.OpKeyIndex += 1
+		}
+		if this.ctx.OpCode == argtype.OP_SKIP {
+			break
+		}
+		this.step(op)
+		if this.Err != nil {
+			// eBPF 中直接返回 不会再设置 skip_flag
+			return this.buf, false
+		}
+		// 黑名单不用读完 直接结束
+		if this.ctx.MatchBlacklist {
+			break
+		}
+	}
+	if this.ctx.MatchBlacklist {
+		this.ctx.SkipFlag = true
+	} else if this.ctx.ApplyFilter && !this.ctx.MatchWhitelist {
+		this.ctx.SkipFlag = true
+	}
+	return this.buf, this.ctx.SkipFlag
+}
+
+func (this *OpVM) step(op *argtype.OpConfig) {
+	ctx := &this.ctx
+	switch ctx.OpCode {
+	case argtype.OP_RESET_CTX:
+		ctx.BreakCount = 0
+		ctx.RegIndex = 0
+		ctx.ReadAddr = 0
+		ctx.ReadLen = 0
+		ctx.RegValue = 0
+		ctx.PointerValue = 0
+	case argtype.OP_SET_REG_INDEX:
+		ctx.RegIndex = uint32(op.Value)
+	case argtype.OP_SET_READ_LEN:
+		ctx.ReadLen = uint32(op.Value)
+	case argtype.OP_SET_READ_LEN_REG_VALUE:
+		if uint64(ctx.ReadLen) > ctx.RegValue {
+			ctx.ReadLen = uint32(ctx.RegValue)
+		}
+	case argtype.OP_SET_READ_LEN_POINTER_VALUE:
+		if uint64(ctx.ReadLen) > ctx.PointerValue {
+			ctx.ReadLen = uint32(ctx.PointerValue)
+		}
+	case argtype.OP_SET_READ_LEN_RET_VALUE:
+		if int64(ctx.RetValue) < 0 {
+			ctx.ReadLen = 0
+		} else if uint64(ctx.ReadLen) > ctx.RetValue {
+			ctx.ReadLen = uint32(ctx.RetValue)
+		}
+	case argtype.OP_SET_READ_COUNT:
+		ctx.ReadLen *= uint32(op.Value)
+	case argtype.OP_ADD_OFFSET:
+		ctx.ReadAddr += op.Value
+	case argtype.OP_SUB_OFFSET:
+		ctx.ReadAddr -= op.Value
+	case argtype.OP_MOVE_REG_VALUE:
+		ctx.ReadAddr = ctx.RegValue
+	case argtype.OP_MOVE_POINTER_VALUE:
+		ctx.ReadAddr = ctx.PointerValue
+	case argtype.OP_MOVE_TMP_VALUE:
+		ctx.ReadAddr = ctx.TmpValue
+	case argtype.OP_SET_TMP_VALUE:
+		ctx.TmpValue = ctx.ReadAddr
+	case argtype.OP_FOR_BREAK:
+		if ctx.LoopCount == 0 {
+			ctx.LoopIndex = ctx.OpKeyIndex
+		}
+		if ctx.LoopCount >= ctx.BreakCount {
+			ctx.LoopCount = 0
+			ctx.BreakCount = 0
+			ctx.LoopIndex = 0
+		} else {
+			ctx.LoopCount += 1
+			ctx.OpKeyIndex = ctx.LoopIndex
+		}
+	case argtype.OP_SET_BREAK_COUNT:
+		ctx.BreakCount = MAX_LOOP_COUNT
+		if uint64(ctx.BreakCount) > op.Value {
+			ctx.BreakCount = uint32(op.Value)
+		}
+	case argtype.OP_SET_BREAK_COUNT_REG_VALUE:
+		ctx.BreakCount = MAX_LOOP_COUNT
+		if uint64(ctx.BreakCount) > ctx.RegValue {
+			ctx.BreakCount = uint32(ctx.RegValue)
+		}
+	case argtype.OP_SET_BREAK_COUNT_POINTER_VALUE:
+		ctx.BreakCount = MAX_LOOP_COUNT
+		if uint64(ctx.BreakCount) > ctx.PointerValue {
+			ctx.BreakCount = uint32(ctx.PointerValue)
+		}
+	case argtype.OP_SAVE_ADDR:
+		this.saveValue(ctx.ReadAddr)
+		ctx.SaveIndex += 1
+	case argtype.OP_ADD_REG:
+		ctx.ReadAddr += ctx.RegValue
+	case argtype.OP_SUB_REG:
+		ctx.ReadAddr -= ctx.RegValue
+	case argtype.OP_READ_REG:
+		if op.PreCode == argtype.OP_SET_REG_INDEX {
+			ctx.RegIndex = uint32(op.Value)
+		}
+		if ctx.RegIndex >= uint32(len(this.Regs)) {
+			// 与 eBPF 一致 直接结束读取
+			this.Err = errors.New(fmt.Sprintf("OpVM READ_REG failed, reg_index:%d out of range", ctx.RegIndex))
+			return
+		}
+		if ctx.RegIndex == 0 {
+			ctx.RegValue = ctx.Reg0
+		} else {
+			ctx.RegValue = this.Regs[ctx.RegIndex]
+		}
+	case argtype.OP_SAVE_REG:
+		this.saveValue(ctx.RegValue)
+		ctx.SaveIndex += 1
+	case argtype.OP_READ_POINTER:
+		if op.PreCode == argtype.OP_ADD_OFFSET {
+			ctx.PointerValue = this.readPointer(ctx.ReadAddr + op.Value)
+		} else if op.PreCode == argtype.OP_SUB_OFFSET {
+			ctx.PointerValue = this.readPointer(ctx.ReadAddr - op.Value)
+		} else {
+			ctx.PointerValue = this.readPointer(ctx.ReadAddr)
+		}
+	case argtype.OP_SAVE_POINTER:
+		this.saveValue(ctx.PointerValue)
+		ctx.SaveIndex += 1
+	case argtype.OP_SAVE_STRUCT:
+		ctx.ReadAddr = this.fixAddr(ctx.ReadAddr)
+		if op.PreCode == argtype.OP_SET_READ_COUNT {
+			ctx.ReadLen *= uint32(op.Value)
+		}
+		if ctx.ReadLen > MAX_BUF_READ_SIZE {
+			ctx.ReadLen = MAX_BUF_READ_SIZE
+		}
+		data, err := this.Mem.ReadMemory(ctx.ReadAddr, ctx.ReadLen)
+		if err != nil || ctx.ReadLen == 0 {
+			// 保存失败的情况 比如是一个非法的地址 那么就填一个空的 buf
+			this.saveBytes(nil, 0)
+		} else {
+			this.saveBytes(data, ctx.ReadLen)
+		}
+		ctx.SaveIndex += 1
+	case argtype.OP_FILTER_VALUE:
+		filter, ok := this.getFilter(op.Value)
+		if !ok {
+			return
+		}
+		if filter.Filter_type == EQUAL_FILTER {
+			if filter.Num_val != ctx.RegValue {
+				ctx.MatchBlacklist = true
+			}
+		} else if filter.Filter_type == GREATER_FILTER {
+			if filter.Num_val <= ctx.RegValue {
+				ctx.MatchBlacklist = true
+			}
+		} else if filter.Filter_type == LESS_FILTER {
+			if filter.Num_val >= ctx.RegValue {
+				ctx.MatchBlacklist = true
+			}
+		}
+	case argtype.OP_FILTER_BUFFER:
+		filter, ok := this.getFilter(op.Value)
+		if !ok {
+			return
+		}
+		if filter.Filter_type == WHITELIST_FILTER {
+			ctx.ApplyFilter = true
+			ptr := this.readPointer(this.fixAddr(ctx.ReadAddr))
+			if filter.Num_val == (ptr & (0xffffffffffffffff >> filter.Str_len)) {
+				ctx.MatchWhitelist = true
+			}
+		}
+	case argtype.OP_FILTER_STRING:
+		filter, ok := this.getFilter(op.Value)
+		if !ok {
+			return
+		}
+		is_match := false
+		if ctx.StrLen >= filter.Str_len {
+			data, err := this.Mem.ReadMemory(ctx.ReadAddr, filter.Str_len)
+			if err == nil && bytes.Equal(data, filter.Str_val[:filter.Str_len]) {
+				is_match = true
+			}
+		}
+		if filter.Filter_type == WHITELIST_FILTER {
+			ctx.ApplyFilter = true
+			if is_match {
+				ctx.MatchWhitelist = true
+			}
+		} else if filter.Filter_type == BLACKLIST_FILTER && is_match {
+			ctx.MatchBlacklist = true
+		}
+	case argtype.OP_SAVE_STRING:
+		ctx.ReadAddr = this.fixAddr(ctx.ReadAddr)
+		data, ok := this.readString(ctx.ReadAddr, MAX_BUF_READ_SIZE)
+		if !ok {
+			this.saveBytes(nil, 0)
+		} else {
+			this.saveBytes(data, uint32(len(data)))
+			ctx.StrLen = uint32(len(data))
+		}
+		ctx.SaveIndex += 1
+	case argtype.OP_SAVE_PTR_STRING:
+		ptr := this.readPointer(this.fixAddr(ctx.ReadAddr))
+		this.saveValue(ptr)
+		ctx.SaveIndex += 1
+		data, ok := this.readString(this.fixAddr(ptr), MAX_BUF_READ_SIZE)
+		if !ok {
+			// 为读取字符串数组设计的 和空字符串的情况区分开
+			this.saveBytes(nil, STRARR_MAGIC_LEN)
+			ctx.LoopCount = ctx.BreakCount
+		} else {
+			this.saveBytes(data, uint32(len(data)))
+		}
+		ctx.SaveIndex += 1
+	case argtype.OP_READ_STD_STRING:
+		// 搭配 OP_SAVE_STRING 使用 这里仅计算实际的字符串地址
+		ptr := this.fixAddr(ctx.ReadAddr)
+		var value uint8 = 0
+		if data, err := this.Mem.ReadMemory(ptr, 1); err == nil {
+			value = data[0]
+		}
+		if value&1 == 0 {
+			ptr += 1
+		} else {
+			ptr = this.readPointer(ptr + uint64(this.PtrSize)*2)
+		}
+		ctx.ReadAddr = ptr
+	case argtype.OP_SAVE_READ_LEN:
+		this.saveValue(uint64(ctx.ReadLen))
+		ctx.SaveIndex += 1
+	case argtype.OP_SAVE_STRUCT_CHUNK, argtype.OP_SAVE_STRUCT_PAGE_CHUNK:
+		ctx.ReadAddr = this.fixAddr(ctx.ReadAddr)
+		chunk_len := ctx.ReadLen
+		if uint64(chunk_len) > op.Value {
+			chunk_len = uint32(op.Value)
+		}
+		if ctx.OpCode == argtype.OP_SAVE_STRUCT_PAGE_CHUNK {
+			if page_left := uint32(READ_PAGE_SIZE - ctx.ReadAddr%READ_PAGE_SIZE); chunk_len > page_left {
+				chunk_len = page_left
+			}
+		}
+		if chunk_len > MAX_BUF_READ_SIZE {
+			chunk_len = MAX_BUF_READ_SIZE
+		}
+		data, err := this.Mem.ReadMemory(ctx.ReadAddr, chunk_len)
+		if err != nil || chunk_len == 0 {
+			this.saveBytes(nil, 0)
+			ctx.ReadLen = 0
+		} else {
+			this.saveBytes(data, chunk_len)
+			ctx.ReadAddr += uint64(chunk_len)
+			ctx.ReadLen -= chunk_len
+		}
+		ctx.SaveIndex += 1
+	case argtype.OP_SAVE_STRING_CHUNK:
+		ctx.ReadAddr = this.fixAddr(ctx.ReadAddr)
+		if op.PreCode == argtype.OP_SET_READ_LEN {
+			ctx.ReadLen = 1
+			ctx.StrLen = 0
+		}
+		var data []byte
+		ok := false
+		if ctx.ReadLen != 0 {
+			data, ok = this.readString(ctx.ReadAddr, uint32(op.Value))
+		}
+		sz := uint64(len(data))
+		if !ok {
+			this.saveBytes(nil, 0)
+			ctx.ReadLen = 0
+		} else if sz == op.Value && sz > 1 {
+			this.saveBytes(data, uint32(sz))
+			ctx.ReadAddr += sz - 1
+			ctx.StrLen += uint32(sz - 1)
+		} else {
+			this.saveBytes(data, uint32(sz))
+			ctx.StrLen += uint32(sz)
+			ctx.ReadLen = 0
+		}
+		ctx.SaveIndex += 1
+	case argtype.OP_READ_ART_STRING:
+		// 搭配 OP_SAVE_STRUCT 使用 count 最低位为 0 表示压缩存储
+		var count uint32 = 0
+		if data, err := this.Mem.ReadMemory(this.fixAddr(ctx.ReadAddr), 4); err == nil {
+			count = binary.LittleEndian.Uint32(data)
+		}
+		str_size := count >> 1
+		if count&1 != 0 {
+			str_size = str_size * 2
+		}
+		if ctx.ReadLen > str_size {
+			ctx.ReadLen = str_size
+		}
+		ctx.ReadAddr += op.Value
+	case argtype.OP_JUMP_ADDR_ZERO:
+		if this.fixAddr(ctx.ReadAddr) == 0 {
+			ctx.LoopCount = 0
+			ctx.BreakCount = 0
+			ctx.LoopIndex = 0
+			ctx.OpKeyIndex += uint32(op.Value)
+		}
+	case argtype.OP_MASK_POINTER_VALUE:
+		if op.Value < 8 {
+			ctx.PointerValue &= (uint64(1) << (op.Value * 8)) - 1
+		}
+	case argtype.OP_LIMIT_BREAK_COUNT:
+		if uint64(ctx.BreakCount) > op.Value {
+			ctx.BreakCount = uint32(op.Value)
+		}
+	case argtype.OP_SAVE_STR_LEN:
+		// 读满了仍未遇到结尾 接着计算剩余部分的长度
+		str_len := uint64(ctx.StrLen)
+		if ctx.ReadLen != 0 {
+			data, ok := this.readString(this.fixAddr(ctx.ReadAddr), MAX_BUF_READ_SIZE)
+			if !ok || len(data) == MAX_BUF_READ_SIZE {
+				// 只记录已经确认的长度
+				if ok {
+					str_len += uint64(len(data) - 1)
+				}
+				str_len |= STR_LEN_UNTERMINATED
+			} else {
+				str_len += uint64(len(data))
+			}
+			ctx.ReadLen = 0
+		}
+		this.saveValue(str_len)
+		ctx.SaveIndex += 1
+	case argtype.OP_JUMP_BREAK_COUNT_ZERO:
+		if ctx.BreakCount == 0 {
+			ctx.LoopCount = 0
+			ctx.LoopIndex = 0
+			ctx.OpKeyIndex += uint32(op.Value)
+		}
+	}
+}
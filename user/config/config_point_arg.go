@@ -2,6 +2,8 @@ package config
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"stackplz/user/argtype"
 	. "stackplz/user/common"
 )
@@ -36,36 +38,43 @@ func (this *PointArg) SetColor(color bool) {
 	argtype.GetArgType(this.TypeIndex).SetColor(color)
 }
 
-func (this *PointArg) SetFlagsFormat(format string) {
-	var p argtype.IArgType
+func GetFlagsConfig(format string) *argtype.FlagsConfig {
 	switch format {
 	case "inotify_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.InotifyFlagsConfig)
+		return argtype.InotifyFlagsConfig
 	case "access_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.AccessFlagsConfig)
+		return argtype.AccessFlagsConfig
 	case "mmap_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.MMapFlagsConfig)
+		return argtype.MMapFlagsConfig
 	case "mremap_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.MremapFlagsConfig)
+		return argtype.MremapFlagsConfig
 	case "file_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.FileFlagsConfig)
+		return argtype.FileFlagsConfig
 	case "prot_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.ProtFlagsConfig)
+		return argtype.ProtFlagsConfig
 	case "fcntl_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.FcntlFlagsConfig)
+		return argtype.FcntlFlagsConfig
 	case "statx_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.StatxFlagsConfig)
+		return argtype.StatxFlagsConfig
 	case "unlink_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.UnlinkFlagsConfig)
+		return argtype.UnlinkFlagsConfig
 	case "msg_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.MsgFlagsConfig)
+		return argtype.MsgFlagsConfig
 	case "socket_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.SocketFlagsConfig)
+		return argtype.SocketFlagsConfig
 	case "perm_flags":
-		p = argtype.NewNumFlags(this.TypeIndex, argtype.PermissionFlagsConfig)
+		return argtype.PermissionFlagsConfig
 	default:
+		return nil
+	}
+}
+
+func (this *PointArg) SetFlagsFormat(format string) {
+	flags_config := GetFlagsConfig(format)
+	if flags_config == nil {
 		panic("...")
 	}
+	p := argtype.NewNumFlags(this.TypeIndex, flags_config)
 	this.TypeIndex = p.GetTypeIndex()
 }
 
@@ -139,7 +148,7 @@ func (this *PointArg) GetOpList() []uint32 {
 		op_list = append(op_list, argtype.OPC_MOVE_REG_VALUE.Index)
 	}
 
-	if this.TypeIndex != STRING && this.TypeIndex != STD_STRING && !this.IsBuffer() {
+	if !this.IsString() && !this.IsBuffer() {
 		for _, v := range this.FilterIndexList {
 			filter_op := argtype.OPC_FILTER_VALUE.NewValue(uint64(v))
 			op_list = append(op_list, filter_op.Index)
@@ -150,7 +159,7 @@ func (this *PointArg) GetOpList() []uint32 {
 		for _, op_key := range argtype.GetOpKeyList(this.TypeIndex) {
 			op_list = append(op_list, op_key)
 		}
-		if this.TypeIndex == STRING || this.TypeIndex == STD_STRING {
+		if this.IsString() {
 			for _, v := range this.FilterIndexList {
 				filter_op := argtype.OPC_FILTER_STRING.NewValue(uint64(v))
 				op_list = append(op_list, filter_op.Index)
@@ -165,8 +174,78 @@ func (this *PointArg) GetOpList() []uint32 {
 	return op_list
 }
 
+func (this *PointArg) GetMaxSteps() uint32 {
+	// 按最坏的情况估算 读取这个参数在 eBPF 中需要执行的循环次数
+	steps := argtype.OPM.CountSteps(this.GetOpList())
+	if this.ReadMore() {
+		if at, ok := argtype.GetArgType(this.TypeIndex).(*argtype.ARG_TRAVERSE); ok {
+			steps += at.LoopSteps
+		}
+	}
+	return steps
+}
+
+func CheckMaxSteps(point_name string, point_args []*PointArg, max_steps uint32) error {
+	// 超出上限时内核会在中途停止读取 链表和数组的循环体会重复执行 所以在解析配置时就拒绝
+	var steps uint32 = 0
+	for _, point_arg := range point_args {
+		steps += point_arg.GetMaxSteps()
+	}
+	if steps > max_steps {
+		return errors.New(fmt.Sprintf("%s needs up to %d op steps, over the limit %d, reduce max/count of list/array", point_name, steps, max_steps))
+	}
+	return nil
+}
+
+func (this *PointArg) GetMaxDataSize() uint32 {
+	// 分段读取的参数 按最坏的情况估算在事件缓冲区中占用的大小
+	if !this.ReadMore() {
+		return 0
+	}
+	if at, ok := argtype.GetArgType(this.TypeIndex).(interface{ GetMaxDataSize() uint32 }); ok {
+		return at.GetMaxDataSize()
+	}
+	return 0
+}
+
+func CheckMaxDataSize(point_name string, point_args []*PointArg) error {
+	// 每一段开始保存时 缓冲区都要留有单次读取上限的空间 否则后面的段读取失败 只能按截断处理
+	var size uint32 = 0
+	for _, point_arg := range point_args {
+		size += point_arg.GetMaxDataSize()
+	}
+	max_size := uint32(ARGS_BUF_SIZE - MAX_BUF_READ_SIZE - 5)
+	if size > max_size {
+		return errors.New(fmt.Sprintf("%s needs up to %d bytes for max_len args, over the limit %d, reduce max_len", point_name, size, max_size))
+	}
+	return nil
+}
+
+func (this *PointArg) UseRetValue() bool {
+	// 以返回值作为读取大小 只能用于 sys_exit 或者返回处的 hook 点
+	for _, op_key := range argtype.GetOpKeyList(this.TypeIndex) {
+		if argtype.OPM.GetOp(op_key).Code == argtype.OP_SET_READ_LEN_RET_VALUE {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *PointArg) IsString() bool {
+	if this.TypeIndex == STRING || this.TypeIndex == STD_STRING {
+		return true
+	}
+	at, ok := argtype.GetArgType(this.TypeIndex).(*argtype.ARG_CHUNK)
+	return ok && at.IsString
+}
+
 func (this *PointArg) IsBuffer() bool {
-	return argtype.GetArgType(this.TypeIndex).GetParentIndex() == BUFFER
+	if argtype.GetArgType(this.TypeIndex).GetParentIndex() == BUFFER {
+		return true
+	}
+	// 指定了 max_len 的 buf 分段读取
+	at, ok := argtype.GetArgType(this.TypeIndex).(*argtype.ARG_CHUNK)
+	return ok && !at.IsString
 }
 
 func (this *PointArg) Clone() *PointArg {
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"errors"
+)
+
+// 进程树 记录被追踪进程和线程的生命周期
+// 包括父子关系、启动和退出时间、退出码、线程改名、exec 的程序以及事件数量
+type ProcTreeConfig struct {
+	Enable   bool
+	Interval uint32
+}
+
+func (this *ProcTreeConfig) IsEnable() bool {
+	return this.Enable
+}
+
+func (this *ModuleConfig) Parse_ProcTree(gconfig *GlobalConfig) error {
+	if !gconfig.ProcTree {
+		if gconfig.ProcTreeInterval > 0 {
+			return errors.New("--proc-tree-interval must work with --proc-tree")
+		}
+		return nil
+	}
+	// 生命周期事件由 exec 模块提供 它只跟随 syscall 和 uprobe 模块启动
+	if !this.SysCallConf.IsEnable() && len(this.StackUprobeConf.Points) == 0 {
+		return errors.New("--proc-tree must work with -s/--syscall or -w/--point")
+	}
+	this.ProcTree.Enable = true
+	this.ProcTree.Interval = gconfig.ProcTreeInterval
+	return nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"stackplz/user/util"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// 飞行记录模式 每个线程只保留最近的 Size 个事件
+// 命中触发规则时 才把对应进程的全部记录输出
+type FlightRecorderConfig struct {
+	Size uint32
+	// 触发的 syscall nr 仅在进入时触发
+	TriggerNRs []uint32
+	// 触发的 hook 点 对应 StackUprobeConf.Points 的索引
+	TriggerPoints []uint32
+	// 触发的崩溃信号 需要 --crash
+	TriggerSignals []uint32
+}
+
+// 与 signal.c 中 is_crash_signal 保持一致
+var crash_signals = []string{"SIGSEGV", "SIGBUS", "SIGABRT", "SIGILL", "SIGTRAP"}
+
+func (this *FlightRecorderConfig) IsEnable() bool {
+	return this.Size > 0
+}
+
+func (this *FlightRecorderConfig) IsTriggerNR(nr uint32) bool {
+	return slices.Contains(this.TriggerNRs, nr)
+}
+
+func (this *FlightRecorderConfig) IsTriggerPoint(point_index uint32) bool {
+	return slices.Contains(this.TriggerPoints, point_index)
+}
+
+func (this *FlightRecorderConfig) IsTriggerSignal(sig uint32) bool {
+	return slices.Contains(this.TriggerSignals, sig)
+}
+
+func (this *StackUprobeConfig) findTriggerPoint(trigger_point *UprobeArgs) (*UprobeArgs, error) {
+	for _, point := range this.Points {
+		if point.IsExitPoint() || point.Symbol != trigger_point.Symbol || point.Offset != trigger_point.Offset {
+			continue
+		}
+		if trigger_point.ExitOffset == 0 {
+			return point, nil
+		}
+		// 带返回偏移的写法 在返回处触发
+		for _, exit_point := range this.Points {
+			if exit_point.IsExitPoint() && exit_point.EnterKey == point.Index+1 && exit_point.Offset == trigger_point.ExitOffset {
+				return exit_point, nil
+			}
+		}
+		return nil, errors.New(fmt.Sprintf("trigger point %s return offset 0x%x is not hooked, plz add it to -w/--point", trigger_point.Name, trigger_point.ExitOffset))
+	}
+	return nil, errors.New(fmt.Sprintf("trigger point %s is not hooked, plz add it to -w/--point", trigger_point.Name))
+}
+
+func (this *ModuleConfig) Parse_FlightRecorder(gconfig *GlobalConfig) error {
+	has_trigger := gconfig.FRSysCall != "" || len(gconfig.FRPoint) > 0 || gconfig.FRSignal != ""
+	if gconfig.FlightRecorder == 0 {
+		if has_trigger {
+			return errors.New("--fr-syscall/--fr-point/--fr-signal must work with --flight-recorder")
+		}
+		return nil
+	}
+	if !has_trigger {
+		return errors.New("--flight-recorder need trigger, plz set --fr-syscall or --fr-point or --fr-signal")
+	}
+	this.Recorder.Size = gconfig.FlightRecorder
+
+	// 触发规则与 -s/--syscall 语法一致 只是不支持 all 和过滤规则
+	if gconfig.FRSysCall != "" {
+		for _, v := range strings.Split(gconfig.FRSysCall, ",") {
+			if v == "all" || strings.Contains(v, ":") {
+				return errors.New(fmt.Sprintf("trigger syscall %s not supported", v))
+			}
+		}
+		for _, syscall_name := range this.SysCallConf.Parse_SyscallNames(gconfig.FRSysCall) {
+			point := this.SysCallConf.GetSyscallPointByName(syscall_name)
+			if !this.SysCallConf.Enable || !slices.Contains(this.SysCallConf.SysWhitelist, point.Nr) {
+				return errors.New(fmt.Sprintf("trigger syscall %s is not traced, plz add it to -s/--syscall", syscall_name))
+			}
+			this.Recorder.TriggerNRs = append(this.Recorder.TriggerNRs, point.Nr)
+		}
+	}
+
+	// 触发规则与 -w/--point 语法一致 必须是已经 hook 的点
+	if len(gconfig.FRPoint) > 0 {
+		trigger_conf := &StackUprobeConfig{}
+		trigger_conf.LibPath = this.StackUprobeConf.LibPath
+		if err := trigger_conf.Parse_HookPoint(gconfig.FRPoint); err != nil {
+			return err
+		}
+		if gconfig.Is32Bit() {
+			// hook 点已经换算为偏移 触发规则也要同样换算才能匹配
+			if err := trigger_conf.ResolveArmPoints(); err != nil {
+				return err
+			}
+		}
+		for _, trigger_point := range trigger_conf.Points {
+			if trigger_point.IsExitPoint() {
+				// 由进入处的规则一并处理
+				continue
+			}
+			point, err := this.StackUprobeConf.findTriggerPoint(trigger_point)
+			if err != nil {
+				return err
+			}
+			this.Recorder.TriggerPoints = append(this.Recorder.TriggerPoints, point.Index)
+		}
+	}
+
+	// 崩溃信号 名称与 --kill 一致 all 表示全部崩溃信号
+	if gconfig.FRSignal != "" {
+		if !this.Crash {
+			return errors.New("--fr-signal must work with --crash")
+		}
+		sig_names := strings.Split(gconfig.FRSignal, ",")
+		if gconfig.FRSignal == "all" {
+			sig_names = crash_signals
+		}
+		for _, sig_name := range sig_names {
+			if !slices.Contains(crash_signals, sig_name) {
+				return errors.New(fmt.Sprintf("trigger signal %s not supported, only %s", sig_name, strings.Join(crash_signals, ",")))
+			}
+			this.Recorder.TriggerSignals = append(this.Recorder.TriggerSignals, util.ParseSignal(sig_name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 会话结束的方式 不同的方式使用不同的退出码 便于脚本判断
+// 1 已经被用于表示出错
+const (
+	SESSION_EXIT_SIGNAL     = 0
+	SESSION_EXIT_MAX_EVENTS = 2
+	SESSION_EXIT_DURATION   = 3
+	SESSION_EXIT_TARGET     = 4
+)
+
+type SessionConfig struct {
+	MaxEvents      uint64
+	Duration       time.Duration
+	ExitWithTarget bool
+}
+
+func (this *SessionConfig) IsEnable() bool {
+	return this.MaxEvents > 0 || this.Duration > 0 || this.ExitWithTarget
+}
+
+func (this *ModuleConfig) Parse_Session(gconfig *GlobalConfig) error {
+	this.Session.MaxEvents = gconfig.MaxEvents
+	if gconfig.Duration != "" {
+		duration, err := time.ParseDuration(gconfig.Duration)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse --duration %s failed, err:%v", gconfig.Duration, err))
+		}
+		if duration <= 0 {
+			return errors.New(fmt.Sprintf("--duration %s must be positive", gconfig.Duration))
+		}
+		this.Session.Duration = duration
+	}
+	if gconfig.ExitWithTarget {
+		if len(this.PidWhitelist) == 0 && !this.HasRuntimeTarget() && len(this.UidWhitelist) == 0 {
+			return errors.New("--exit-with-target must work with -p/--pid, -n/--name, -u/--uid, --comm or --exe")
+		}
+		// 进程退出事件来自 perf mmap 模块
+		if !this.SysCallConf.IsEnable() && len(this.StackUprobeConf.Points) == 0 && !this.Crash {
+			return errors.New("--exit-with-target must work with -s/--syscall, -w/--point or --crash")
+		}
+		this.Session.ExitWithTarget = true
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// 堆栈内容过滤 在堆栈解析完成后进行
+// 规则可以是模块名或者符号名 支持通配符 以 ! 开头表示排除
+type StackMatchRule struct {
+	Pattern string
+	Negate  bool
+}
+
+func (this *StackMatchRule) Match(module_path, module, symbol string) bool {
+	if this.Pattern == module_path {
+		return true
+	}
+	if ok, _ := filepath.Match(this.Pattern, module); ok {
+		return true
+	}
+	if symbol == "" {
+		return false
+	}
+	ok, _ := filepath.Match(this.Pattern, symbol)
+	return ok
+}
+
+func (this *StackMatchRule) String() string {
+	if this.Negate {
+		return "!" + this.Pattern
+	}
+	return this.Pattern
+}
+
+type StackMatchConfig struct {
+	Rules []StackMatchRule
+}
+
+func (this *StackMatchConfig) IsEnable() bool {
+	return len(this.Rules) > 0
+}
+
+func (this *StackMatchConfig) String() string {
+	var items []string
+	for _, rule := range this.Rules {
+		items = append(items, rule.String())
+	}
+	return strings.Join(items, ",")
+}
+
+func (this *StackMatchConfig) HasPositive() bool {
+	for _, rule := range this.Rules {
+		if !rule.Negate {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ModuleConfig) Parse_StackMatch(gconfig *GlobalConfig) error {
+	if len(gconfig.StackMatch) == 0 {
+		return nil
+	}
+	if !this.UnwindStack {
+		return errors.New("--stack-match must work with --stack")
+	}
+	for _, value := range gconfig.StackMatch {
+		rule := StackMatchRule{}
+		if strings.HasPrefix(value, "!") {
+			rule.Negate = true
+			value = value[1:]
+		}
+		if value == "" {
+			return errors.New("--stack-match pattern is empty")
+		}
+		if _, err := filepath.Match(value, ""); err != nil {
+			return errors.New(fmt.Sprintf("parse --stack-match %s failed, err:%v", value, err))
+		}
+		rule.Pattern = value
+		this.StackMatch.Rules = append(this.StackMatch.Rules, rule)
+	}
+	return nil
+}
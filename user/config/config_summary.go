@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	SUMMARY_BY_SYSCALL = "syscall"
+	SUMMARY_BY_PID     = "pid"
+	SUMMARY_BY_TID     = "tid"
+)
+
+// 类似 strace -c 的统计模式 不输出单个事件
+// 按 syscall 汇总调用次数、错误次数以及耗时
+type SummaryConfig struct {
+	Enable   bool
+	By       string
+	Interval uint32
+}
+
+func (this *SummaryConfig) IsEnable() bool {
+	return this.Enable
+}
+
+func (this *ModuleConfig) Parse_Summary(gconfig *GlobalConfig) error {
+	if !gconfig.Summary {
+		return nil
+	}
+	if !this.SysCallConf.IsEnable() {
+		return errors.New("--summary must work with -s/--syscall")
+	}
+	if this.Recorder.IsEnable() {
+		return errors.New("--summary can not work with --flight-recorder")
+	}
+	switch gconfig.SummaryBy {
+	case SUMMARY_BY_SYSCALL, SUMMARY_BY_PID, SUMMARY_BY_TID:
+	default:
+		return errors.New(fmt.Sprintf("unknown summary by %s, choose:syscall,pid,tid", gconfig.SummaryBy))
+	}
+	this.Summary.Enable = true
+	this.Summary.By = gconfig.SummaryBy
+	this.Summary.Interval = gconfig.SummaryInterval
+	return nil
+}
@@ -13,6 +13,9 @@ type SyscallPoint struct {
 	Name           string
 	EnterPointArgs []*PointArg
 	ExitPointArgs  []*PointArg
+	CallerLibs     []string
+	CallerMask     uint32
+	Limit          PointLimit
 }
 
 func (this *SyscallPoint) DumpOpList(tag string, op_list []uint32) {
@@ -28,6 +31,9 @@ func (this *SyscallPoint) DumpOpList(tag string, op_list []uint32) {
 func (this *SyscallPoint) GetEnterConfig() SyscallPointOpKeyConfig {
 	config := SyscallPointOpKeyConfig{}
 	config.Signal = 0
+	// 返回时依赖进入时保存的寄存器 所以只需要在进入时按调用来源过滤
+	config.CallerMask = this.CallerMask
+	config.PointLimit = this.Limit
 	for _, point_arg := range this.EnterPointArgs {
 		config.AddPointArg(point_arg)
 	}
@@ -93,14 +99,22 @@ func (this *SyscallPoint) ParsePointJson(buf *bytes.Buffer, point_type uint32) a
 }
 
 func (this *SyscallPoint) ParseExitPoint(buf *bytes.Buffer) string {
+	point_str, _ := this.ParseExitPointWithRet(buf)
+	return point_str
+}
+
+func (this *SyscallPoint) ParseExitPointWithRet(buf *bytes.Buffer) (string, uint64) {
+	// 返回值总是最后一个参数
 	var results []string
+	var ret uint64 = 0
 	for _, point_arg := range this.ExitPointArgs {
 		var ptr argtype.Arg_reg
 		if err := binary.Read(buf, binary.LittleEndian, &ptr); err != nil {
 			panic(err)
 		}
+		ret = ptr.Address
 		arg_fmt := point_arg.Parse(ptr.Address, buf, EBPF_SYS_EXIT)
 		results = append(results, fmt.Sprintf("%s=%s", point_arg.Name, arg_fmt))
 	}
-	return "(" + strings.Join(results, ", ") + ")"
+	return "(" + strings.Join(results, ", ") + ")", ret
 }
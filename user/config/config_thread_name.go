@@ -0,0 +1,47 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// 线程名规则 不含通配符的按名称精确匹配 由 thread_filter 在内核中完成
+// 含有通配符的 比如 OkHttp* pool-* 在用户态匹配 结果按 tid 写入 thread_name_match
+
+func IsThreadNameGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+func ThreadNameGlobs(names []string) []string {
+	var globs []string
+	for _, name := range names {
+		if IsThreadNameGlob(name) {
+			globs = append(globs, name)
+		}
+	}
+	return globs
+}
+
+func MatchThreadName(globs []string, comm string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, comm); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 黑名单优先 与 thread_filter 的检查顺序一致
+func (this *ModuleConfig) MatchThreadNameGlob(comm string) (blacklist bool, whitelist bool) {
+	if MatchThreadName(ThreadNameGlobs(this.TNameBlacklist), comm) {
+		return true, false
+	}
+	if MatchThreadName(ThreadNameGlobs(this.TNameWhitelist), comm) {
+		return false, true
+	}
+	return false, false
+}
+
+func (this *ModuleConfig) HasThreadNameGlob() bool {
+	return len(ThreadNameGlobs(this.TNameWhitelist)) > 0 || len(ThreadNameGlobs(this.TNameBlacklist)) > 0
+}
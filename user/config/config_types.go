@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"stackplz/user/argtype"
+	. "stackplz/user/common"
+	"strconv"
+	"strings"
+)
+
+// 配置文件中 types 部分的声明 用于描述自定义结构体
+// {"name": "my_buf", "fields": [{"name": "len", "type": "uint32"}, {"name": "data", "type": "*buf", "count": "len"}]}
+
+type FieldConfig struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Offset string `json:"offset"`
+	Count  string `json:"count"`
+	Format string `json:"format"`
+}
+
+type TypeConfig struct {
+	Name   string        `json:"name"`
+	Size   string        `json:"size"`
+	Fields []FieldConfig `json:"fields"`
+}
+
+const (
+	TYPE_LAYOUT_NONE uint32 = iota
+	TYPE_LAYOUT_DOING
+	TYPE_LAYOUT_DONE
+)
+
+type TypeResolver struct {
+	configs map[string]*TypeConfig
+	types   map[string]*argtype.ARG_CUSTOM
+	state   map[string]uint32
+}
+
+func alignUp(value, align uint32) uint32 {
+	if align <= 1 {
+		return value
+	}
+	return (value + align - 1) / align * align
+}
+
+func (this *TypeResolver) getStruct(name string) *argtype.ARG_CUSTOM {
+	if at, ok := this.types[name]; ok {
+		return at
+	}
+	at, ok := argtype.FindArgTypeByName(name).(*argtype.ARG_CUSTOM)
+	if !ok {
+		return nil
+	}
+	return at
+}
+
+func (this *TypeResolver) parseField(at *argtype.ARG_CUSTOM, config *FieldConfig) (*argtype.CustomField, error) {
+	field := &argtype.CustomField{}
+	field.Name = config.Name
+	if field.Name == "" {
+		return nil, errors.New(fmt.Sprintf("type %s has field without name", at.GetName()))
+	}
+	type_name := config.Type
+	if strings.HasPrefix(type_name, "*") {
+		field.IsPtr = true
+		type_name = type_name[1:]
+	}
+	if config.Count != "" {
+		count, err := strconv.ParseUint(config.Count, 0, 32)
+		if err == nil {
+			if count == 0 {
+				return nil, errors.New(fmt.Sprintf("field %s.%s count must be greater than 0", at.GetName(), field.Name))
+			}
+			field.Count = uint32(count)
+		} else {
+			// 不是数字则认为是同一结构体中指示元素个数的字段
+			field.CountField = config.Count
+		}
+	}
+	switch type_name {
+	case "str":
+		if field.IsPtr || field.IsArray() {
+			return nil, errors.New(fmt.Sprintf("field %s.%s type str not support pointer or count", at.GetName(), field.Name))
+		}
+		field.Kind = argtype.FIELD_STRING
+	case "std":
+		if field.IsPtr || field.IsArray() {
+			return nil, errors.New(fmt.Sprintf("field %s.%s type std not support pointer or count", at.GetName(), field.Name))
+		}
+		field.Kind = argtype.FIELD_STD
+		field.ElemSize = argtype.PTR_SIZE * 3
+	case "char":
+		field.ElemSize = 1
+		if field.IsArray() {
+			field.Kind = argtype.FIELD_CHAR
+		} else if field.IsPtr {
+			// char* 即字符串
+			field.Kind = argtype.FIELD_STRING
+			field.IsPtr = false
+		} else {
+			field.Kind = argtype.FIELD_NUM
+			field.NumType = argtype.GetArgType(INT8)
+		}
+	case "buf":
+		if !field.IsArray() {
+			return nil, errors.New(fmt.Sprintf("field %s.%s type buf must set count", at.GetName(), field.Name))
+		}
+		field.Kind = argtype.FIELD_BUF
+		field.ElemSize = 1
+	default:
+		if p := this.getStruct(type_name); p != nil {
+			if !field.IsPtr {
+				// 内嵌的结构体需要先确定布局
+				if err := this.layout(type_name); err != nil {
+					return nil, err
+				}
+			}
+			field.Kind = argtype.FIELD_STRUCT
+			field.Struct = p
+			break
+		}
+		p := argtype.FindArgTypeByName(type_name)
+		if p == nil {
+			return nil, errors.New(fmt.Sprintf("field %s.%s unknown type %s", at.GetName(), field.Name, type_name))
+		}
+		if _, ok := p.(argtype.IArgTypeNum); !ok {
+			return nil, errors.New(fmt.Sprintf("field %s.%s unsupported type %s", at.GetName(), field.Name, type_name))
+		}
+		field.Kind = argtype.FIELD_NUM
+		field.ElemSize = p.GetSize()
+		if p.GetTypeIndex() == POINTER {
+			field.ElemSize = argtype.PTR_SIZE
+		}
+		switch config.Format {
+		case "":
+			field.NumType = p
+		case "hex":
+			field.NumType = argtype.R_NUM_HEX(p.GetTypeIndex())
+		default:
+			flags_config := GetFlagsConfig(config.Format)
+			if flags_config == nil {
+				return nil, errors.New(fmt.Sprintf("field %s.%s unsupported format type:%s", at.GetName(), field.Name, config.Format))
+			}
+			field.NumType = argtype.NewNumFlags(p.GetTypeIndex(), flags_config)
+		}
+	}
+	if config.Offset != "" {
+		offset, err := strconv.ParseUint(config.Offset, 0, 32)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("parse field %s.%s offset failed", at.GetName(), field.Name))
+		}
+		field.Offset = uint32(offset)
+	} else {
+		// 没有指定偏移时 按自然对齐紧跟上一个字段
+		field.Offset = alignUp(at.GetEnd(), field.GetAlign())
+	}
+	return field, nil
+}
+
+func (this *TypeResolver) layout(name string) error {
+	config, ok := this.configs[name]
+	if !ok || this.state[name] == TYPE_LAYOUT_DONE {
+		// 之前的配置文件中已经完成注册的类型
+		return nil
+	}
+	if this.state[name] == TYPE_LAYOUT_DOING {
+		return errors.New(fmt.Sprintf("type %s embeds itself, use pointer instead", name))
+	}
+	this.state[name] = TYPE_LAYOUT_DOING
+	at := this.types[name]
+	for i := range config.Fields {
+		field, err := this.parseField(at, &config.Fields[i])
+		if err != nil {
+			return err
+		}
+		at.AddField(field)
+	}
+	if len(at.Fields) == 0 {
+		return errors.New(fmt.Sprintf("type %s has no field", name))
+	}
+	for _, field := range at.Fields {
+		if field.CountField == "" {
+			continue
+		}
+		count_field := at.GetField(field.CountField)
+		if count_field == nil || count_field.Kind != argtype.FIELD_NUM || count_field.IsPtr || count_field.IsArray() {
+			return errors.New(fmt.Sprintf("field %s.%s count must be a number or a number field", name, field.Name))
+		}
+	}
+	size := alignUp(at.GetEnd(), at.Align)
+	if config.Size != "" {
+		value, err := strconv.ParseUint(config.Size, 0, 32)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parse type %s size failed", name))
+		}
+		if uint32(value) < at.GetEnd() {
+			return errors.New(fmt.Sprintf("type %s size %d is smaller than fields end %d", name, value, at.GetEnd()))
+		}
+		size = uint32(value)
+	}
+	if size > MAX_BUF_READ_SIZE {
+		return errors.New(fmt.Sprintf("type %s size %d exceeds %d", name, size, MAX_BUF_READ_SIZE))
+	}
+	at.SetSize(size)
+	this.state[name] = TYPE_LAYOUT_DONE
+	return nil
+}
+
+func RegisterTypes(configs []TypeConfig) error {
+	// 1. 先注册全部类型名 这样字段可以通过指针引用自身或后面声明的类型
+	// 2. 确定各类型的布局 内嵌的结构体会优先处理
+	// 3. 全部布局确定后再生成读取操作
+	resolver := &TypeResolver{}
+	resolver.configs = make(map[string]*TypeConfig)
+	resolver.types = make(map[string]*argtype.ARG_CUSTOM)
+	resolver.state = make(map[string]uint32)
+	var names []string
+	for i := range configs {
+		name := configs[i].Name
+		if name == "" {
+			return errors.New("type name is empty")
+		}
+		if argtype.FindArgTypeByName(name) != nil {
+			return errors.New(fmt.Sprintf("type %s already exists", name))
+		}
+		resolver.configs[name] = &configs[i]
+		resolver.types[name] = argtype.R_CUSTOM_STRUCT(name)
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if err := resolver.layout(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		resolver.types[name].BuildOps()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"stackplz/user/argtype"
 	"strings"
@@ -21,6 +22,11 @@ type UprobeArgs struct {
 	ExitRead     bool
 	ExitOffset   uint64
 	KillSignal   uint32
+	CallerLibs   []string
+	CallerMask   uint32
+	Limit        PointLimit
+	// 32 位库中的 thumb 函数
+	Thumb bool
 }
 
 func (this *UprobeArgs) GetExitPoint(index int) *UprobeArgs {
@@ -42,10 +48,31 @@ func (this *UprobeArgs) GetExitPoint(index int) *UprobeArgs {
 	return point
 }
 
+func (this *UprobeArgs) IsExitPoint() bool {
+	// 返回处的 hook 点从进入时保存的寄存器取值
+	return this.EnterKey != 0 && this.EnterKey != this.Index+1
+}
+
+// 以返回值作为读取大小时 hook 点需要位于返回处
+// 可以是 -w 中给定的返回偏移 也可以直接 hook 在返回处的偏移上 函数入口处没有返回值
+func (this *UprobeArgs) CheckRetValue() error {
+	if this.ExitRead || this.Symbol == "" || this.Offset != 0 {
+		return nil
+	}
+	for _, point_arg := range this.PointArgs {
+		if point_arg.UseRetValue() {
+			return errors.New(fmt.Sprintf("%s of %s requires a return offset or a hook point at the return site", point_arg.Name, this.Name))
+		}
+	}
+	return nil
+}
+
 func (this *UprobeArgs) GetConfig() UprobePointOpKeyConfig {
 	config := UprobePointOpKeyConfig{}
 	config.EnterKey = this.EnterKey
 	config.Signal = this.KillSignal
+	config.CallerMask = this.CallerMask
+	config.PointLimit = this.Limit
 	for _, point_arg := range this.PointArgs {
 		config.AddPointArg(point_arg)
 	}
@@ -75,7 +102,15 @@ func (this *UprobeArgs) GetPath() string {
 
 func (this *UprobeArgs) String() string {
 	if this.Symbol == "" {
-		return fmt.Sprintf("[%s + 0x%x] %s", this.GetPath(), this.Offset, this.ArgsStr)
+		info := fmt.Sprintf("[%s + 0x%x]", this.GetPath(), this.Offset)
+		// 符号已经被提前解析为偏移
+		if !strings.HasPrefix(this.Name, "0x") {
+			info += " sym:" + this.Name
+		}
+		if this.Thumb {
+			info += " thumb"
+		}
+		return fmt.Sprintf("%s %s", info, this.ArgsStr)
 	} else {
 		return fmt.Sprintf("[%s] -> sym:%s off:0x%x %s", this.GetPath(), this.Symbol, this.Offset, this.ArgsStr)
 	}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"stackplz/user/util"
+	"strconv"
+)
+
+// --user 指定应用所在的用户 默认为主用户 0
+// 工作资料和多用户下的应用 uid = userId * 100000 + appId
+func (this *ModuleConfig) Parse_User(gconfig *GlobalConfig) error {
+	return this.ParseUser(gconfig.User, util.DEFAULT_USER_DIR)
+}
+
+// user_dir 下每个子目录对应一个用户 模拟测试时可以指定其他目录
+func (this *ModuleConfig) ParseUser(user, user_dir string) error {
+	if user == "all" {
+		users, err := util.ListUsers(user_dir)
+		if err != nil {
+			return errors.New(fmt.Sprintf("list users failed, err:%v", err))
+		}
+		if len(users) == 0 {
+			users = []uint32{0}
+		}
+		this.TraceUser = util.TRACE_USER_ALL
+		this.Users = users
+		return nil
+	}
+	value, err := strconv.ParseUint(user, 10, 32)
+	if err != nil {
+		return errors.New(fmt.Sprintf("parse --user %s failed, must be user id or all", user))
+	}
+	this.TraceUser = uint32(value)
+	this.Users = []uint32{uint32(value)}
+	return nil
+}
+
+func (this *ModuleConfig) MatchUser(uid uint32) bool {
+	if this.TraceUser == util.TRACE_USER_ALL {
+		return true
+	}
+	return util.GetUserId(uid) == this.TraceUser
+}
+
+// 包名在各个目标用户下的 uid system 应用的 uid 与系统进程相同 不加入 uid 白名单
+func (this *ModuleConfig) ResolvePackageUids(pis *util.PackageInfos, pkg_name string) ([]uint32, error) {
+	return pis.FindUidsByName(pkg_name, this.Users)
+}
@@ -32,15 +32,19 @@ func (this *BaseConfig) Info() string {
 }
 
 type SyscallPointOpKeyConfig struct {
-	EnterKey  uint32
-	Signal    uint32
+	EnterKey   uint32
+	Signal     uint32
+	CallerMask uint32
+	PointLimit
 	OpCount   uint32
 	OpKeyList [SYSCALL_MAX_OP_COUNT]uint32
 }
 
 type UprobePointOpKeyConfig struct {
-	EnterKey  uint32
-	Signal    uint32
+	EnterKey   uint32
+	Signal     uint32
+	CallerMask uint32
+	PointLimit
 	OpCount   uint32
 	OpKeyList [STACK_MAX_OP_COUNT]uint32
 }
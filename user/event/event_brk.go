@@ -5,23 +5,154 @@ import (
     "encoding/binary"
     "fmt"
     "stackplz/user/common"
+    "stackplz/user/config"
     "stackplz/user/util"
+    "strings"
+    "sync"
 )
 
 var hit_count uint32 = 0
 
+// 写断点命中时 记录被监视内存上一次的值 用于输出 old/new
+var watch_lock sync.Mutex
+var watch_value []byte
+
 type BrkEvent struct {
     ContextEvent
     EventAddr uint64
     UUID      string
+    ArgStr    string
+    WatchStr  string
+    Captured  bool
 }
 
 func (this *BrkEvent) String() (s string) {
-    s = fmt.Sprintf("[%s] event_addr:0x%x hit_count:%d", this.GetUUID(), this.EventAddr, hit_count)
+    s = fmt.Sprintf("[%s] event_addr:%s hit_count:%d", this.GetUUID(), this.GetAddrInfo(), hit_count)
+    if this.ArgStr != "" {
+        s += " " + this.ArgStr
+    }
+    if this.WatchStr != "" {
+        s += " " + this.WatchStr
+    }
     s = this.GetStackTrace(s)
     return s
 }
 
+func (this *BrkEvent) IsWatchWrite() bool {
+    return !this.mconf.BrkKernel && this.mconf.BrkType&util.HW_BREAKPOINT_W != 0
+}
+
+func (this *BrkEvent) readWatchValue() []byte {
+    if this.GetPid() == 0 {
+        return nil
+    }
+    mem := util.NewProcMemReader(this.GetPid())
+    data, err := mem.ReadMemory(this.mconf.BrkAddr, uint32(this.mconf.BrkLen))
+    if err != nil {
+        return nil
+    }
+    return data
+}
+
+func (this *BrkEvent) InitWatchValue() {
+    // 在断点生效之前先记录一次 第一次命中时才有 old 可以输出
+    if !this.IsWatchWrite() {
+        return
+    }
+    watch_lock.Lock()
+    defer watch_lock.Unlock()
+    watch_value = this.readWatchValue()
+}
+
+func (this *BrkEvent) ParseWatchValue() {
+    // 在读取到事件时调用 这里读取到的是写入完成之后的值
+    this.WatchStr = ""
+    if !this.IsWatchWrite() {
+        return
+    }
+    watch_lock.Lock()
+    defer watch_lock.Unlock()
+    new_value := this.readWatchValue()
+    fmt_value := func(data []byte) string {
+        if data == nil {
+            return "?"
+        }
+        return fmt.Sprintf("%x", data)
+    }
+    this.WatchStr = fmt.Sprintf("old=%s new=%s", fmt_value(watch_value), fmt_value(new_value))
+    watch_value = new_value
+}
+
+func (this *BrkEvent) ParseArgs(regs []uint64, mem config.IMemReader) {
+    // 断点命中时没有 eBPF 程序参与 所以在用户态按同样的 op 读取参数
+    this.ArgStr = ""
+    if len(this.mconf.BrkArgs) == 0 {
+        return
+    }
+    var ptr_size uint32 = 8
+    if this.mconf.Is32Bit {
+        ptr_size = 4
+    }
+    result, err := config.SimulatePointArgs(this.mconf.BrkArgs, regs, mem, ptr_size, config.EBPF_UPROBE_ENTER, 0)
+    if err != nil {
+        this.logger.Printf("BrkEvent.ParseArgs failed, err:%v", err)
+        if result == nil {
+            return
+        }
+    }
+    var results []string
+    for i, arg_fmt := range result.Args {
+        results = append(results, fmt.Sprintf("%s=%s", this.mconf.BrkArgs[i].Name, arg_fmt))
+    }
+    this.ArgStr = "(" + strings.Join(results, ", ") + ")"
+}
+
+func (this *BrkEvent) hitMemReader() config.IMemReader {
+    // 有栈数据时 栈上的内容以采样时的为准
+    if this.UnwindBuffer == nil || len(this.UnwindBuffer.Data) == 0 {
+        return util.NewProcMemReader(this.GetPid())
+    }
+    sp_index := common.PerfRegSP
+    if this.UnwindBuffer.Abi == PERF_SAMPLE_REGS_ABI_32 {
+        sp_index = common.REG_ARM_SP
+    }
+    return util.NewSnapshotMemReader(this.GetPid(), this.UnwindBuffer.Regs[sp_index], this.UnwindBuffer.Data)
+}
+
+func (this *BrkEvent) readHit() {
+    var regs []uint64
+    if this.rec.ExtraOptions.UnwindStack {
+        regs = this.UnwindBuffer.Regs
+    } else {
+        regs = this.RegsBuffer.Regs
+    }
+    this.ParseArgs(regs, this.hitMemReader())
+    this.ParseWatchValue()
+    this.Captured = true
+}
+
+func (this *BrkEvent) CaptureHit() {
+    // 硬件断点命中后目标进程会继续运行 等到 processor 解析事件时内存可能早已改变
+    // 所以在读取到事件时立即读取参数和被监视的内存 后续解析时直接使用结果
+    if this.ParseHead() != nil || this.Pid != this.GetPid() {
+        return
+    }
+    if err := this.parseRegs(); err != nil {
+        this.logger.Printf("BrkEvent.CaptureHit failed, err:%v", err)
+        return
+    }
+    this.readHit()
+}
+
+func (this *BrkEvent) GetAddrInfo() string {
+    // 能解析出符号就按 symbol+off 的形式输出
+    sym_info, ok := maps_helper.GetSymbol(this.GetPid(), this.EventAddr)
+    if !ok {
+        return fmt.Sprintf("0x%x", this.EventAddr)
+    }
+    return fmt.Sprintf("0x%x <%s>", this.EventAddr, sym_info)
+}
+
 func (this *BrkEvent) GetUUID() string {
     return fmt.Sprintf("%d|%d", this.Pid, this.Tid)
 }
@@ -64,7 +195,7 @@ func (this *BrkEvent) ParseEvent() (IEventStruct, error) {
     return this, nil
 }
 
-func (this *BrkEvent) ParseContext() (err error) {
+func (this *BrkEvent) ParseHead() (err error) {
     this.EventId = HW_BREAKPOINT
     this.buf = bytes.NewBuffer(this.rec.RawSample)
     if err = binary.Read(this.buf, binary.LittleEndian, &this.Pid); err != nil {
@@ -79,7 +210,34 @@ func (this *BrkEvent) ParseContext() (err error) {
     if err = binary.Read(this.buf, binary.LittleEndian, &this.EventAddr); err != nil {
         return err
     }
+    return nil
+}
+
+func (this *BrkEvent) parseRegs() error {
+    if this.rec.ExtraOptions.UnwindStack {
+        // 读取完整的栈数据和寄存器数据 并解析为 UnwindBuf 结构体
+        this.UnwindBuffer = &UnwindBuf{}
+        return this.UnwindBuffer.ParseContext(this.buf)
+    } else if this.rec.ExtraOptions.ShowRegs {
+        return this.RegsBuffer.ParseContext(this.buf)
+    }
+    return nil
+}
+
+func (this *BrkEvent) ParseContext() (err error) {
+    if err = this.ParseHead(); err != nil {
+        return err
+    }
+    if this.Pid != this.GetPid() {
+        return nil
+    }
+    if err = this.parseRegs(); err != nil {
+        panic(fmt.Sprintf("UnwindStack ParseContext failed, err:%v", err))
+    }
     this.ParseContextStack()
+    if !this.Captured {
+        this.readHit()
+    }
 
     return nil
 }
@@ -102,12 +260,6 @@ func (this *BrkEvent) GetPid() uint32 {
 func (this *BrkEvent) ParseContextStack() {
     this.Stackinfo = ""
     if this.rec.ExtraOptions.UnwindStack {
-        // 读取完整的栈数据和寄存器数据 并解析为 UnwindBuf 结构体
-        this.UnwindBuffer = &UnwindBuf{}
-        err := this.UnwindBuffer.ParseContext(this.buf)
-        if err != nil {
-            panic(fmt.Sprintf("UnwindStack ParseContext failed, err:%v", err))
-        }
         if this.mconf.ManualStack {
             CacheMaps(this.Pid)
             maps_helper.SetLogger(this.logger)
@@ -133,11 +285,6 @@ func (this *BrkEvent) ParseContextStack() {
             return
         }
         this.Stackinfo = ParseStack(content, this.GetOpt(), this.UnwindBuffer)
-    } else if this.rec.ExtraOptions.ShowRegs {
-        err := this.RegsBuffer.ParseContext(this.buf)
-        if err != nil {
-            panic(fmt.Sprintf("UnwindStack ParseContext failed, err:%v", err))
-        }
     }
     return
 }
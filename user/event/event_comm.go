@@ -48,6 +48,7 @@ func (this *CommEvent) ParseContext() (err error) {
         return err
     }
     this.Comm = util.B2STrim(tmp)
+    UpdateThreadName(this.Pid, this.Tid, this.Comm)
     if this.mconf.Debug {
         this.logger.Printf(this.String())
     }
@@ -29,7 +29,7 @@ func ReadRegs(abi uint64, buf *bytes.Buffer) []uint64 {
         }
         return regs
     case PERF_SAMPLE_REGS_ABI_64:
-        regs := make([]uint64, common.REG_ARM64_MAX)
+        regs := make([]uint64, common.PerfRegsCount)
         if err := binary.Read(buf, binary.LittleEndian, &regs); err != nil {
             panic(err)
         }
@@ -144,6 +144,8 @@ func (this *ContextEvent) ParseEvent() (IEventStruct, error) {
             return nil, nil
         case UPROBE_ENTER:
             return nil, nil
+        case SIGNAL_DELIVER, SIGNAL_GENERATE, SCHED_PROCESS_EXEC, SCHED_PROCESS_EXIT:
+            return nil, nil
         default:
             this.logger.Printf("ContextEvent.ParseEvent() unsupported EventId:%d\n", EventId)
             this.logger.Printf("ContextEvent.ParseEvent() PERF_RECORD_SAMPLE RawSample:\n" + util.HexDump(this.rec.RawSample, util.COLORRED))
@@ -221,11 +223,11 @@ func (this *ContextEvent) GetRegsString() string {
     } else {
         if this.rec.ExtraOptions.UnwindStack {
             for reg_index, reg_value := range this.UnwindBuffer.Regs {
-                result = append(result, fmt.Sprintf("%s=0x%x", common.RegsIdxMap[uint32(reg_index)], reg_value))
+                result = append(result, fmt.Sprintf("%s=0x%x", common.PerfRegsIdxMap[uint32(reg_index)], reg_value))
             }
         } else {
             for reg_index, reg_value := range this.RegsBuffer.Regs {
-                result = append(result, fmt.Sprintf("%s=0x%x", common.RegsIdxMap[uint32(reg_index)], reg_value))
+                result = append(result, fmt.Sprintf("%s=0x%x", common.PerfRegsIdxMap[uint32(reg_index)], reg_value))
             }
         }
     }
@@ -233,18 +235,19 @@ func (this *ContextEvent) GetRegsString() string {
 }
 
 func (this *ContextEvent) GetRegValue(reg_name string) uint64 {
+    regs_name_map := common.PerfRegsNameMap
     if this.mconf.Is32Bit {
-        if this.rec.ExtraOptions.UnwindStack {
-            return this.UnwindBuffer.Regs[common.RegsArmNameMap[reg_name]]
-        } else {
-            return this.RegsBuffer.Regs[common.RegsArmNameMap[reg_name]]
-        }
+        regs_name_map = common.RegsArmNameMap
+    }
+    // 当前架构没有这个寄存器 比如 x86 没有 lr
+    reg_index, ok := regs_name_map[reg_name]
+    if !ok {
+        return 0
+    }
+    if this.rec.ExtraOptions.UnwindStack {
+        return this.UnwindBuffer.Regs[reg_index]
     } else {
-        if this.rec.ExtraOptions.UnwindStack {
-            return this.UnwindBuffer.Regs[common.RegsNameMap[reg_name]]
-        } else {
-            return this.RegsBuffer.Regs[common.RegsNameMap[reg_name]]
-        }
+        return this.RegsBuffer.Regs[reg_index]
     }
 }
 
@@ -277,7 +280,7 @@ func (this *ContextEvent) GetStackTrace(s string) string {
 
 func (this *ContextEvent) GetOpt() *UnwindOption {
     opt := &UnwindOption{}
-    opt.RegMask = (1 << common.REG_ARM64_MAX) - 1
+    opt.RegMask = common.PerfRegMask
     if this.mconf.Is32Bit {
         opt.RegMask = (1 << common.REG_ARM_MAX) - 1
     }
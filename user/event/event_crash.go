@@ -0,0 +1,221 @@
+package event
+
+import (
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "stackplz/user/common"
+    "stackplz/user/util"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+
+    "golang.org/x/sys/unix"
+)
+
+// https://cs.android.com/android/platform/superproject/+/master:bionic/libc/kernel/uapi/asm-generic/siginfo.h
+var si_code_names = map[uint32]map[int32]string{
+    uint32(syscall.SIGSEGV): {1: "SEGV_MAPERR", 2: "SEGV_ACCERR", 3: "SEGV_BNDERR", 4: "SEGV_PKUERR", 8: "SEGV_MTEAERR", 9: "SEGV_MTESERR"},
+    uint32(syscall.SIGBUS):  {1: "BUS_ADRALN", 2: "BUS_ADRERR", 3: "BUS_OBJERR"},
+    uint32(syscall.SIGILL):  {1: "ILL_ILLOPC", 2: "ILL_ILLOPN", 3: "ILL_ILLADR", 4: "ILL_ILLTRP", 5: "ILL_PRVOPC", 6: "ILL_PRVREG", 7: "ILL_COPROC", 8: "ILL_BADSTK"},
+    uint32(syscall.SIGTRAP): {1: "TRAP_BRKPT", 2: "TRAP_TRACE", 3: "TRAP_BRANCH", 4: "TRAP_HWBKPT"},
+}
+
+var si_code_common_names = map[int32]string{
+    0:  "SI_USER",
+    -1: "SI_QUEUE",
+    -6: "SI_TKILL",
+    0x80: "SI_KERNEL",
+}
+
+type CrashEvent struct {
+    ContextEvent
+    Sig        uint32
+    SiCode     int32
+    FaultAddr  uint64
+    MapsInfo   string
+    ReportPath string
+    duplicated bool
+}
+
+// 线程发给自己的信号在 signal_generate 时已经记录 之后的 signal_deliver 是重复的
+var crash_generated = make(map[uint64]bool)
+var crash_generated_lock sync.Mutex
+
+func crashKey(tid, sig uint32) uint64 {
+    return uint64(tid)<<32 | uint64(sig)
+}
+
+func markCrashGenerated(tid, sig uint32) {
+    crash_generated_lock.Lock()
+    defer crash_generated_lock.Unlock()
+    crash_generated[crashKey(tid, sig)] = true
+}
+
+func takeCrashGenerated(tid, sig uint32) bool {
+    crash_generated_lock.Lock()
+    defer crash_generated_lock.Unlock()
+    key := crashKey(tid, sig)
+    if !crash_generated[key] {
+        return false
+    }
+    delete(crash_generated, key)
+    return true
+}
+
+func init() {
+    // 信号没有投递线程就退出了
+    AddExitHook(func(pid, tid uint32) {
+        crash_generated_lock.Lock()
+        defer crash_generated_lock.Unlock()
+        for key := range crash_generated {
+            if uint32(key>>32) == tid {
+                delete(crash_generated, key)
+            }
+        }
+    })
+}
+
+func (this *CrashEvent) DumpRecord() bool {
+    return this.mconf.DumpRecord(common.CRASH_EVENT, &this.rec)
+}
+
+func (this *CrashEvent) ParseEvent() (data_e IEventStruct, err error) {
+    // 数据不完整时 ReadArg 等会 panic 崩溃事件不应该让 stackplz 自身退出
+    defer func() {
+        if r := recover(); r != nil {
+            data_e = nil
+            err = errors.New(fmt.Sprintf("CrashEvent sample is truncated, err:%v", r))
+        }
+    }()
+    data_e, err = this.ContextEvent.ParseEvent()
+    if err != nil {
+        return nil, err
+    }
+    if data_e == nil {
+        if err := this.ParseContext(); err != nil {
+            return nil, errors.New(fmt.Sprintf("CrashEvent.ParseContext() err:%v", err))
+        }
+        if this.duplicated {
+            return nil, nil
+        }
+        return this, nil
+    }
+    return data_e, nil
+}
+
+func (this *CrashEvent) ParseContext() (err error) {
+    if this.EventId != SIGNAL_DELIVER && this.EventId != SIGNAL_GENERATE {
+        return errors.New(fmt.Sprintf("unexpected EventId:%d", this.EventId))
+    }
+    this.ReadArg(&this.Sig)
+    this.ReadArg(&this.SiCode)
+    this.ReadArg(&this.FaultAddr)
+    this.ParsePadding()
+    if this.EventId == SIGNAL_GENERATE {
+        markCrashGenerated(this.Tid, this.Sig)
+    } else if takeCrashGenerated(this.Tid, this.Sig) {
+        this.duplicated = true
+        return nil
+    }
+    // 进程随时可能退出 尽早保存 maps
+    content, err := util.ReadMapsByPid(this.Pid)
+    if err != nil {
+        this.MapsInfo = fmt.Sprintf("maps unavailable, err:%v", err)
+    } else {
+        this.MapsInfo = content
+    }
+    err = this.ParseContextStack()
+    if err != nil {
+        return errors.New(fmt.Sprintf("ParseContextStack err:%v", err))
+    }
+    this.WriteReport()
+    return nil
+}
+
+func (this *CrashEvent) GetSigName() string {
+    return fmt.Sprintf("%s(%d)", unix.SignalName(syscall.Signal(this.Sig)), this.Sig)
+}
+
+func (this *CrashEvent) GetSiCodeName() string {
+    if names, ok := si_code_names[this.Sig]; ok {
+        if name, ok := names[this.SiCode]; ok {
+            return name
+        }
+    }
+    if name, ok := si_code_common_names[this.SiCode]; ok {
+        return name
+    }
+    return fmt.Sprintf("%d", this.SiCode)
+}
+
+func (this *CrashEvent) GetAddrInfo(addr uint64) string {
+    sym_info, ok := maps_helper.GetSymbol(this.Pid, addr)
+    if !ok {
+        return fmt.Sprintf("0x%x", addr)
+    }
+    return fmt.Sprintf("0x%x <%s>", addr, sym_info)
+}
+
+func (this *CrashEvent) WriteReport() {
+    // 每次崩溃单独生成一份完整的报告
+    var lines []string
+    lines = append(lines, "==== stackplz crash report ====")
+    lines = append(lines, fmt.Sprintf("time: %s", time.Now().Format("2006-01-02 15:04:05")))
+    lines = append(lines, fmt.Sprintf("pid: %d, tid: %d, uid: %d, comm: %s", this.Pid, this.Tid, this.Uid, util.B2STrim(this.Comm[:])))
+    lines = append(lines, fmt.Sprintf("signal: %s, code: %s, fault addr: %s", this.GetSigName(), this.GetSiCodeName(), this.GetAddrInfo(this.FaultAddr)))
+    lines = append(lines, fmt.Sprintf("pc: %s", this.GetAddrInfo(this.GetRegValue("pc"))))
+    if common.PerfRegLR < common.PerfRegsCount || this.mconf.Is32Bit {
+        lines = append(lines, fmt.Sprintf("lr: %s", this.GetAddrInfo(this.GetRegValue("lr"))))
+    }
+    lines = append(lines, "")
+    lines = append(lines, "Regs:")
+    lines = append(lines, this.GetRegsString())
+    lines = append(lines, "")
+    lines = append(lines, "Backtrace:")
+    lines = append(lines, this.Stackinfo)
+    lines = append(lines, "")
+    lines = append(lines, "Maps:")
+    lines = append(lines, this.MapsInfo)
+
+    if err := os.MkdirAll(this.mconf.CrashDir, 0755); err != nil {
+        this.logger.Printf("create crash dir %s failed, err:%v", this.mconf.CrashDir, err)
+        return
+    }
+    report_name := fmt.Sprintf("crash_%d_%d_%d.txt", this.Pid, this.Tid, this.Ts)
+    this.ReportPath = filepath.Join(this.mconf.CrashDir, report_name)
+    err := ioutil.WriteFile(this.ReportPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+    if err != nil {
+        this.logger.Printf("write crash report %s failed, err:%v", this.ReportPath, err)
+        this.ReportPath = ""
+    }
+}
+
+func (this *CrashEvent) GetUUID() string {
+    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, FormatComm(this.Tid, util.B2STrim(this.Comm[:])))
+    if this.mconf.ShowTime {
+        s = fmt.Sprintf("%d|%s", this.Ts, s)
+    }
+    if this.mconf.ShowUid {
+        s = fmt.Sprintf("%d|%s", this.Uid, s)
+    }
+    return s
+}
+
+func (this *CrashEvent) String() string {
+    s := fmt.Sprintf("[%s] crash %s code:%s fault_addr:%s", this.GetUUID(), this.GetSigName(), this.GetSiCodeName(), this.GetAddrInfo(this.FaultAddr))
+    s += fmt.Sprintf(" pc:%s", this.GetAddrInfo(this.GetRegValue("pc")))
+    if this.ReportPath != "" {
+        s += fmt.Sprintf(" report:%s", this.ReportPath)
+    }
+    s = this.GetStackTrace(s)
+    return s
+}
+
+func (this *CrashEvent) Clone() IEventStruct {
+    event := new(CrashEvent)
+    return event
+}
@@ -0,0 +1,108 @@
+package event
+
+import (
+    "bytes"
+    "fmt"
+    "stackplz/user/common"
+    "stackplz/user/util"
+    "strings"
+    "sync"
+)
+
+type ExecEvent struct {
+    ContextEvent
+    OldPid   uint32
+    Filename string
+    OldComm  string
+    Argv     []string
+}
+
+func (this *ExecEvent) DumpRecord() bool {
+    return this.mconf.DumpRecord(common.EXEC_EVENT, &this.rec)
+}
+
+func (this *ExecEvent) ParseEvent() (IEventStruct, error) {
+    data_e, err := this.ContextEvent.ParseEvent()
+    if err != nil {
+        panic("...")
+    }
+    if data_e == nil {
+        if err := this.ParseContext(); err != nil {
+            panic(fmt.Sprintf("ExecEvent.ParseContext() err:%v", err))
+        }
+        return this, nil
+    }
+    return data_e, nil
+}
+
+func (this *ExecEvent) readBytesArg() []byte {
+    // [index][size][bytes]
+    var index uint8
+    var size uint32
+    this.ReadValue(&index)
+    this.ReadValue(&size)
+    payload := make([]byte, size)
+    this.ReadValue(&payload)
+    return payload
+}
+
+func (this *ExecEvent) ParseContext() (err error) {
+    if this.EventId != SCHED_PROCESS_EXEC {
+        panic(fmt.Sprintf("ExecEvent.ParseContext() failed, EventId:%d", this.EventId))
+    }
+    this.ReadArg(&this.OldPid)
+    // 字符串的 size 包含末尾的 \0
+    this.Filename = util.B2STrim(this.readBytesArg())
+    this.OldComm = util.B2STrim(this.readBytesArg())
+    argv := bytes.TrimRight(this.readBytesArg(), "\x00")
+    this.Argv = nil
+    if len(argv) > 0 {
+        this.Argv = strings.Split(string(argv), "\x00")
+    }
+    this.ParsePadding()
+
+    // 进程映像已经改变 之前记录的 maps 全部失效
+    CacheMaps(this.Pid)
+    exec_hooks_lock.Lock()
+    hooks := exec_hooks
+    exec_hooks_lock.Unlock()
+    for _, hook := range hooks {
+        hook(this)
+    }
+    return nil
+}
+
+func (this *ExecEvent) GetUUID() string {
+    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, FormatComm(this.Tid, util.B2STrim(this.Comm[:])))
+    if this.mconf.ShowTime {
+        s = fmt.Sprintf("%d|%s", this.Ts, s)
+    }
+    if this.mconf.ShowUid {
+        s = fmt.Sprintf("%d|%s", this.Uid, s)
+    }
+    return s
+}
+
+func (this *ExecEvent) String() string {
+    s := fmt.Sprintf("[%s] exec %s argv:%q comm:%s->%s", this.GetUUID(), this.Filename, this.Argv, this.OldComm, util.B2STrim(this.Comm[:]))
+    if this.OldPid != this.Tid {
+        // 非主线程执行 execve 时线程 id 会变为进程 id
+        s += fmt.Sprintf(" old_tid:%d", this.OldPid)
+    }
+    return s
+}
+
+func (this *ExecEvent) Clone() IEventStruct {
+    event := new(ExecEvent)
+    return event
+}
+
+// 需要感知进程映像变化的功能通过这里注册回调 比如重新计算 --caller 的地址范围
+var exec_hooks []func(event *ExecEvent)
+var exec_hooks_lock sync.Mutex
+
+func AddExecHook(hook func(event *ExecEvent)) {
+    exec_hooks_lock.Lock()
+    defer exec_hooks_lock.Unlock()
+    exec_hooks = append(exec_hooks, hook)
+}
@@ -6,8 +6,28 @@ import (
     "encoding/json"
     "fmt"
     "stackplz/user/config"
+    "sync"
 )
 
+// 进程或线程退出时需要清理的记录通过这里注册回调 比如 --caller 的地址范围
+var exit_hooks []func(pid, tid uint32)
+var exit_hooks_lock sync.Mutex
+
+func AddExitHook(hook func(pid, tid uint32)) {
+    exit_hooks_lock.Lock()
+    defer exit_hooks_lock.Unlock()
+    exit_hooks = append(exit_hooks, hook)
+}
+
+func callExitHooks(pid, tid uint32) {
+    exit_hooks_lock.Lock()
+    hooks := exit_hooks
+    exit_hooks_lock.Unlock()
+    for _, hook := range hooks {
+        hook(pid, tid)
+    }
+}
+
 type ExitEvent struct {
     CommonEvent
     config.ExitFields
@@ -50,6 +70,8 @@ func (this *ExitEvent) ParseContext() (err error) {
     this.ReadValue(&this.Tid)
     this.ReadValue(&this.Ptid)
     this.ReadValue(&this.Time)
+    RemoveThreadName(this.Pid, this.Tid)
+    callExitHooks(this.Pid, this.Tid)
     if this.mconf.Debug {
         this.logger.Printf(this.String())
     }
@@ -48,6 +48,8 @@ func (this *ForkEvent) ParseContext() (err error) {
     this.ReadValue(&this.Tid)
     this.ReadValue(&this.Ptid)
     this.ReadValue(&this.Time)
+    // 新线程继承创建者的线程名
+    ForkThreadName(this.Pid, this.Tid, this.Ppid, this.Ptid)
     if this.mconf.Debug {
         this.logger.Printf(this.String())
     }
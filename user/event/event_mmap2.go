@@ -196,16 +196,20 @@ func (this *MapsHelper) GetStack(pid uint32, ubuf *UnwindBuf) (info string, err
 
     // perf_output_sample_ustack dump获取到的栈空间数据 起始地址就是 sp
     stack_buf := bytes.NewReader(ubuf.Data[:])
-    fp := ubuf.Regs[common.REG_ARM64_X29]
-    lr := ubuf.Regs[common.REG_ARM64_LR]
-    sp := ubuf.Regs[common.REG_ARM64_SP]
-    pc := ubuf.Regs[common.REG_ARM64_PC]
+    // x86 的栈帧布局同样是 [fp] = 上一层 fp [fp+8] = 返回地址
+    fp := ubuf.Regs[common.PerfRegFP]
+    sp := ubuf.Regs[common.PerfRegSP]
+    pc := ubuf.Regs[common.PerfRegPC]
     // 栈解析结果
     // var stack_arr []uint64
     var stack_infos []string
     // stack_arr = append(stack_arr, pc)
     stack_infos = append(stack_infos, this.GetRegionInfo(pid_maps, pc))
-    stack_infos = append(stack_infos, this.GetRegionInfo(pid_maps, lr))
+    // 没有 lr 的架构 返回地址在栈上 由下面的循环得到
+    if common.PerfRegLR < common.PerfRegsCount {
+        lr := ubuf.Regs[common.PerfRegLR]
+        stack_infos = append(stack_infos, this.GetRegionInfo(pid_maps, lr))
+    }
     // 奇怪 这里竟然没有 sp 所在的map信息
     // sp_region := this.GetRegion(pid_maps, sp)
     // this.logger.Printf("start:0x%x end:0x%x name:%s\n", sp_region.BaseAddr, sp_region.EndAddr, sp_region.LibName)
@@ -409,6 +413,27 @@ func (this *MapsHelper) GetOffset(pid uint32, addr uint64) (info string) {
     return strings.Join(off_list[:], ",")
 }
 
+func (this *MapsHelper) GetSymbol(pid uint32, addr uint64) (string, bool) {
+    // 内核地址直接查 kallsyms 用户态地址先定位所在库 再查库的符号表
+    if addr&0xffff000000000000 > 0 {
+        return util.FindKallsymsByAddr(addr)
+    }
+    pid_maps, err := this.FindLib(pid)
+    if err != nil {
+        return "", false
+    }
+    region := this.GetRegion(&pid_maps, addr)
+    if region.LibPath == "" {
+        return "", false
+    }
+    offset := region.Off + (addr - region.BaseAddr)
+    sym_info, ok := util.FindElfSymbolByOffset(region.LibPath, offset)
+    if !ok {
+        return fmt.Sprintf("%s+0x%x", region.LibName, offset), true
+    }
+    return fmt.Sprintf("%s!%s", region.LibName, sym_info), true
+}
+
 var maps_helper = NewMapsHelper()
 var maps_lock sync.Mutex
 
@@ -465,9 +490,25 @@ func (this *Mmap2Event) ParseContext() (err error) {
         this.logger.Printf(this.String())
     }
     maps_helper.UpdateMaps(this)
+    hooks_lock.Lock()
+    hooks := mmap_hooks
+    hooks_lock.Unlock()
+    for _, hook := range hooks {
+        hook(this.Pid, this.Filename, this.Prot)
+    }
     return nil
 }
 
+// 需要感知库加载的功能通过这里注册回调 比如 --caller 要随之更新地址范围
+var mmap_hooks []func(pid uint32, lib_path string, prot uint32)
+var hooks_lock sync.Mutex
+
+func AddMmapHook(hook func(pid uint32, lib_path string, prot uint32)) {
+    hooks_lock.Lock()
+    defer hooks_lock.Unlock()
+    mmap_hooks = append(mmap_hooks, hook)
+}
+
 func FindLibInMaps(pid uint32, brk_lib string) (LibInfo, error) {
     var info LibInfo
     pid_maps, err := maps_helper.FindLib(pid)
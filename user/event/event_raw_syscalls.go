@@ -16,6 +16,7 @@ type SyscallEvent struct {
     nr_point     *config.SyscallPoint
     config.SyscallFields
     Stack_str string
+    RetValue  uint64
 }
 
 func (this *SyscallEvent) DumpRecord() bool {
@@ -56,7 +57,10 @@ func (this *SyscallEvent) ParseContext() (err error) {
             this.PointStr = this.nr_point.ParseEnterPoint(this.buf)
         }
     } else if this.EventId == SYSCALL_EXIT {
-        if this.mconf.FmtJson {
+        if this.mconf.Summary.IsEnable() {
+            // 统计模式需要返回值 且不会输出单个事件
+            this.PointStr, this.RetValue = this.nr_point.ParseExitPointWithRet(this.buf)
+        } else if this.mconf.FmtJson {
             this.PointValue = this.nr_point.ParsePointJson(this.buf, config.EBPF_SYS_EXIT)
         } else {
             this.PointStr = this.nr_point.ParseExitPoint(this.buf)
@@ -76,7 +80,7 @@ func (this *SyscallEvent) ParseContext() (err error) {
 }
 
 func (this *SyscallEvent) GetUUID() string {
-    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, util.B2STrim(this.Comm[:]))
+    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, FormatComm(this.Tid, util.B2STrim(this.Comm[:])))
     if this.mconf.ShowTime {
         s = fmt.Sprintf("%d|%s", this.Ts, s)
     }
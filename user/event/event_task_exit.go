@@ -0,0 +1,76 @@
+package event
+
+import (
+    "fmt"
+    "stackplz/user/common"
+    "stackplz/user/util"
+)
+
+// 线程退出 perf 的 PERF_RECORD_EXIT 没有退出码 所以由 sched_process_exit 提供
+type TaskExitEvent struct {
+    ContextEvent
+    ExitCode  uint32
+    GroupDead uint32
+}
+
+func (this *TaskExitEvent) DumpRecord() bool {
+    return this.mconf.DumpRecord(common.TASK_EXIT_EVENT, &this.rec)
+}
+
+func (this *TaskExitEvent) ParseEvent() (IEventStruct, error) {
+    data_e, err := this.ContextEvent.ParseEvent()
+    if err != nil {
+        panic("...")
+    }
+    if data_e == nil {
+        if err := this.ParseContext(); err != nil {
+            panic(fmt.Sprintf("TaskExitEvent.ParseContext() err:%v", err))
+        }
+        return this, nil
+    }
+    return data_e, nil
+}
+
+func (this *TaskExitEvent) ParseContext() (err error) {
+    if this.EventId != SCHED_PROCESS_EXIT {
+        panic(fmt.Sprintf("TaskExitEvent.ParseContext() failed, EventId:%d", this.EventId))
+    }
+    this.ReadArg(&this.ExitCode)
+    this.ReadArg(&this.GroupDead)
+    this.ParsePadding()
+    return nil
+}
+
+// 与 WEXITSTATUS 一致
+func (this *TaskExitEvent) Code() uint32 {
+    return (this.ExitCode >> 8) & 0xff
+}
+
+// 与 WTERMSIG 一致 为 0 表示正常退出
+func (this *TaskExitEvent) Signal() uint32 {
+    return this.ExitCode & 0x7f
+}
+
+func (this *TaskExitEvent) IsProcessExit() bool {
+    return this.GroupDead != 0
+}
+
+func (this *TaskExitEvent) GetUUID() string {
+    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, FormatComm(this.Tid, util.B2STrim(this.Comm[:])))
+    if this.mconf.ShowTime {
+        s = fmt.Sprintf("%d|%s", this.Ts, s)
+    }
+    if this.mconf.ShowUid {
+        s = fmt.Sprintf("%d|%s", this.Uid, s)
+    }
+    return s
+}
+
+func (this *TaskExitEvent) String() string {
+    return fmt.Sprintf("[%s] exit code:%d signal:%d group_dead:%d", this.GetUUID(), this.Code(), this.Signal(), this.GroupDead)
+}
+
+func (this *TaskExitEvent) Clone() IEventStruct {
+    event := new(TaskExitEvent)
+    return event
+}
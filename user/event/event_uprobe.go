@@ -86,7 +86,7 @@ func (this *UprobeEvent) Clone() IEventStruct {
 }
 
 func (this *UprobeEvent) GetUUID() string {
-    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, util.B2STrim(this.Comm[:]))
+    s := fmt.Sprintf("%d|%d|%s", this.Pid, this.Tid, FormatComm(this.Tid, util.B2STrim(this.Comm[:])))
     if this.mconf.ShowTime {
         s = fmt.Sprintf("%d|%s", this.Ts, s)
     }
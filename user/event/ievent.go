@@ -23,6 +23,10 @@ const (
     SYSCALL_EXIT
     UPROBE_ENTER
     HW_BREAKPOINT
+    SIGNAL_DELIVER
+    SCHED_PROCESS_EXEC
+    SCHED_PROCESS_EXIT
+    SIGNAL_GENERATE
 )
 
 type ArgFormatter interface {
@@ -33,6 +37,11 @@ type ArgHexFormatter interface {
     HexFormat() string
 }
 
+// 需要在读取到事件时立即处理的部分 比如硬件断点命中时读取目标进程内存
+type IHitCapture interface {
+    CaptureHit()
+}
+
 type IEventStruct interface {
     String() string
     Clone() IEventStruct
@@ -0,0 +1,169 @@
+package event
+
+import (
+    "fmt"
+    "io/ioutil"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// 记录线程名的变化 线程通过 prctl(PR_SET_NAME) 改名时会产生 CommEvent
+// 原始名称为线程创建时的名称 启动前就存在的线程取启动时 /proc 中的名称 之后创建的线程取创建者的名称
+type ThreadName struct {
+    Pid      uint32
+    Original string
+    Current  string
+}
+
+var thread_names = make(map[uint32]*ThreadName)
+var thread_names_lock sync.Mutex
+
+// 线程名变化时的回调 comm 为空表示线程已经退出
+var thread_name_hooks []func(pid, tid uint32, comm string)
+var thread_name_hooks_lock sync.Mutex
+
+func AddThreadNameHook(hook func(pid, tid uint32, comm string)) {
+    thread_name_hooks_lock.Lock()
+    defer thread_name_hooks_lock.Unlock()
+    thread_name_hooks = append(thread_name_hooks, hook)
+}
+
+func callThreadNameHooks(pid, tid uint32, comm string) {
+    thread_name_hooks_lock.Lock()
+    hooks := thread_name_hooks
+    thread_name_hooks_lock.Unlock()
+    for _, hook := range hooks {
+        hook(pid, tid, comm)
+    }
+}
+
+func readTaskComm(pid, tid uint32) (string, error) {
+    content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/comm", pid, tid))
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(string(content)), nil
+}
+
+func setThreadName(pid, tid uint32, original, comm string) {
+    thread_names_lock.Lock()
+    thread_names[tid] = &ThreadName{pid, original, comm}
+    thread_names_lock.Unlock()
+    callThreadNameHooks(pid, tid, comm)
+}
+
+var scan_thread_names_once sync.Once
+
+// 在开始接收事件之前记录已经存在的线程 之后的改名才能和原始名称区分开
+func ScanThreadNames() {
+    scan_thread_names_once.Do(func() {
+        proc_dirs, err := ioutil.ReadDir("/proc")
+        if err != nil {
+            return
+        }
+        for _, proc_dir := range proc_dirs {
+            pid, err := strconv.ParseUint(proc_dir.Name(), 10, 32)
+            if err != nil {
+                continue
+            }
+            task_dirs, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+            if err != nil {
+                continue
+            }
+            for _, task_dir := range task_dirs {
+                tid, err := strconv.ParseUint(task_dir.Name(), 10, 32)
+                if err != nil {
+                    continue
+                }
+                comm, err := readTaskComm(uint32(pid), uint32(tid))
+                if err != nil || comm == "" {
+                    continue
+                }
+                if _, ok := GetThreadName(uint32(tid)); !ok {
+                    setThreadName(uint32(pid), uint32(tid), comm, comm)
+                }
+            }
+        }
+    })
+}
+
+// 新线程继承创建者的线程名 创建者没有记录时从 /proc 读取
+func ForkThreadName(pid, tid, ppid, ptid uint32) {
+    comm := ""
+    if name, ok := GetThreadName(ptid); ok {
+        comm = name.Current
+    } else if parent_comm, err := readTaskComm(ppid, ptid); err == nil {
+        comm = parent_comm
+    } else if task_comm, err := readTaskComm(pid, tid); err == nil {
+        comm = task_comm
+    }
+    if comm == "" {
+        return
+    }
+    setThreadName(pid, tid, comm, comm)
+}
+
+func UpdateThreadName(pid, tid uint32, comm string) {
+    if comm == "" {
+        return
+    }
+    thread_names_lock.Lock()
+    name, ok := thread_names[tid]
+    if ok {
+        changed := name.Current != comm
+        name.Current = comm
+        thread_names_lock.Unlock()
+        if changed {
+            callThreadNameHooks(pid, tid, comm)
+        }
+        return
+    }
+    thread_names_lock.Unlock()
+    // 没有见过创建的线程 只能以 /proc 中的名称作为原始名称
+    original := comm
+    if task_comm, err := readTaskComm(pid, tid); err == nil && task_comm != "" {
+        original = task_comm
+    }
+    setThreadName(pid, tid, original, comm)
+}
+
+func RemoveThreadName(pid, tid uint32) {
+    thread_names_lock.Lock()
+    _, ok := thread_names[tid]
+    delete(thread_names, tid)
+    thread_names_lock.Unlock()
+    if ok {
+        callThreadNameHooks(pid, tid, "")
+    }
+}
+
+// 回调注册之前已经记录的线程名 通过这里补上
+func GetThreadNames() map[uint32]ThreadName {
+    thread_names_lock.Lock()
+    defer thread_names_lock.Unlock()
+    names := make(map[uint32]ThreadName, len(thread_names))
+    for tid, name := range thread_names {
+        names[tid] = *name
+    }
+    return names
+}
+
+func GetThreadName(tid uint32) (ThreadName, bool) {
+    thread_names_lock.Lock()
+    defer thread_names_lock.Unlock()
+    name, ok := thread_names[tid]
+    if !ok {
+        return ThreadName{}, false
+    }
+    return *name, true
+}
+
+// 事件中的 comm 是触发时的线程名 如果线程改过名 把原始名称也带上
+func FormatComm(tid uint32, comm string) string {
+    name, ok := GetThreadName(tid)
+    if !ok || name.Original == "" || name.Original == comm {
+        return comm
+    }
+    return comm + "(" + name.Original + ")"
+}
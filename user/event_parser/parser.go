@@ -92,6 +92,19 @@ func (this *EventParser) ParseDump(dump_name string) {
 			te = &event.UprobeEvent{}
 		case common.SYSCALL_EVENT:
 			te = &event.SyscallEvent{}
+		case common.CRASH_EVENT:
+			// 崩溃事件总是带有寄存器和栈数据
+			rec.ExtraOptions.UnwindStack = true
+			rec.ExtraOptions.ShowRegs = true
+			te = &event.CrashEvent{}
+		case common.EXEC_EVENT:
+			rec.ExtraOptions.UnwindStack = false
+			rec.ExtraOptions.ShowRegs = false
+			te = &event.ExecEvent{}
+		case common.TASK_EXIT_EVENT:
+			rec.ExtraOptions.UnwindStack = false
+			rec.ExtraOptions.ShowRegs = false
+			te = &event.TaskExitEvent{}
 		default:
 			panic("unknown event...")
 		}
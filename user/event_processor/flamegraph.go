@@ -0,0 +1,178 @@
+package event_processor
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"stackplz/user/event"
+	"stackplz/user/util"
+	"strings"
+	"sync"
+)
+
+// 将每个事件的堆栈归一化为 模块`符号 的形式后聚合
+// 以 hook 点名称作为根 退出时输出折叠栈文本和 svg 火焰图
+
+// #00 pc 000000000004e0b8  /apex/com.android.runtime/lib64/bionic/libc.so (open+24) (BuildId: xxx)
+var unwind_frame_reg = regexp.MustCompile(`^#\d+ pc [[:xdigit:]]+(?: [[:xdigit:]]+)?\s+(\S+)\s*(.*)$`)
+
+// 0x7a8b8c8d8e <libc.so + 0x4e0b8>
+var manual_frame_reg = regexp.MustCompile(`^0x[[:xdigit:]]+ <(.+) \+ (0x[[:xdigit:]]+)>$`)
+var symbol_offset_reg = regexp.MustCompile(`\+\d+$`)
+var build_id_reg = regexp.MustCompile(`\s*\(BuildId: [[:xdigit:]]+\)$`)
+var map_offset_reg = regexp.MustCompile(`^\(offset 0x[[:xdigit:]]+\)\s*`)
+
+type StackFrame struct {
+	Path   string
+	Module string
+	Symbol string
+	Offset string
+}
+
+func (this *StackFrame) String() string {
+	if this.Symbol != "" {
+		return fmt.Sprintf("%s`%s", this.Module, this.Symbol)
+	}
+	if this.Offset != "" {
+		return fmt.Sprintf("%s+%s", this.Module, this.Offset)
+	}
+	return this.Module
+}
+
+func ParseFrame(line string) (StackFrame, bool) {
+	var frame StackFrame
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return frame, false
+	}
+	if match := unwind_frame_reg.FindStringSubmatch(line); match != nil {
+		frame.Path = match[1]
+		frame.Module = filepath.Base(match[1])
+		rest := build_id_reg.ReplaceAllString(match[2], "")
+		rest = map_offset_reg.ReplaceAllString(rest, "")
+		if strings.HasPrefix(rest, "(") && strings.HasSuffix(rest, ")") {
+			frame.Symbol = symbol_offset_reg.ReplaceAllString(rest[1:len(rest)-1], "")
+		}
+		return frame, true
+	}
+	if match := manual_frame_reg.FindStringSubmatch(line); match != nil {
+		frame.Path = match[1]
+		frame.Module = filepath.Base(match[1])
+		frame.Offset = match[2]
+		return frame, true
+	}
+	if strings.HasSuffix(line, "<unknown>") {
+		frame.Module = "[unknown]"
+		return frame, true
+	}
+	return frame, false
+}
+
+func ParseBacktrace(stackinfo string) []StackFrame {
+	var frames []StackFrame
+	for _, line := range strings.Split(stackinfo, "\n") {
+		if frame, ok := ParseFrame(line); ok {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// 返回的顺序为调用者在前
+func NormalizeBacktrace(stackinfo string) []string {
+	var frames []string
+	for _, frame := range ParseBacktrace(stackinfo) {
+		frames = append([]string{frame.String()}, frames...)
+	}
+	return frames
+}
+
+type StackAggregator struct {
+	sync.Mutex
+	prefix       string
+	graph        *util.FlameGraph
+	finally_once sync.Once
+}
+
+var aggregator *StackAggregator
+var aggregator_once sync.Once
+
+func GetStackAggregator(prefix string) *StackAggregator {
+	aggregator_once.Do(func() {
+		aggregator = &StackAggregator{}
+		aggregator.prefix = prefix
+		aggregator.graph = util.NewFlameGraph()
+	})
+	return aggregator
+}
+
+func (this *StackAggregator) parseEvent(e event.IEventStruct) (string, string, bool) {
+	switch v := e.(type) {
+	case *event.SyscallEvent:
+		// 返回时的堆栈与进入时一致 只统计进入
+		if v.EventId != event.SYSCALL_ENTER {
+			return "", "", false
+		}
+		return v.PointName, v.Stackinfo, true
+	case *event.UprobeEvent:
+		return v.ArgName, v.Stackinfo, true
+	}
+	return "", "", false
+}
+
+func (this *StackAggregator) Record(e event.IEventStruct) {
+	point_name, stackinfo, ok := this.parseEvent(e)
+	if !ok || stackinfo == "" {
+		return
+	}
+	frames := NormalizeBacktrace(stackinfo)
+	if len(frames) == 0 {
+		return
+	}
+	stack := append([]string{point_name}, frames...)
+	this.Lock()
+	defer this.Unlock()
+	this.graph.Add(stack, 1)
+}
+
+func (this *StackAggregator) write(logger *log.Logger) error {
+	this.Lock()
+	defer this.Unlock()
+	if this.graph.IsEmpty() {
+		logger.Printf("flamegraph: no stack recorded")
+		return nil
+	}
+	folded_path := this.prefix + ".folded"
+	f, err := os.Create(folded_path)
+	if err != nil {
+		return err
+	}
+	err = this.graph.WriteFolded(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	svg_path := this.prefix + ".svg"
+	f, err = os.Create(svg_path)
+	if err != nil {
+		return err
+	}
+	err = this.graph.WriteSVG(f, "stackplz flamegraph")
+	f.Close()
+	if err != nil {
+		return err
+	}
+	logger.Printf("flamegraph saved to %s and %s", folded_path, svg_path)
+	return nil
+}
+
+func (this *StackAggregator) WriteFinally(logger *log.Logger) {
+	// 多个模块共享 只在退出时输出一次
+	this.finally_once.Do(func() {
+		if err := this.write(logger); err != nil {
+			logger.Printf("write flamegraph failed, err:%v", err)
+		}
+	})
+}
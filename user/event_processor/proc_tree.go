@@ -0,0 +1,380 @@
+package event_processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"stackplz/user/config"
+	"stackplz/user/event"
+	"stackplz/user/util"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// 进程树 由 fork/comm/exit/exec 等生命周期事件构建
+// perf 的 fork/comm/exit 事件没有经过 eBPF 的过滤 只为被追踪的进程建立节点
+// 其他进程只记录创建信息 之后成为追踪目标时使用 比如 zygote 孵化的应用进程
+
+type ExecImage struct {
+	Ts       uint64   `json:"ts"`
+	Filename string   `json:"filename"`
+	Argv     []string `json:"argv"`
+	OldComm  string   `json:"old_comm"`
+}
+
+type ThreadNode struct {
+	Tid        uint32   `json:"tid"`
+	Comm       string   `json:"comm"`
+	Renames    []string `json:"renames,omitempty"`
+	StartNs    uint64   `json:"start_ns,omitempty"`
+	ExitNs     uint64   `json:"exit_ns,omitempty"`
+	Exited     bool     `json:"exited"`
+	ExitCode   uint32   `json:"exit_code"`
+	ExitSignal uint32   `json:"exit_signal"`
+	Events     uint64   `json:"events"`
+}
+
+func (this *ThreadNode) rename(comm string) {
+	if comm == "" || comm == this.Comm {
+		return
+	}
+	if this.Comm != "" {
+		this.Renames = append(this.Renames, this.Comm)
+	}
+	this.Comm = comm
+}
+
+type ProcNode struct {
+	Pid        uint32        `json:"pid"`
+	Ppid       uint32        `json:"ppid"`
+	Name       string        `json:"name"`
+	StartNs    uint64        `json:"start_ns,omitempty"`
+	ExitNs     uint64        `json:"exit_ns,omitempty"`
+	Exited     bool          `json:"exited"`
+	ExitCode   uint32        `json:"exit_code"`
+	ExitSignal uint32        `json:"exit_signal"`
+	Events     uint64        `json:"events"`
+	Images     []ExecImage   `json:"images,omitempty"`
+	Threads    []*ThreadNode `json:"threads"`
+	Children   []*ProcNode   `json:"children,omitempty"`
+
+	threads map[uint32]*ThreadNode
+}
+
+type forkInfo struct {
+	ppid     uint32
+	ptid     uint32
+	start_ns uint64
+}
+
+func (this *ProcNode) getThread(tid uint32) *ThreadNode {
+	thread, ok := this.threads[tid]
+	if !ok {
+		thread = &ThreadNode{Tid: tid}
+		this.threads[tid] = thread
+	}
+	return thread
+}
+
+func (this *ProcNode) refreshName() {
+	// 应用进程的名字 比如 com.example.app:push 在 cmdline 中
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", this.Pid))
+	if err != nil {
+		return
+	}
+	name := string(bytes.SplitN(content, []byte{0}, 2)[0])
+	if name != "" {
+		this.Name = name
+	}
+}
+
+type ProcTree struct {
+	sync.Mutex
+	conf         *config.ProcTreeConfig
+	fmt_json     bool
+	base_ns      uint64
+	procs        map[uint32]*ProcNode
+	forks        map[uint32]forkInfo
+	done         chan struct{}
+	finally_once sync.Once
+}
+
+var proc_tree *ProcTree
+var proc_tree_once sync.Once
+
+func GetProcTree(mconf *config.ModuleConfig, logger *log.Logger) *ProcTree {
+	proc_tree_once.Do(func() {
+		proc_tree = &ProcTree{}
+		proc_tree.conf = &mconf.ProcTree
+		proc_tree.fmt_json = mconf.FmtJson
+		proc_tree.procs = make(map[uint32]*ProcNode)
+		proc_tree.forks = make(map[uint32]forkInfo)
+		proc_tree.done = make(chan struct{})
+		// 指定 pid 的进程一开始就是追踪目标
+		for _, pid := range mconf.PidWhitelist {
+			proc_tree.getProc(pid)
+		}
+		if proc_tree.conf.Interval > 0 {
+			go func() {
+				ticker := time.NewTicker(time.Duration(proc_tree.conf.Interval) * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						proc_tree.Print(logger)
+					case <-proc_tree.done:
+						return
+					}
+				}
+			}()
+		}
+	})
+	return proc_tree
+}
+
+// 取得被追踪进程的节点 第一次见到时根据之前记录的创建信息补全
+func (this *ProcTree) getProc(pid uint32) *ProcNode {
+	node, ok := this.procs[pid]
+	if ok {
+		return node
+	}
+	node = &ProcNode{Pid: pid}
+	node.threads = make(map[uint32]*ThreadNode)
+	this.procs[pid] = node
+	if info, ok := this.forks[pid]; ok {
+		node.Ppid = info.ppid
+		node.StartNs = info.start_ns
+		node.getThread(pid).StartNs = info.start_ns
+		this.updateBase(info.start_ns)
+		delete(this.forks, pid)
+	}
+	node.refreshName()
+	return node
+}
+
+func (this *ProcTree) updateBase(ts uint64) {
+	if ts != 0 && (this.base_ns == 0 || ts < this.base_ns) {
+		this.base_ns = ts
+	}
+}
+
+func (this *ProcTree) countEvent(ctx *event.ContextEvent) {
+	node := this.getProc(ctx.Pid)
+	thread := node.getThread(ctx.Tid)
+	if thread.Comm == "" {
+		thread.Comm = util.B2STrim(ctx.Comm[:])
+	}
+	node.Events += 1
+	thread.Events += 1
+	this.updateBase(ctx.Ts)
+}
+
+// 所有通过过滤的事件都需要经过这里
+func (this *ProcTree) Observe(e event.IEventStruct) {
+	this.Lock()
+	defer this.Unlock()
+	switch v := e.(type) {
+	case *event.ForkEvent:
+		if v.Pid == v.Tid && v.Pid != v.Ppid {
+			// 新进程 pid 被复用时丢弃旧的记录
+			if old, ok := this.procs[v.Pid]; ok && old.Exited {
+				delete(this.procs, v.Pid)
+			}
+			this.forks[v.Pid] = forkInfo{v.Ppid, v.Ptid, v.Time}
+			// 被追踪进程的子进程同样是追踪目标
+			if parent, ok := this.procs[v.Ppid]; ok {
+				node := this.getProc(v.Pid)
+				node.Name = parent.Name
+				if parent_thread, ok := parent.threads[v.Ptid]; ok {
+					node.getThread(v.Tid).Comm = parent_thread.Comm
+				}
+			}
+		} else if node, ok := this.procs[v.Pid]; ok {
+			node.getThread(v.Tid).StartNs = v.Time
+			this.updateBase(v.Time)
+		}
+	case *event.CommEvent:
+		if node, ok := this.procs[v.Pid]; ok {
+			node.getThread(v.Tid).rename(v.Comm)
+			if v.Pid == v.Tid {
+				node.refreshName()
+			}
+		}
+	case *event.ExitEvent:
+		if v.Pid == v.Tid {
+			delete(this.forks, v.Pid)
+		}
+		if node, ok := this.procs[v.Pid]; ok {
+			thread := node.getThread(v.Tid)
+			thread.Exited = true
+			thread.ExitNs = v.Time
+			if v.Pid == v.Tid {
+				node.Exited = true
+				node.ExitNs = v.Time
+			}
+		}
+	case *event.TaskExitEvent:
+		node := this.getProc(v.Pid)
+		thread := node.getThread(v.Tid)
+		thread.Exited = true
+		thread.ExitNs = v.Ts
+		thread.ExitCode = v.Code()
+		thread.ExitSignal = v.Signal()
+		if v.IsProcessExit() {
+			node.Exited = true
+			node.ExitNs = v.Ts
+			node.ExitCode = v.Code()
+			node.ExitSignal = v.Signal()
+		}
+	case *event.ExecEvent:
+		node := this.getProc(v.Pid)
+		node.Images = append(node.Images, ExecImage{v.Ts, v.Filename, v.Argv, v.OldComm})
+		if v.OldPid != v.Tid {
+			// 非主线程执行 execve 后接管了主线程的 id
+			old := node.getThread(v.OldPid)
+			old.Exited = true
+			old.ExitNs = v.Ts
+		}
+		node.getThread(v.Tid).rename(util.B2STrim(v.Comm[:]))
+		node.refreshName()
+		this.updateBase(v.Ts)
+	case *event.SyscallEvent:
+		this.countEvent(&v.ContextEvent)
+	case *event.UprobeEvent:
+		this.countEvent(&v.ContextEvent)
+	case *event.BrkEvent:
+		this.countEvent(&v.ContextEvent)
+	case *event.CrashEvent:
+		this.countEvent(&v.ContextEvent)
+	}
+}
+
+// 复制一份用于输出 父进程没有被追踪的作为根节点
+func (this *ProcTree) snapshot() []*ProcNode {
+	children := make(map[uint32][]uint32)
+	for pid, node := range this.procs {
+		if node.Ppid != pid {
+			children[node.Ppid] = append(children[node.Ppid], pid)
+		}
+	}
+	var build func(pid uint32, visited map[uint32]bool) *ProcNode
+	build = func(pid uint32, visited map[uint32]bool) *ProcNode {
+		node := this.procs[pid]
+		if visited[pid] {
+			return nil
+		}
+		visited[pid] = true
+		copy_node := *node
+		copy_node.Threads = nil
+		copy_node.Children = nil
+		for _, thread := range node.threads {
+			copy_thread := *thread
+			copy_node.Threads = append(copy_node.Threads, &copy_thread)
+		}
+		sort.Slice(copy_node.Threads, func(i, j int) bool {
+			return copy_node.Threads[i].Tid < copy_node.Threads[j].Tid
+		})
+		child_pids := children[pid]
+		slices.Sort(child_pids)
+		for _, child_pid := range child_pids {
+			child := build(child_pid, visited)
+			if child != nil {
+				copy_node.Children = append(copy_node.Children, child)
+			}
+		}
+		return &copy_node
+	}
+	var pids []uint32
+	for pid, node := range this.procs {
+		if _, ok := this.procs[node.Ppid]; !ok || node.Ppid == pid {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+	var roots []*ProcNode
+	visited := make(map[uint32]bool)
+	for _, pid := range pids {
+		root := build(pid, visited)
+		if root != nil {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+func (this *ProcTree) fmtTs(ts uint64) string {
+	if ts == 0 || ts < this.base_ns {
+		return "?"
+	}
+	return fmt.Sprintf("+%.3fs", float64(ts-this.base_ns)/1e9)
+}
+
+func (this *ProcTree) fmtExit(exited bool, exit_ns uint64, code uint32, signal uint32) string {
+	if !exited {
+		return ""
+	}
+	s := fmt.Sprintf(" exit:%s", this.fmtTs(exit_ns))
+	if signal != 0 {
+		s += fmt.Sprintf(" signal:%d", signal)
+	} else {
+		s += fmt.Sprintf(" code:%d", code)
+	}
+	return s
+}
+
+func (this *ProcTree) formatNode(node *ProcNode, depth int, lines []string) []string {
+	indent := strings.Repeat("    ", depth)
+	line := fmt.Sprintf("%s%d %s ppid:%d start:%s%s events:%d", indent, node.Pid, node.Name, node.Ppid, this.fmtTs(node.StartNs), this.fmtExit(node.Exited, node.ExitNs, node.ExitCode, node.ExitSignal), node.Events)
+	lines = append(lines, line)
+	for _, image := range node.Images {
+		lines = append(lines, fmt.Sprintf("%s  exec %s %s argv:%q comm:%s", indent, this.fmtTs(image.Ts), image.Filename, image.Argv, image.OldComm))
+	}
+	for _, thread := range node.Threads {
+		line = fmt.Sprintf("%s  thread %d %s start:%s%s events:%d", indent, thread.Tid, thread.Comm, this.fmtTs(thread.StartNs), this.fmtExit(thread.Exited, thread.ExitNs, thread.ExitCode, thread.ExitSignal), thread.Events)
+		if len(thread.Renames) > 0 {
+			names := append(slices.Clone(thread.Renames), thread.Comm)
+			line += fmt.Sprintf(" renames:%s", strings.Join(names, "->"))
+		}
+		lines = append(lines, line)
+	}
+	for _, child := range node.Children {
+		lines = this.formatNode(child, depth+1, lines)
+	}
+	return lines
+}
+
+func (this *ProcTree) Print(logger *log.Logger) {
+	// base_ns 随事件更新 格式化也需要在锁内完成
+	this.Lock()
+	roots := this.snapshot()
+	if this.fmt_json {
+		this.Unlock()
+		data, err := json.Marshal(roots)
+		if err != nil {
+			logger.Printf("ProcTree marshal failed, err:%v", err)
+			return
+		}
+		logger.Println(string(data))
+		return
+	}
+	lines := []string{"process tree:"}
+	for _, root := range roots {
+		lines = this.formatNode(root, 0, lines)
+	}
+	this.Unlock()
+	logger.Println("\n" + strings.Join(lines, "\n"))
+}
+
+func (this *ProcTree) PrintFinally(logger *log.Logger) {
+	// 多个模块共享 只在退出时输出一次 同时停止定时输出
+	this.finally_once.Do(func() {
+		close(this.done)
+		this.Print(logger)
+	})
+}
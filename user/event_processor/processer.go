@@ -3,6 +3,7 @@ package event_processor
 import (
 	"fmt"
 	"log"
+	"stackplz/user/config"
 	"stackplz/user/event"
 	"sync"
 	"time"
@@ -22,6 +23,19 @@ type EventProcessor struct {
 	workerQueue map[string]IWorker
 
 	logger *log.Logger
+
+	// 飞行记录模式 未开启时为 nil
+	recorder *FlightRecorder
+	// 统计模式 未开启时为 nil
+	summary *SyscallSummary
+	// 堆栈聚合 未开启时为 nil
+	aggregator *StackAggregator
+	// 堆栈内容过滤 未开启时为 nil
+	matcher *StackMatcher
+	// 会话限制 未开启时为 nil
+	session *Session
+	// 进程树 未开启时为 nil
+	tree *ProcTree
 }
 
 func (this *EventProcessor) GetLogger() *log.Logger {
@@ -63,6 +77,31 @@ func (this *EventProcessor) dispatch(map_e event.IEventStruct) {
 		// 比如是自己的 mmap2 事件 直接忽略调
 		return
 	}
+	if this.session != nil {
+		this.session.Observe(data_e)
+	}
+	if this.matcher != nil && this.matcher.Drop(data_e) {
+		return
+	}
+	if this.tree != nil {
+		this.tree.Observe(data_e)
+	}
+	if _, ok := data_e.(*event.TaskExitEvent); ok {
+		// 退出码只用于进程树
+		return
+	}
+	if this.aggregator != nil {
+		this.aggregator.Record(data_e)
+	}
+	if this.recorder != nil && this.recorder.Record(data_e, this.logger) {
+		return
+	}
+	if this.summary != nil && this.summary.Record(data_e) {
+		return
+	}
+	if this.session != nil && !this.session.Count(data_e) {
+		return
+	}
 	// 单就输出日志来说 下面这样做反而给人一种输出有延迟的感觉 如果没有必要就去掉这部分吧
 	var uuid string = data_e.GetUUID()
 	found, eWorker := this.getWorkerByUUID(uuid)
@@ -117,6 +156,18 @@ func (this *EventProcessor) Write(e event.IEventStruct) {
 }
 
 func (this *EventProcessor) Close() error {
+	if this.summary != nil {
+		this.summary.PrintFinally(this.logger)
+	}
+	if this.aggregator != nil {
+		this.aggregator.WriteFinally(this.logger)
+	}
+	if this.matcher != nil {
+		this.matcher.PrintFinally(this.logger)
+	}
+	if this.tree != nil {
+		this.tree.PrintFinally(this.logger)
+	}
 	// 关闭模块的时候 变更 tickerCount 大小 让它自己退出
 	for _, worker := range this.workerQueue {
 		worker.(*eventWorker).tickerCount = MAX_TICKER_COUNT + 1
@@ -134,10 +185,28 @@ func (this *EventProcessor) Close() error {
 	return nil
 }
 
-func NewEventProcessor(logger *log.Logger) *EventProcessor {
+func NewEventProcessor(logger *log.Logger, conf *config.ModuleConfig) *EventProcessor {
 	var ep *EventProcessor
 	ep = &EventProcessor{}
 	ep.logger = logger
 	ep.init()
+	if conf.Recorder.IsEnable() {
+		ep.recorder = GetFlightRecorder(&conf.Recorder)
+	}
+	if conf.Summary.IsEnable() {
+		ep.summary = GetSyscallSummary(conf, logger)
+	}
+	if conf.FlameGraph != "" {
+		ep.aggregator = GetStackAggregator(conf.FlameGraph)
+	}
+	if conf.StackMatch.IsEnable() {
+		ep.matcher = GetStackMatcher(&conf.StackMatch)
+	}
+	if conf.Session.IsEnable() {
+		ep.session = GetSession(conf, logger)
+	}
+	if conf.ProcTree.IsEnable() {
+		ep.tree = GetProcTree(conf, logger)
+	}
 	return ep
 }
@@ -0,0 +1,142 @@
+package event_processor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"stackplz/user/config"
+	"stackplz/user/event"
+	"sync"
+	"time"
+)
+
+// 飞行记录模式
+// 每个线程保留最近的若干事件 命中触发规则后输出该进程全部线程的记录
+// syscall 和 uprobe 由不同的模块处理 所以这里是全局共享的
+
+// 进程退出后延迟清理记录 其他 perf buffer 中的事件可能晚于退出事件到达 比如 exit_group
+const recorder_evict_delay = 2 * time.Second
+
+type recordItem struct {
+	seq uint64
+	e   event.IEventStruct
+}
+
+type eventRing struct {
+	items []recordItem
+	head  int
+	full  bool
+}
+
+func (this *eventRing) push(item recordItem) {
+	this.items[this.head] = item
+	this.head = (this.head + 1) % len(this.items)
+	if this.head == 0 {
+		this.full = true
+	}
+}
+
+func (this *eventRing) dump() []recordItem {
+	if !this.full {
+		return this.items[:this.head]
+	}
+	return append(this.items[this.head:], this.items[:this.head]...)
+}
+
+type FlightRecorder struct {
+	sync.Mutex
+	size  uint32
+	conf  *config.FlightRecorderConfig
+	seq   uint64
+	rings map[uint32]map[uint32]*eventRing
+}
+
+var recorder *FlightRecorder
+var recorder_once sync.Once
+
+func GetFlightRecorder(conf *config.FlightRecorderConfig) *FlightRecorder {
+	recorder_once.Do(func() {
+		recorder = &FlightRecorder{}
+		recorder.size = conf.Size
+		recorder.conf = conf
+		recorder.rings = make(map[uint32]map[uint32]*eventRing)
+		event.AddExitHook(recorder.onExit)
+	})
+	return recorder
+}
+
+func (this *FlightRecorder) parseEvent(e event.IEventStruct) (pid, tid uint32, trigger string, ok bool) {
+	switch v := e.(type) {
+	case *event.SyscallEvent:
+		if v.EventId == event.SYSCALL_ENTER && this.conf.IsTriggerNR(v.NR) {
+			trigger = v.PointName
+		}
+		return v.Pid, v.Tid, trigger, true
+	case *event.UprobeEvent:
+		if this.conf.IsTriggerPoint(v.ProbeIndex) {
+			trigger = v.ArgName
+		}
+		return v.Pid, v.Tid, trigger, true
+	case *event.CrashEvent:
+		if this.conf.IsTriggerSignal(v.Sig) {
+			trigger = v.GetSigName()
+		}
+		return v.Pid, v.Tid, trigger, true
+	}
+	return 0, 0, "", false
+}
+
+func (this *FlightRecorder) onExit(pid, tid uint32) {
+	// 只在主线程退出时清理 其他线程的记录在进程触发时仍然需要
+	if pid != tid {
+		return
+	}
+	time.AfterFunc(recorder_evict_delay, func() {
+		this.Lock()
+		defer this.Unlock()
+		delete(this.rings, pid)
+	})
+}
+
+// 返回 true 表示事件已经被记录 不需要再输出
+func (this *FlightRecorder) Record(e event.IEventStruct, logger *log.Logger) bool {
+	pid, tid, trigger, ok := this.parseEvent(e)
+	if !ok {
+		return false
+	}
+	this.Lock()
+	defer this.Unlock()
+	threads, found := this.rings[pid]
+	if !found {
+		threads = make(map[uint32]*eventRing)
+		this.rings[pid] = threads
+	}
+	ring, found := threads[tid]
+	if !found {
+		ring = &eventRing{items: make([]recordItem, this.size)}
+		threads[tid] = ring
+	}
+	this.seq += 1
+	ring.push(recordItem{this.seq, e})
+	if trigger != "" {
+		this.flush(pid, tid, trigger, logger)
+	}
+	return true
+}
+
+func (this *FlightRecorder) flush(pid, tid uint32, trigger string, logger *log.Logger) {
+	// 按事件到达的顺序合并各个线程的记录
+	var items []recordItem
+	for _, ring := range this.rings[pid] {
+		items = append(items, ring.dump()...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+	logger.Println(fmt.Sprintf("==== flight recorder pid:%d tid:%d trigger:%s events:%d ====", pid, tid, trigger, len(items)))
+	for _, item := range items {
+		logger.Println(item.e.String())
+	}
+	logger.Println(fmt.Sprintf("==== flight recorder pid:%d end ====", pid))
+	delete(this.rings, pid)
+}
@@ -0,0 +1,172 @@
+package event_processor
+
+import (
+	"io/ioutil"
+	"log"
+	"stackplz/user/config"
+	"stackplz/user/event"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// 会话限制 输出指定数量的事件、达到指定时长或者目标进程全部退出后结束
+// 结束时通过 Done 通知 runFunc 走正常的关闭流程
+
+type Session struct {
+	sync.Mutex
+	conf        *config.SessionConfig
+	logger      *log.Logger
+	count       uint64
+	target_pids map[uint32]bool
+	exited_pids map[uint32]bool
+	seed_pids   bool
+	done        chan int
+	done_once   sync.Once
+}
+
+var session *Session
+var session_once sync.Once
+
+func GetSession(mconf *config.ModuleConfig, logger *log.Logger) *Session {
+	session_once.Do(func() {
+		session = &Session{}
+		session.conf = &mconf.Session
+		session.logger = logger
+		session.done = make(chan int, 1)
+		session.target_pids = make(map[uint32]bool)
+		session.exited_pids = make(map[uint32]bool)
+		if session.conf.ExitWithTarget {
+			session.initTargets(mconf)
+		}
+	})
+	return session
+}
+
+func (this *Session) initTargets(mconf *config.ModuleConfig) {
+	for _, pid := range mconf.PidWhitelist {
+		this.target_pids[pid] = true
+	}
+	// 按名称、uid 等过滤时 目标进程可能在之后才启动 只能从它的第一个事件得知
+	this.seed_pids = mconf.HasRuntimeTarget() || len(mconf.UidWhitelist) > 0
+	if len(mconf.PkgNamelist) == 0 {
+		return
+	}
+	// 已经在运行的目标进程
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		value, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		proc_name, err := event.ReadProcNameByPid(uint32(value))
+		if err == nil && slices.Contains(mconf.PkgNamelist, proc_name) {
+			this.target_pids[uint32(value)] = true
+		}
+	}
+}
+
+// 在所有模块启动完成后调用
+func (this *Session) Start() {
+	if this.conf.Duration > 0 {
+		time.AfterFunc(this.conf.Duration, func() {
+			this.finish(config.SESSION_EXIT_DURATION, "duration reached")
+		})
+	}
+}
+
+func (this *Session) Done() <-chan int {
+	return this.done
+}
+
+func (this *Session) finish(code int, reason string) {
+	this.done_once.Do(func() {
+		this.logger.Printf("session finished, %s", reason)
+		this.done <- code
+	})
+}
+
+func (this *Session) addTarget(pid uint32) {
+	// 已经退出的进程 处理顺序靠后的事件不能再把它加回来
+	if _, ok := this.exited_pids[pid]; ok {
+		return
+	}
+	this.target_pids[pid] = true
+}
+
+// 跟踪目标进程的存活情况 所有事件都需要经过这里
+// 只有 fork/exec 会从已跟踪的进程延伸出新的目标 其他事件仅用于发现之后才启动的目标进程
+func (this *Session) Observe(e event.IEventStruct) {
+	if !this.conf.ExitWithTarget {
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	switch v := e.(type) {
+	case *event.ForkEvent:
+		// 目标进程产生的子进程 pid 可能被复用 所以 fork 可以撤销退出的记录
+		if v.Pid == v.Tid && this.target_pids[v.Ppid] {
+			delete(this.exited_pids, v.Pid)
+			this.target_pids[v.Pid] = true
+		}
+	case *event.ExecEvent:
+		// 非主线程执行 execve 时原来的主线程会先退出 之后由执行 execve 的线程接管 pid
+		if this.target_pids[v.Pid] || (v.OldPid != v.Pid && this.exited_pids[v.Pid]) {
+			delete(this.exited_pids, v.Pid)
+			this.target_pids[v.Pid] = true
+		}
+	case *event.ExitEvent:
+		// 线程退出也会产生该事件 只关心进程退出
+		if v.Pid != v.Tid {
+			return
+		}
+		// 记录退出前是否为目标进程
+		this.exited_pids[v.Pid] = this.target_pids[v.Pid]
+		if !this.target_pids[v.Pid] {
+			return
+		}
+		delete(this.target_pids, v.Pid)
+		if len(this.target_pids) == 0 {
+			this.finish(config.SESSION_EXIT_TARGET, "all target processes exited")
+		}
+	case *event.SyscallEvent:
+		if this.seed_pids {
+			this.addTarget(v.Pid)
+		}
+	case *event.UprobeEvent:
+		if this.seed_pids {
+			this.addTarget(v.Pid)
+		}
+	case *event.CrashEvent:
+		if this.seed_pids {
+			this.addTarget(v.Pid)
+		}
+	}
+}
+
+// 返回 false 表示已经达到数量限制 事件不再输出
+func (this *Session) Count(e event.IEventStruct) bool {
+	if this.conf.MaxEvents == 0 {
+		return true
+	}
+	switch e.(type) {
+	case *event.SyscallEvent, *event.UprobeEvent, *event.BrkEvent, *event.CrashEvent:
+	default:
+		return true
+	}
+	this.Lock()
+	defer this.Unlock()
+	if this.count >= this.conf.MaxEvents {
+		return false
+	}
+	this.count += 1
+	if this.count == this.conf.MaxEvents {
+		this.finish(config.SESSION_EXIT_MAX_EVENTS, "max events reached")
+	}
+	return true
+}
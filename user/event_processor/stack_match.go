@@ -0,0 +1,81 @@
+package event_processor
+
+import (
+	"log"
+	"stackplz/user/config"
+	"stackplz/user/event"
+	"sync"
+)
+
+// 按堆栈内容过滤事件 lr 往往是 libc 之类的中间层 无法反映真实的调用来源
+// 正向规则 至少有一帧匹配才保留 反向规则 任意一帧匹配就丢弃
+
+type StackMatcher struct {
+	sync.Mutex
+	conf         *config.StackMatchConfig
+	kept         uint64
+	dropped      uint64
+	finally_once sync.Once
+}
+
+var matcher *StackMatcher
+var matcher_once sync.Once
+
+func GetStackMatcher(conf *config.StackMatchConfig) *StackMatcher {
+	matcher_once.Do(func() {
+		matcher = &StackMatcher{}
+		matcher.conf = conf
+	})
+	return matcher
+}
+
+func (this *StackMatcher) match(stackinfo string) bool {
+	frames := ParseBacktrace(stackinfo)
+	matched := !this.conf.HasPositive()
+	for _, rule := range this.conf.Rules {
+		for _, frame := range frames {
+			if !rule.Match(frame.Path, frame.Module, frame.Symbol) {
+				continue
+			}
+			if rule.Negate {
+				return false
+			}
+			matched = true
+			break
+		}
+	}
+	return matched
+}
+
+// 返回 true 表示事件应当被丢弃
+func (this *StackMatcher) Drop(e event.IEventStruct) bool {
+	var stackinfo string
+	switch v := e.(type) {
+	case *event.SyscallEvent:
+		stackinfo = v.Stackinfo
+	case *event.UprobeEvent:
+		stackinfo = v.Stackinfo
+	case *event.BrkEvent:
+		stackinfo = v.Stackinfo
+	default:
+		return false
+	}
+	keep := this.match(stackinfo)
+	this.Lock()
+	defer this.Unlock()
+	if keep {
+		this.kept += 1
+	} else {
+		this.dropped += 1
+	}
+	return !keep
+}
+
+func (this *StackMatcher) PrintFinally(logger *log.Logger) {
+	// 多个模块共享 只在退出时输出一次
+	this.finally_once.Do(func() {
+		this.Lock()
+		defer this.Unlock()
+		logger.Printf("stack-match kept %d events, dropped %d events", this.kept, this.dropped)
+	})
+}
@@ -0,0 +1,226 @@
+package event_processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"stackplz/user/config"
+	"stackplz/user/event"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 类似 strace -c 的统计模式
+// 调用次数在进入时统计 因为 exit/exit_group 之类的不会返回
+// 耗时由同一线程的进入和返回事件计算 两者可能来自不同 cpu 的缓冲区 所以到达顺序不一定
+
+type summaryKey struct {
+	Pid uint32
+	Tid uint32
+	NR  uint32
+}
+
+type SummaryItem struct {
+	Pid     uint32 `json:"pid,omitempty"`
+	Tid     uint32 `json:"tid,omitempty"`
+	Name    string `json:"syscall"`
+	Calls   uint64 `json:"calls"`
+	Errors  uint64 `json:"errors"`
+	Samples uint64 `json:"-"`
+	TotalNs uint64 `json:"total_ns"`
+	MinNs   uint64 `json:"min_ns"`
+	MaxNs   uint64 `json:"max_ns"`
+}
+
+func (this *SummaryItem) AvgNs() uint64 {
+	if this.Samples == 0 {
+		return 0
+	}
+	return this.TotalNs / this.Samples
+}
+
+func (this *SummaryItem) AddLatency(latency uint64) {
+	if this.Samples == 0 || latency < this.MinNs {
+		this.MinNs = latency
+	}
+	if latency > this.MaxNs {
+		this.MaxNs = latency
+	}
+	this.Samples += 1
+	this.TotalNs += latency
+}
+
+type pendingCall struct {
+	nr uint32
+	ts uint64
+}
+
+type SyscallSummary struct {
+	sync.Mutex
+	conf         *config.SummaryConfig
+	fmt_json     bool
+	items        map[summaryKey]*SummaryItem
+	enter_list   map[uint32]pendingCall
+	exit_list    map[uint32]pendingCall
+	done         chan struct{}
+	finally_once sync.Once
+}
+
+var summary *SyscallSummary
+var summary_once sync.Once
+
+func GetSyscallSummary(mconf *config.ModuleConfig, logger *log.Logger) *SyscallSummary {
+	summary_once.Do(func() {
+		summary = &SyscallSummary{}
+		summary.conf = &mconf.Summary
+		summary.fmt_json = mconf.FmtJson
+		summary.items = make(map[summaryKey]*SummaryItem)
+		summary.enter_list = make(map[uint32]pendingCall)
+		summary.exit_list = make(map[uint32]pendingCall)
+		summary.done = make(chan struct{})
+		if summary.conf.Interval > 0 {
+			go func() {
+				ticker := time.NewTicker(time.Duration(summary.conf.Interval) * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						summary.Print(logger)
+					case <-summary.done:
+						return
+					}
+				}
+			}()
+		}
+	})
+	return summary
+}
+
+func (this *SyscallSummary) getItem(e *event.SyscallEvent) *SummaryItem {
+	key := summaryKey{NR: e.NR}
+	if this.conf.By == config.SUMMARY_BY_PID {
+		key.Pid = e.Pid
+	} else if this.conf.By == config.SUMMARY_BY_TID {
+		key.Pid = e.Pid
+		key.Tid = e.Tid
+	}
+	item, ok := this.items[key]
+	if !ok {
+		item = &SummaryItem{Pid: key.Pid, Tid: key.Tid, Name: e.PointName}
+		this.items[key] = item
+	}
+	return item
+}
+
+func isErrorRet(ret uint64) bool {
+	// -4095 ~ -1 视为错误
+	value := int64(ret)
+	return value < 0 && value >= -4095
+}
+
+// 返回 true 表示事件已经被统计 不需要再输出
+func (this *SyscallSummary) Record(e event.IEventStruct) bool {
+	v, ok := e.(*event.SyscallEvent)
+	if !ok {
+		return false
+	}
+	this.Lock()
+	defer this.Unlock()
+	item := this.getItem(v)
+	if v.EventId == event.SYSCALL_ENTER {
+		item.Calls += 1
+		if exit, ok := this.exit_list[v.Tid]; ok && exit.nr == v.NR && exit.ts >= v.Ts {
+			delete(this.exit_list, v.Tid)
+			item.AddLatency(exit.ts - v.Ts)
+			return true
+		}
+		this.enter_list[v.Tid] = pendingCall{v.NR, v.Ts}
+	} else if v.EventId == event.SYSCALL_EXIT {
+		if isErrorRet(v.RetValue) {
+			item.Errors += 1
+		}
+		if enter, ok := this.enter_list[v.Tid]; ok && enter.nr == v.NR && v.Ts >= enter.ts {
+			delete(this.enter_list, v.Tid)
+			item.AddLatency(v.Ts - enter.ts)
+			return true
+		}
+		this.exit_list[v.Tid] = pendingCall{v.NR, v.Ts}
+	}
+	return true
+}
+
+func (this *SyscallSummary) sortedItems() []SummaryItem {
+	var items []SummaryItem
+	for _, item := range this.items {
+		items = append(items, *item)
+	}
+	// 与 strace -c 一致 按总耗时排序
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].TotalNs != items[j].TotalNs {
+			return items[i].TotalNs > items[j].TotalNs
+		}
+		if items[i].Calls != items[j].Calls {
+			return items[i].Calls > items[j].Calls
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+func (this *SyscallSummary) Print(logger *log.Logger) {
+	this.Lock()
+	items := this.sortedItems()
+	this.Unlock()
+	if this.fmt_json {
+		data, err := json.Marshal(items)
+		if err != nil {
+			logger.Printf("SyscallSummary marshal failed, err:%v", err)
+			return
+		}
+		logger.Println(string(data))
+		return
+	}
+	var lines []string
+	prefix := ""
+	if this.conf.By == config.SUMMARY_BY_PID {
+		prefix = fmt.Sprintf("%-8s ", "pid")
+	} else if this.conf.By == config.SUMMARY_BY_TID {
+		prefix = fmt.Sprintf("%-8s %-8s ", "pid", "tid")
+	}
+	header := prefix + fmt.Sprintf("%-24s %10s %10s %14s %12s %12s %12s", "syscall", "calls", "errors", "total(us)", "avg(us)", "min(us)", "max(us)")
+	lines = append(lines, header)
+	lines = append(lines, strings.Repeat("-", len(header)))
+	var calls, errors, total uint64
+	for _, item := range items {
+		prefix = ""
+		if this.conf.By == config.SUMMARY_BY_PID {
+			prefix = fmt.Sprintf("%-8d ", item.Pid)
+		} else if this.conf.By == config.SUMMARY_BY_TID {
+			prefix = fmt.Sprintf("%-8d %-8d ", item.Pid, item.Tid)
+		}
+		line := prefix + fmt.Sprintf("%-24s %10d %10d %14.3f %12.3f %12.3f %12.3f", item.Name, item.Calls, item.Errors, float64(item.TotalNs)/1000, float64(item.AvgNs())/1000, float64(item.MinNs)/1000, float64(item.MaxNs)/1000)
+		lines = append(lines, line)
+		calls += item.Calls
+		errors += item.Errors
+		total += item.TotalNs
+	}
+	lines = append(lines, strings.Repeat("-", len(header)))
+	prefix = ""
+	if this.conf.By == config.SUMMARY_BY_PID {
+		prefix = fmt.Sprintf("%-8s ", "")
+	} else if this.conf.By == config.SUMMARY_BY_TID {
+		prefix = fmt.Sprintf("%-8s %-8s ", "", "")
+	}
+	lines = append(lines, prefix+fmt.Sprintf("%-24s %10d %10d %14.3f", "total", calls, errors, float64(total)/1000))
+	logger.Println("\n" + strings.Join(lines, "\n"))
+}
+
+func (this *SyscallSummary) PrintFinally(logger *log.Logger) {
+	// 多个模块共享 只在退出时输出一次 同时停止定时输出
+	this.finally_once.Do(func() {
+		close(this.done)
+		this.Print(logger)
+	})
+}
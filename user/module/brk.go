@@ -151,6 +151,7 @@ func (this *PerfBRK) initDecodeFun() (err error) {
 	this.eventMaps = append(this.eventMaps, BrkEventsMap)
 	brkEvent := &event.BrkEvent{}
 	brkEvent.SetConf(this.mconf)
+	brkEvent.InitWatchValue()
 	this.eventFuncMaps[BrkEventsMap] = brkEvent
 
 	return nil
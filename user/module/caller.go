@@ -0,0 +1,191 @@
+package module
+
+import (
+    "bufio"
+    "fmt"
+    "log"
+    "os"
+    "stackplz/user/config"
+    "stackplz/user/event"
+    "strconv"
+    "strings"
+    "sync"
+    "unsafe"
+
+    "github.com/cilium/ebpf"
+    "golang.org/x/sys/unix"
+)
+
+const MAX_CALLER_RANGE_COUNT = 32
+
+// 维护 --caller 指定库的可执行段地址范围 syscall 和 stack 模块各有一份 caller_ranges
+// 地址范围不区分进程 zygote 孵化的进程系统库地址本就一致
+// 每个进程的范围分开记录 进程退出后移除 避免已经失效的范围占满 caller_ranges
+type CallerRangeManager struct {
+    sync.Mutex
+    logger     *log.Logger
+    conf       *config.CallerConfig
+    debug      bool
+    bpf_maps   []*ebpf.Map
+    pid_ranges map[uint32][]config.CallerRange
+}
+
+var caller_manager *CallerRangeManager
+var caller_once sync.Once
+
+func GetCallerRangeManager(mconf *config.ModuleConfig, logger *log.Logger) *CallerRangeManager {
+    caller_once.Do(func() {
+        caller_manager = &CallerRangeManager{}
+        caller_manager.logger = logger
+        caller_manager.conf = &mconf.Caller
+        caller_manager.debug = mconf.Debug
+        caller_manager.pid_ranges = make(map[uint32][]config.CallerRange)
+        // 已经在运行的进程 直接从 maps 取得范围
+        for _, pid := range mconf.PidWhitelist {
+            if err := caller_manager.parseMaps(pid); err != nil {
+                logger.Printf("parse caller ranges for pid:%d failed, err:%v", pid, err)
+            }
+        }
+        // 库被加载或者重新加载时更新
+        event.AddMmapHook(caller_manager.onMmap)
+        // exec 之后地址空间整个被替换
+        event.AddExecHook(caller_manager.onExec)
+        event.AddExitHook(caller_manager.onExit)
+    })
+    return caller_manager
+}
+
+func (this *CallerRangeManager) AddMap(bpf_map *ebpf.Map) {
+    this.Lock()
+    defer this.Unlock()
+    this.bpf_maps = append(this.bpf_maps, bpf_map)
+    this.flush()
+}
+
+func (this *CallerRangeManager) onMmap(pid uint32, lib_path string, prot uint32) {
+    if prot&unix.PROT_EXEC == 0 {
+        return
+    }
+    if this.conf.GetMask(lib_path) == 0 {
+        return
+    }
+    this.Lock()
+    defer this.Unlock()
+    if err := this.parseMaps(pid); err != nil {
+        this.logger.Printf("update caller ranges for pid:%d failed, err:%v", pid, err)
+        return
+    }
+    this.flush()
+}
+
+func (this *CallerRangeManager) onExec(e *event.ExecEvent) {
+    this.Lock()
+    defer this.Unlock()
+    if err := this.parseMaps(e.Pid); err != nil {
+        this.logger.Printf("update caller ranges for pid:%d failed, err:%v", e.Pid, err)
+        return
+    }
+    this.flush()
+}
+
+func (this *CallerRangeManager) onExit(pid, tid uint32) {
+    if pid != tid {
+        return
+    }
+    this.Lock()
+    defer this.Unlock()
+    if _, ok := this.pid_ranges[pid]; !ok {
+        return
+    }
+    delete(this.pid_ranges, pid)
+    this.flush()
+}
+
+func (this *CallerRangeManager) parseMaps(pid uint32) error {
+    f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    var ranges []config.CallerRange
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        // 7a8b8c0000-7a8b8d0000 r-xp 00000000 fd:00 1234 /apex/com.android.runtime/lib64/bionic/libc.so
+        fields := strings.Fields(scanner.Text())
+        if len(fields) < 6 || !strings.Contains(fields[1], "x") {
+            continue
+        }
+        mask := this.conf.GetMask(fields[5])
+        if mask == 0 {
+            continue
+        }
+        addrs := strings.Split(fields[0], "-")
+        if len(addrs) != 2 {
+            continue
+        }
+        start, err := strconv.ParseUint(addrs[0], 16, 64)
+        if err != nil {
+            return err
+        }
+        end, err := strconv.ParseUint(addrs[1], 16, 64)
+        if err != nil {
+            return err
+        }
+        ranges = append(ranges, config.CallerRange{Start: start, End: end, Mask: mask})
+    }
+    // 覆盖之前的记录 这样库重新加载后旧的范围就失效了
+    this.pid_ranges[pid] = ranges
+    return scanner.Err()
+}
+
+func (this *CallerRangeManager) collect() []config.CallerRange {
+    var ranges []config.CallerRange
+    for pid, pid_ranges := range this.pid_ranges {
+        // 没有收到退出事件的进程 比如不在追踪范围内
+        if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); os.IsNotExist(err) {
+            delete(this.pid_ranges, pid)
+            continue
+        }
+        for _, r := range pid_ranges {
+            merged := false
+            for i := range ranges {
+                if ranges[i].Start == r.Start && ranges[i].End == r.End {
+                    ranges[i].Mask |= r.Mask
+                    merged = true
+                    break
+                }
+            }
+            if !merged {
+                ranges = append(ranges, r)
+            }
+        }
+    }
+    return ranges
+}
+
+func (this *CallerRangeManager) flush() {
+    ranges := this.collect()
+    if len(ranges) > MAX_CALLER_RANGE_COUNT {
+        this.logger.Printf("caller ranges table is full, count:%d exceed %d, calls from the extra ranges are not matched", len(ranges), MAX_CALLER_RANGE_COUNT)
+        ranges = ranges[:MAX_CALLER_RANGE_COUNT]
+    }
+    for _, bpf_map := range this.bpf_maps {
+        // 有效范围需要连续存放 剩下的清零
+        for i := 0; i < MAX_CALLER_RANGE_COUNT; i++ {
+            key := uint32(i)
+            value := config.CallerRange{}
+            if i < len(ranges) {
+                value = ranges[i]
+            }
+            err := bpf_map.Update(unsafe.Pointer(&key), unsafe.Pointer(&value), ebpf.UpdateAny)
+            if err != nil {
+                panic(fmt.Sprintf("update [caller_ranges] failed, err:%v", err))
+            }
+        }
+    }
+    if this.debug {
+        for _, r := range ranges {
+            this.logger.Printf("caller range 0x%x-0x%x mask:0x%x", r.Start, r.End, r.Mask)
+        }
+    }
+}
@@ -13,11 +13,8 @@ const (
     MODULE_NAME_BRK     = "BrkMod"
     MODULE_NAME_STACK   = "StackMod"
     MODULE_NAME_SYSCALL = "SyscallMod"
-)
-
-const (
-    THREAD_NAME_WHITELIST uint32 = 1
-    THREAD_NAME_BLACKLIST uint32 = 2
+    MODULE_NAME_CRASH   = "CrashMod"
+    MODULE_NAME_EXEC    = "ExecMod"
 )
 
 // http://aospxref.com/android-11.0.0_r21/xref/bionic/libc/kernel/uapi/asm-arm/asm/perf_regs.h
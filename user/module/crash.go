@@ -0,0 +1,44 @@
+package module
+
+import (
+    "context"
+    "log"
+    "stackplz/user/config"
+    "stackplz/user/event"
+)
+
+// 崩溃捕获 在 signal_generate 和 signal_deliver 处检查发往目标进程的致命信号
+type MCrash struct {
+    MTracepoint
+}
+
+func (this *MCrash) Init(ctx context.Context, logger *log.Logger, conf config.IConfig) error {
+    this.initTracepoint(ctx, logger, conf, this, "signal.o")
+    this.addProbe("signal_generate", "tracepoint__signal__signal_generate")
+    this.addProbe("signal_deliver", "tracepoint__signal__signal_deliver")
+    this.addEvent("crash_events", &event.CrashEvent{})
+    return nil
+}
+
+func (this *MCrash) Start() error {
+    err := this.start()
+    if err != nil {
+        return err
+    }
+    this.logger.Printf("crash capture enabled, report dir:%s", this.mconf.CrashDir)
+    return nil
+}
+
+func (this *MCrash) Clone() IModule {
+    mod := new(MCrash)
+    mod.name = this.name
+    mod.mType = this.mType
+    return mod
+}
+
+func init() {
+    mod := &MCrash{}
+    mod.name = MODULE_NAME_CRASH
+    mod.mType = PROBE_TYPE_TRACEPOINT
+    Register(mod)
+}
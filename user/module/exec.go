@@ -0,0 +1,166 @@
+package module
+
+import (
+    "context"
+    "debug/elf"
+    "fmt"
+    "log"
+    "stackplz/user/config"
+    "stackplz/user/event"
+    "stackplz/user/util"
+    "strings"
+    "sync"
+    "unsafe"
+
+    "github.com/cilium/ebpf"
+)
+
+// 在 sched_process_exec 处输出进程映像变化
+type MExec struct {
+    MTracepoint
+}
+
+func (this *MExec) Init(ctx context.Context, logger *log.Logger, conf config.IConfig) error {
+    this.initTracepoint(ctx, logger, conf, this, "exec.o")
+    this.addProbe("sys_enter", "tracepoint__raw_syscalls__sys_enter")
+    this.addProbe("sched_process_exec", "tracepoint__sched__sched_process_exec")
+    this.addEvent("exec_events", &event.ExecEvent{})
+    // 退出码只有进程树需要
+    if this.mconf.ProcTree.IsEnable() {
+        this.addProbe("sched_process_exit", "tracepoint__sched__sched_process_exit")
+        this.addEvent("task_exit_events", &event.TaskExitEvent{})
+    }
+    return nil
+}
+
+func (this *MExec) Start() error {
+    err := this.start()
+    if err != nil {
+        return err
+    }
+    this.update_exec_follower()
+    GetExecFollower(this.mconf, this.logger)
+    return nil
+}
+
+func (this *MExec) Clone() IModule {
+    mod := new(MExec)
+    mod.name = this.name
+    mod.mType = this.mType
+    return mod
+}
+
+// 处理 exec 之后的后续工作
+// 1. 检查新的程序映像与 hook 的库是否匹配
+// 2. 设置了 --no-follow-exec 时 将进程加入各个模块的 pid 黑名单
+type ExecFollower struct {
+    sync.Mutex
+    logger      *log.Logger
+    mconf       *config.ModuleConfig
+    common_list []*ebpf.Map
+}
+
+var exec_follower *ExecFollower
+var exec_follower_once sync.Once
+
+func GetExecFollower(mconf *config.ModuleConfig, logger *log.Logger) *ExecFollower {
+    exec_follower_once.Do(func() {
+        exec_follower = &ExecFollower{}
+        exec_follower.logger = logger
+        exec_follower.mconf = mconf
+        event.AddExecHook(exec_follower.onExec)
+    })
+    return exec_follower
+}
+
+func (this *ExecFollower) AddMap(bpf_map *ebpf.Map) {
+    this.Lock()
+    defer this.Unlock()
+    this.common_list = append(this.common_list, bpf_map)
+}
+
+func (this *ExecFollower) onExec(e *event.ExecEvent) {
+    this.checkHookLibrary(e)
+    if !this.mconf.NoFollowExec {
+        return
+    }
+    this.Lock()
+    defer this.Unlock()
+    key := e.Pid + util.PID_BLACKLIST_START
+    for _, bpf_map := range this.common_list {
+        err := bpf_map.Update(unsafe.Pointer(&key), unsafe.Pointer(&key), ebpf.UpdateAny)
+        if err != nil {
+            this.logger.Printf("stop following pid:%d failed, err:%v", e.Pid, err)
+            return
+        }
+    }
+    this.logger.Printf("stop following pid:%d after exec %s", e.Pid, e.Filename)
+}
+
+func elfClass(path string) (elf.Class, error) {
+    f, err := elf.Open(path)
+    if err != nil {
+        return elf.ELFCLASSNONE, err
+    }
+    defer f.Close()
+    return f.Class, nil
+}
+
+// 与程序映像位数一致的同名库 比如 /system/lib64/libc.so 对应 /system/lib/libc.so
+func findLibraryForClass(lib_path string, class elf.Class) string {
+    pairs := [][2]string{{"/lib64/", "/lib/"}, {"/arm64/", "/arm/"}, {"/x86_64/", "/x86/"}}
+    for _, pair := range pairs {
+        for _, from_to := range [][2]string{{pair[0], pair[1]}, {pair[1], pair[0]}} {
+            if !strings.Contains(lib_path, from_to[0]) {
+                continue
+            }
+            candidate := strings.Replace(lib_path, from_to[0], from_to[1], 1)
+            if candidate_class, err := elfClass(candidate); err == nil && candidate_class == class {
+                return candidate
+            }
+        }
+    }
+    return ""
+}
+
+func (this *ExecFollower) checkHookLibrary(e *event.ExecEvent) {
+    // uprobe 按文件挂载 新映像加载同一个库时仍然有效
+    // 但是 32 位与 64 位程序使用的是不同的库 这个进程中的 hook 点都不会再命中
+    // eBPF 程序按位数分别编译 无法在运行中切换 所以明确报告失效的 hook 点
+    conf := this.mconf.StackUprobeConf
+    if !conf.IsEnable() || conf.RealFilePath == "" {
+        return
+    }
+    lib_class, err := elfClass(conf.RealFilePath)
+    if err != nil {
+        return
+    }
+    // filename 可能是相对于进程工作目录的路径 优先通过 exe 读取
+    image_class, err := elfClass(fmt.Sprintf("/proc/%d/exe", e.Pid))
+    if err != nil {
+        image_class, err = elfClass(e.Filename)
+        if err != nil {
+            return
+        }
+    }
+    if lib_class == image_class {
+        return
+    }
+    var point_names []string
+    for _, point := range conf.Points {
+        if !point.IsExitPoint() {
+            point_names = append(point_names, point.Name)
+        }
+    }
+    this.logger.Printf("error, pid:%d exec %s is %s, hooked library %s is %s, points [%s] will not hit in this process", e.Pid, e.Filename, image_class, conf.LibPath, lib_class, strings.Join(point_names, ","))
+    if lib_path := findLibraryForClass(conf.RealFilePath, image_class); lib_path != "" {
+        this.logger.Printf("pid:%d to hook the new image, run another stackplz with -l %s", e.Pid, lib_path)
+    }
+}
+
+func init() {
+    mod := &MExec{}
+    mod.name = MODULE_NAME_EXEC
+    mod.mType = PROBE_TYPE_TRACEPOINT
+    Register(mod)
+}
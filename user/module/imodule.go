@@ -7,6 +7,7 @@ import (
     "log"
     "os"
     "reflect"
+    "stackplz/user/common"
     "stackplz/user/config"
     "stackplz/user/event"
     "stackplz/user/event_processor"
@@ -78,7 +79,7 @@ func (this *Module) Init(ctx context.Context, logger *log.Logger, conf config.IC
     } else {
         this.mconf = p
     }
-    this.processor = event_processor.NewEventProcessor(logger)
+    this.processor = event_processor.NewEventProcessor(logger, this.mconf)
 
 }
 
@@ -183,13 +184,17 @@ func (this *Module) getExtraOptions(em *ebpf.Map) perf.ExtraPerfOptions {
     map_value := reflect.ValueOf(em)
     map_name := map_value.Elem().FieldByName("name")
     IsMmapEvent := map_name.String() == "fake_events"
+    // 崩溃事件总是需要寄存器和栈数据
+    IsCrashEvent := map_name.String() == "crash_events"
+    // exec 事件只关心映像变化
+    IsExecEvent := map_name.String() == "exec_events" || map_name.String() == "task_exit_events"
 
     // http://aospxref.com/android-11.0.0_r21/xref/system/extras/simpleperf/perf_regs.cpp#82
     var RegMask uint64
     if this.mconf.Is32Bit {
         RegMask = (1 << PERF_REG_ARM_MAX) - 1
     } else {
-        RegMask = (1 << PERF_REG_ARM64_MAX) - 1
+        RegMask = common.PerfRegMask
     }
     var ShowRegs bool
     if this.mconf.RegName != "" {
@@ -197,6 +202,19 @@ func (this *Module) getExtraOptions(em *ebpf.Map) perf.ExtraPerfOptions {
     } else {
         ShowRegs = this.mconf.ShowRegs
     }
+    // 断点读取参数依赖寄存器数据
+    if len(this.mconf.BrkArgs) > 0 {
+        ShowRegs = true
+    }
+    UnwindStack := this.mconf.UnwindStack
+    if IsCrashEvent {
+        UnwindStack = true
+        ShowRegs = true
+    }
+    if IsExecEvent {
+        UnwindStack = false
+        ShowRegs = false
+    }
     BrkPid := this.mconf.BrkPid
     // 对内核地址断点的时候无法指定pid为用户进程的pid
     if this.mconf.BrkKernel {
@@ -204,7 +222,7 @@ func (this *Module) getExtraOptions(em *ebpf.Map) perf.ExtraPerfOptions {
         BrkPid = -1
     }
     return perf.ExtraPerfOptions{
-        UnwindStack:       this.mconf.UnwindStack,
+        UnwindStack:       UnwindStack,
         ShowRegs:          ShowRegs,
         PerfMmap:          IsMmapEvent,
         BrkPid:            BrkPid,
@@ -270,6 +288,10 @@ func (this *Module) perfEventReader(errChan chan error, em *ebpf.Map) {
                 this.logger.Printf("%s\tthis.child.decode error:%v", this.child.Name(), err)
                 continue
             }
+            // 断点命中时目标进程不会停下 读取内存不能等到 processor 中再做
+            if hit, ok := e.(event.IHitCapture); ok {
+                hit.CaptureHit()
+            }
             // 准备完成将数据交给 processor 处理
             // 从而加快读取环形缓冲区的数据 减缓数据丢失的概率
             this.processor.Write(e)
@@ -102,6 +102,8 @@ func (this *PerfMMAP) start() error {
 		return fmt.Errorf("couldn't init manager %v", err)
 	}
 
+	// 线程的原始名称需要在接收事件之前记录
+	event.ScanThreadNames()
 	if err = this.bpfManager.Start(); err != nil {
 		return fmt.Errorf("couldn't start bootstrap manager %v .", err)
 	}
@@ -0,0 +1,184 @@
+package module
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "stackplz/user/config"
+    "stackplz/user/event"
+    "stackplz/user/util"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unsafe"
+
+    "github.com/cilium/ebpf"
+)
+
+// 运行中新出现的目标进程无法在启动时加入 pid 白名单 主要有两类
+// - isolated 进程由 zygote 孵化 uid 与应用无关 无法通过 uid 或者父子关系匹配
+// - --comm --exe 指定的进程 可能由不被追踪的进程启动
+// 所以在进程改名(包括 exec)后检查是否为目标进程 是则加入 pid 白名单
+type ProcessTracker struct {
+    sync.Mutex
+    logger      *log.Logger
+    mconf       *config.ModuleConfig
+    common_list []*ebpf.Map
+    pids        map[uint32]bool
+}
+
+var process_tracker *ProcessTracker
+var process_tracker_once sync.Once
+
+func GetProcessTracker(mconf *config.ModuleConfig, logger *log.Logger) *ProcessTracker {
+    process_tracker_once.Do(func() {
+        process_tracker = &ProcessTracker{}
+        process_tracker.logger = logger
+        process_tracker.mconf = mconf
+        process_tracker.pids = make(map[uint32]bool)
+        event.AddThreadNameHook(process_tracker.onThreadName)
+    })
+    return process_tracker
+}
+
+func (this *ProcessTracker) AddMap(bpf_map *ebpf.Map) {
+    this.Lock()
+    defer this.Unlock()
+    this.common_list = append(this.common_list, bpf_map)
+    for pid := range this.pids {
+        this.updateMap(bpf_map, pid)
+    }
+}
+
+func (this *ProcessTracker) updateMap(bpf_map *ebpf.Map, pid uint32) {
+    key := util.PID_WHITELIST_START + pid
+    err := bpf_map.Update(unsafe.Pointer(&key), unsafe.Pointer(&key), ebpf.UpdateAny)
+    if err != nil {
+        this.logger.Printf("add tracked pid:%d failed, err:%v", pid, err)
+    }
+}
+
+// pid 被复用后 不应继续命中白名单
+func (this *ProcessTracker) deleteMap(bpf_map *ebpf.Map, pid uint32) {
+    key := util.PID_WHITELIST_START + pid
+    err := bpf_map.Delete(unsafe.Pointer(&key))
+    if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+        this.logger.Printf("remove tracked pid:%d failed, err:%v", pid, err)
+    }
+}
+
+func readProcUid(pid uint32) (uint32, error) {
+    f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+    if err != nil {
+        return 0, err
+    }
+    defer f.Close()
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        // Uid:	10123	10123	10123	10123
+        fields := strings.Fields(scanner.Text())
+        if len(fields) >= 2 && fields[0] == "Uid:" {
+            value, err := strconv.ParseUint(fields[1], 10, 32)
+            if err != nil {
+                return 0, err
+            }
+            return uint32(value), nil
+        }
+    }
+    return 0, fmt.Errorf("no uid in /proc/%d/status", pid)
+}
+
+func (this *ProcessTracker) matchPackage(pid uint32) bool {
+    uid, err := readProcUid(pid)
+    if err != nil {
+        return false
+    }
+    app_id := util.GetAppId(uid)
+    if app_id < 99000 || app_id > 99999 || !this.mconf.MatchUser(uid) {
+        return false
+    }
+    content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+    if err != nil {
+        return false
+    }
+    name := string(bytes.SplitN(content, []byte{0}, 2)[0])
+    for _, pkg_name := range this.mconf.PkgNamelist {
+        if name == pkg_name || strings.HasPrefix(name, pkg_name+":") {
+            return true
+        }
+    }
+    return false
+}
+
+func (this *ProcessTracker) matchProcess(pid uint32, comm string) bool {
+    for _, name := range this.mconf.CommNamelist {
+        if util.MatchComm(comm, name) {
+            return true
+        }
+    }
+    if len(this.mconf.ExeNamelist) > 0 {
+        exe_path, err := util.ReadExeByPid(pid)
+        if err == nil {
+            for _, exe := range this.mconf.ExeNamelist {
+                if util.MatchExe(exe_path, exe) {
+                    return true
+                }
+            }
+        }
+    }
+    if len(this.mconf.PkgNamelist) > 0 {
+        return this.matchPackage(pid)
+    }
+    return false
+}
+
+func (this *ProcessTracker) check(pid uint32, comm string) bool {
+    if !this.matchProcess(pid, comm) {
+        return false
+    }
+    this.Lock()
+    defer this.Unlock()
+    if this.pids[pid] {
+        return true
+    }
+    this.pids[pid] = true
+    for _, bpf_map := range this.common_list {
+        this.updateMap(bpf_map, pid)
+    }
+    this.logger.Printf("trace process pid:%d comm:%s", pid, comm)
+    return true
+}
+
+func (this *ProcessTracker) onThreadName(pid, tid uint32, comm string) {
+    if comm == "" {
+        // 进程退出 pid 可能被复用
+        if pid == tid {
+            this.Lock()
+            if this.pids[pid] {
+                delete(this.pids, pid)
+                for _, bpf_map := range this.common_list {
+                    this.deleteMap(bpf_map, pid)
+                }
+            }
+            this.Unlock()
+        }
+        return
+    }
+    // 只关心主线程改名 也就是进程名的设定
+    if pid != tid {
+        return
+    }
+    // 改名和 cmdline 的设定有先后 稍后再检查一次
+    go func() {
+        if this.check(pid, comm) {
+            return
+        }
+        time.Sleep(100 * time.Millisecond)
+        this.check(pid, comm)
+    }()
+}
@@ -9,10 +9,8 @@ import (
     "math"
     "path/filepath"
     "stackplz/assets"
-    "stackplz/user/argtype"
     "stackplz/user/config"
     "stackplz/user/event"
-    "stackplz/user/util"
     "strings"
     "unsafe"
 
@@ -171,47 +169,20 @@ func (this *MSyscall) start() error {
     return nil
 }
 
-func (this *MSyscall) update_map(map_name string, filter_key uint32, filter_value interface{}) {
-    bpf_map, err := this.FindMap(map_name)
-    if err != nil {
-        panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
-    }
-    err = bpf_map.Update(unsafe.Pointer(&filter_key), filter_value, ebpf.UpdateAny)
-    if err != nil {
-        panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
-    }
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
-    }
-}
-
-func (this *MSyscall) update_base_config() {
-    // 更新 base_config 用作基础的过滤 比如排除 stackplz 自身相关的调用
-    var filter_key uint32 = 0
-    map_name := "base_config"
-    filter_value := this.mconf.GetConfigMap()
-    this.update_map(map_name, filter_key, unsafe.Pointer(&filter_value))
-}
-
-func (this *MSyscall) update_common_list(items []uint32, offset uint32) {
-    map_name := "common_list"
-    bpf_map, err := this.FindMap(map_name)
-    if err != nil {
-        panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
-    }
-    for _, v := range items {
-        v += offset
-        err := bpf_map.Update(unsafe.Pointer(&v), unsafe.Pointer(&v), ebpf.UpdateAny)
+func (this *MSyscall) update_map_entries(entries config.MapEntries) {
+    // map 的内容统一由 config 生成 与 explain 展示的一致
+    for _, entry := range entries {
+        bpf_map, err := this.FindMap(entry.Map)
         if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
+            panic(fmt.Sprintf("find [%s] failed, err:%v", entry.Map, err))
+        }
+        err = bpf_map.Update(entry.Key, entry.Value, ebpf.UpdateAny)
+        if err != nil {
+            panic(fmt.Sprintf("update [%s] failed, key:%s, err:%v", entry.Map, entry.KeyInfo, err))
         }
     }
     if this.mconf.Debug {
-        p, ok := util.START_OFFSETS[offset]
-        if !ok {
-            panic(fmt.Sprintf("offset%d invalid", offset))
-        }
-        this.logger.Printf("update %s success, count:%d offset:%s", map_name, len(items), p)
+        this.logger.Printf("update map entries success, count:%d", len(entries))
     }
 }
 
@@ -224,170 +195,86 @@ func (this *MSyscall) list2string(items []uint32) string {
 }
 
 func (this *MSyscall) update_common_filter() {
-    this.update_common_list(this.mconf.UidWhitelist, util.UID_WHITELIST_START)
-    this.update_common_list(this.mconf.UidBlacklist, util.UID_BLACKLIST_START)
-    this.update_common_list(this.mconf.PidWhitelist, util.PID_WHITELIST_START)
-    this.update_common_list(this.mconf.PidBlacklist, util.PID_BLACKLIST_START)
-    this.update_common_list(this.mconf.TidWhitelist, util.TID_WHITELIST_START)
-    this.update_common_list(this.mconf.TidBlacklist, util.TID_BLACKLIST_START)
     this.logger.Printf("uid => whitelist:[%s];blacklist:[%s]", this.list2string(this.mconf.UidWhitelist), this.list2string(this.mconf.UidBlacklist))
     this.logger.Printf("pid => whitelist:[%s];blacklist:[%s]", this.list2string(this.mconf.PidWhitelist), this.list2string(this.mconf.PidBlacklist))
     this.logger.Printf("tid => whitelist:[%s];blacklist:[%s]", this.list2string(this.mconf.TidWhitelist), this.list2string(this.mconf.TidBlacklist))
-    var filter_key uint32 = 0
-    map_name := "common_filter"
-    filter_value := this.mconf.GetCommonFilter()
-    this.update_map(map_name, filter_key, unsafe.Pointer(&filter_value))
-}
-
-func (this *MSyscall) update_child_parent() {
-    // 这个可以合并到 common_list 后面改进
-    map_name := "child_parent_map"
-    for _, v := range this.mconf.PidWhitelist {
-        this.update_map(map_name, v, unsafe.Pointer(&v))
-    }
-}
-
-func (this *MSyscall) update_thread_filter() {
-    map_name := "thread_filter"
-    bpf_map, err := this.FindMap(map_name)
-    if err != nil {
-        panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
-    }
-
-    for _, v := range this.mconf.DefaultThreadBlacklist() {
-        if len(v) > 16 {
-            panic(fmt.Sprintf("[%s] thread name max len is 16", v))
-        }
-        filter_value := THREAD_NAME_BLACKLIST
-        filter_key := config.ThreadFilter{}
-        copy(filter_key.ThreadName[:], v)
-        err = bpf_map.Update(unsafe.Pointer(&filter_key), unsafe.Pointer(&filter_value), ebpf.UpdateAny)
+    if this.mconf.HasRuntimeTarget() {
+        // 运行中新出现的目标进程 比如目标应用的 isolated 进程
+        bpf_map, err := this.FindMap("common_list")
         if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
+            panic(fmt.Sprintf("find [common_list] failed, err:%v", err))
         }
-    }
-    for _, v := range this.mconf.TNameBlacklist {
-        if len(v) > 16 {
-            panic(fmt.Sprintf("[%s] thread name max len is 16", v))
-        }
-        filter_value := THREAD_NAME_BLACKLIST
-        filter_key := config.ThreadFilter{}
-        copy(filter_key.ThreadName[:], v)
-        err = bpf_map.Update(unsafe.Pointer(&filter_key), unsafe.Pointer(&filter_value), ebpf.UpdateAny)
-        if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
-        }
-    }
-    for _, v := range this.mconf.TNameWhitelist {
-        if len(v) > 16 {
-            panic(fmt.Sprintf("[%s] thread name max len is 16", v))
-        }
-        filter_value := THREAD_NAME_WHITELIST
-        filter_key := config.ThreadFilter{}
-        copy(filter_key.ThreadName[:], v)
-        err = bpf_map.Update(unsafe.Pointer(&filter_key), unsafe.Pointer(&filter_value), ebpf.UpdateAny)
-        if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
-        }
-    }
-
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
+        GetProcessTracker(this.mconf, this.logger).AddMap(bpf_map)
     }
 }
 
-func (this *MSyscall) update_arg_filter() {
-    map_name := "arg_filter"
-    bpf_map, err := this.FindMap(map_name)
-    if err != nil {
-        panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
-    }
-    // w/white b/black
-    // 对于返回值以特定字符串开头的进行过滤 如果要对非首个字符串参数做过滤 那么通过 | 标识占位
-    // ./stackplz -n com.termux -s "openat:f0.f2,readlinkat:|f1" -f w:/data -f w:/apex -f w:/dev
-
-    for _, filter := range config.GetFilters() {
-        filter_key := uint64(filter.Filter_index)
-        filter_value := filter.ToEbpfValue()
-        err = bpf_map.Update(unsafe.Pointer(&filter_key), unsafe.Pointer(&filter_value), ebpf.UpdateAny)
+func (this *MSyscall) update_thread_filter() {
+    // 带通配符的线程名在运行时匹配 其余的已经写入 thread_filter
+    if this.mconf.HasThreadNameGlob() {
+        match_map, err := this.FindMap("thread_name_match")
         if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
+            panic(fmt.Sprintf("find [thread_name_match] failed, err:%v", err))
         }
-    }
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
+        GetThreadNameMatcher(this.mconf, this.logger).AddMap(match_map)
     }
 }
 
-func (this *MSyscall) update_sysenter_point_args() {
-    map_name := "sysenter_point_args"
+func (this *MSyscall) update_caller_ranges() {
+    if !this.mconf.Caller.IsEnable() {
+        return
+    }
+    map_name := "caller_ranges"
     bpf_map, err := this.FindMap(map_name)
     if err != nil {
         panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
     }
-    for _, syscall_point := range this.mconf.SysCallConf.PointArgs {
-        point_config := syscall_point.GetEnterConfig()
-        // syscall 已经通过了测试 暂时不需要
-        // point_config.MaxOpCount = this.mconf.MaxOp
-        err := bpf_map.Update(unsafe.Pointer(&syscall_point.Nr), unsafe.Pointer(&point_config), ebpf.UpdateAny)
-        if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
-        }
-    }
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
-    }
+    GetCallerRangeManager(this.mconf, this.logger).AddMap(bpf_map)
 }
 
-func (this *MSyscall) update_sysexit_point_args() {
-    map_name := "sysexit_point_args"
+func (this *MSyscall) update_exec_follower() {
+    if !this.mconf.NoFollowExec {
+        return
+    }
+    map_name := "common_list"
     bpf_map, err := this.FindMap(map_name)
     if err != nil {
         panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
     }
-    for _, syscall_point := range this.mconf.SysCallConf.PointArgs {
-        point_config := syscall_point.GetExitConfig()
-        // syscall 已经通过了测试 暂时不需要
-        // point_config.MaxOpCount = this.mconf.MaxOp
-        err := bpf_map.Update(unsafe.Pointer(&syscall_point.Nr), unsafe.Pointer(&point_config), ebpf.UpdateAny)
-        if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
-        }
-    }
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
-    }
+    GetExecFollower(this.mconf, this.logger).AddMap(bpf_map)
 }
 
-func (this *MSyscall) update_op_list() {
-    map_name := "op_list"
+func (this *MSyscall) report_point_counter() {
+    map_name := "point_counter"
     bpf_map, err := this.FindMap(map_name)
     if err != nil {
-        panic(fmt.Sprintf("find [%s] failed, err:%v", map_name, err))
+        this.logger.Printf("find [%s] failed, err:%v", map_name, err)
+        return
     }
-    for op_key, op_config := range argtype.GetALLOpList() {
-        err := bpf_map.Update(unsafe.Pointer(&op_key), unsafe.Pointer(&op_config), ebpf.UpdateAny)
-        if err != nil {
-            panic(fmt.Sprintf("update [%s] failed, err:%v", map_name, err))
+    for _, point := range this.mconf.SysCallConf.PointArgs {
+        if !point.Limit.IsEnable() {
+            continue
         }
+        var counter config.PointCounter
+        var filter_key uint32 = point.Nr
+        // 没有命中过的 hook 点不存在对应的计数
+        bpf_map.Lookup(unsafe.Pointer(&filter_key), unsafe.Pointer(&counter))
+        this.logger.Printf("[%s] limit:%s hits:%d output:%d dropped:%d", point.Name, point.Limit.String(), counter.Hits, counter.Output, counter.Dropped)
     }
+}
 
-    if this.mconf.Debug {
-        this.logger.Printf("update %s success", map_name)
-    }
+func (this *MSyscall) Close() error {
+    this.report_point_counter()
+    return this.Module.Close()
 }
 
 func (this *MSyscall) updateFilter() (err error) {
-    this.update_base_config()
+    this.update_map_entries(this.mconf.GetFilterMapEntries())
+    this.update_map_entries(this.mconf.GetArgMapEntries())
+    this.update_map_entries(this.mconf.GetSyscallMapEntries())
     this.update_common_filter()
-    this.update_child_parent()
     this.update_thread_filter()
-    this.update_arg_filter()
-    this.update_sysenter_point_args()
-    this.update_sysexit_point_args()
-    this.update_op_list()
-    this.update_common_list(this.mconf.SysCallConf.SysWhitelist, util.SYS_WHITELIST_START)
-    this.update_common_list(this.mconf.SysCallConf.SysBlacklist, util.SYS_BLACKLIST_START)
+    this.update_caller_ranges()
+    this.update_exec_follower()
     if this.mconf.Debug {
         this.logger.Printf("SysCallConf:%s", this.mconf.SysCallConf.Info())
     }
@@ -0,0 +1,105 @@
+package module
+
+import (
+    "errors"
+    "log"
+    "os"
+    "stackplz/user/config"
+    "stackplz/user/event"
+    "sync"
+    "unsafe"
+
+    "github.com/cilium/ebpf"
+)
+
+// 维护通配符线程名规则的匹配结果 线程改名时重新计算
+// 结果按 tid 写入各个模块的 thread_name_match 在内核中作为 thread_filter 的补充
+type ThreadNameMatcher struct {
+    sync.Mutex
+    logger   *log.Logger
+    mconf    *config.ModuleConfig
+    bpf_maps []*ebpf.Map
+    flags    map[uint32]uint32
+}
+
+var thread_name_matcher *ThreadNameMatcher
+var thread_name_once sync.Once
+
+func GetThreadNameMatcher(mconf *config.ModuleConfig, logger *log.Logger) *ThreadNameMatcher {
+    thread_name_once.Do(func() {
+        thread_name_matcher = &ThreadNameMatcher{}
+        thread_name_matcher.logger = logger
+        thread_name_matcher.mconf = mconf
+        thread_name_matcher.flags = make(map[uint32]uint32)
+        event.AddThreadNameHook(thread_name_matcher.onThreadName)
+        // 已经存在的线程 直接读取当前的线程名
+        thread_name_matcher.scanThreads()
+    })
+    return thread_name_matcher
+}
+
+func (this *ThreadNameMatcher) scanThreads() {
+    event.ScanThreadNames()
+    for tid, name := range event.GetThreadNames() {
+        this.onThreadName(name.Pid, tid, name.Current)
+    }
+}
+
+func (this *ThreadNameMatcher) AddMap(bpf_map *ebpf.Map) {
+    this.Lock()
+    defer this.Unlock()
+    this.bpf_maps = append(this.bpf_maps, bpf_map)
+    for tid, flag := range this.flags {
+        this.updateMap(bpf_map, tid, flag)
+    }
+}
+
+func (this *ThreadNameMatcher) updateMap(bpf_map *ebpf.Map, tid, flag uint32) {
+    var err error
+    if flag == 0 {
+        err = bpf_map.Delete(unsafe.Pointer(&tid))
+        if errors.Is(err, ebpf.ErrKeyNotExist) {
+            err = nil
+        }
+    } else {
+        err = bpf_map.Update(unsafe.Pointer(&tid), unsafe.Pointer(&flag), ebpf.UpdateAny)
+    }
+    if err != nil {
+        this.logger.Printf("update [thread_name_match] tid:%d failed, err:%v", tid, err)
+    }
+}
+
+func (this *ThreadNameMatcher) onThreadName(pid, tid uint32, comm string) {
+    if pid == uint32(os.Getpid()) {
+        return
+    }
+    var flag uint32
+    if comm != "" {
+        blacklist, whitelist := this.mconf.MatchThreadNameGlob(comm)
+        if blacklist {
+            flag = config.THREAD_NAME_BLACKLIST
+        } else if whitelist {
+            flag = config.THREAD_NAME_WHITELIST
+        }
+    }
+    this.Lock()
+    defer this.Unlock()
+    old_flag, ok := this.flags[tid]
+    if !ok && flag == 0 {
+        return
+    }
+    if old_flag == flag {
+        return
+    }
+    if flag == 0 {
+        delete(this.flags, tid)
+    } else {
+        this.flags[tid] = flag
+    }
+    for _, bpf_map := range this.bpf_maps {
+        this.updateMap(bpf_map, tid, flag)
+    }
+    if this.mconf.Debug {
+        this.logger.Printf("thread name match pid:%d tid:%d comm:%s flag:%d", pid, tid, comm, flag)
+    }
+}
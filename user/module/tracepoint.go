@@ -0,0 +1,113 @@
+package module
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "log"
+    "path/filepath"
+    "stackplz/assets"
+    "stackplz/user/config"
+    "stackplz/user/event"
+
+    "github.com/cilium/ebpf"
+    manager "github.com/ehids/ebpfmanager"
+)
+
+// 只挂载 raw_tracepoint 并通过单独的 perf map 输出事件的模块 比如 exec 和 crash
+// 进程过滤相关的 map 与 syscall 模块一致 所以直接复用其更新逻辑
+type MTracepoint struct {
+    MSyscall
+    probes []*manager.Probe
+    events []tracepointEvent
+}
+
+// perf map 的名字与解析其中事件的结构
+type tracepointEvent struct {
+    mapName string
+    decoder event.IEventStruct
+}
+
+func (this *MTracepoint) initTracepoint(ctx context.Context, logger *log.Logger, conf config.IConfig, child IModule, bpf_file string) {
+    this.Module.Init(ctx, logger, conf)
+    this.Module.SetChild(child)
+    this.eventMaps = make([]*ebpf.Map, 0, 2)
+    this.eventFuncMaps = make(map[*ebpf.Map]event.IEventStruct)
+    this.hookBpfFile = bpf_file
+    // fork 处理在 src/common/fork.h 中 子进程同样需要过滤
+    this.addProbe("sched_process_fork", "tracepoint__sched__sched_process_fork")
+}
+
+func (this *MTracepoint) addProbe(tracepoint, func_name string) {
+    probe := &manager.Probe{
+        Section:      "raw_tracepoint/" + tracepoint,
+        EbpfFuncName: func_name,
+    }
+    this.probes = append(this.probes, probe)
+}
+
+func (this *MTracepoint) addEvent(map_name string, decoder event.IEventStruct) {
+    this.events = append(this.events, tracepointEvent{map_name, decoder})
+}
+
+func (this *MTracepoint) GetConf() config.IConfig {
+    return this.mconf
+}
+
+func (this *MTracepoint) setupManager() error {
+    maps := []*manager.Map{}
+    for _, item := range this.events {
+        maps = append(maps, &manager.Map{Name: item.mapName})
+    }
+    this.bpfManager = &manager.Manager{
+        Probes: this.probes,
+        Maps:   maps,
+    }
+    return nil
+}
+
+func (this *MTracepoint) Close() error {
+    // 不涉及 hook 点的计数
+    return this.Module.Close()
+}
+
+func (this *MTracepoint) start() error {
+    err := this.setupManager()
+    if err != nil {
+        return err
+    }
+    this.setupManagerOptions()
+
+    var bpfFileName = filepath.Join("user/assets", this.hookBpfFile)
+    byteBuf, err := assets.Asset(bpfFileName)
+    if err != nil {
+        return fmt.Errorf("%s\tcouldn't find asset %v .", this.Name(), err)
+    }
+
+    if err = this.bpfManager.InitWithOptions(bytes.NewReader(byteBuf), this.bpfManagerOptions); err != nil {
+        return fmt.Errorf("couldn't init manager %v", err)
+    }
+
+    if err = this.bpfManager.Start(); err != nil {
+        return fmt.Errorf("couldn't start bootstrap manager %v .", err)
+    }
+
+    // 只需要进程过滤相关的设定
+    this.update_map_entries(this.mconf.GetFilterMapEntries())
+    this.update_common_filter()
+    this.update_thread_filter()
+
+    return this.initDecodeFun()
+}
+
+func (this *MTracepoint) initDecodeFun() error {
+    for _, item := range this.events {
+        events_map, err := this.FindMap(item.mapName)
+        if err != nil {
+            return err
+        }
+        this.eventMaps = append(this.eventMaps, events_map)
+        this.eventFuncMaps[events_map] = item.decoder
+    }
+    return nil
+}
@@ -13,6 +13,7 @@ const (
     BOOT_CONFIG_PATH       = "/proc/config.gz"
     CONFIG_DEBUG_INFO_BTF  = "CONFIG_DEBUG_INFO_BTF"
     SYS_KERNEL_BTF_VMLINUX = "/sys/kernel/btf/vmlinux"
+    ANDROID_GETPROP_PATH   = "/system/bin/getprop"
 )
 
 var (
@@ -24,7 +25,21 @@ var (
     }
 )
 
+// 以 getprop 是否存在判断是不是安卓环境 普通 Linux 上跳过 pm getprop 之类的操作
+func IsAndroid() bool {
+    _, err := os.Stat(ANDROID_GETPROP_PATH)
+    return err == nil
+}
+
 func GetSystemConfig() (map[string]string, error) {
+    _, err := os.Stat(BOOT_CONFIG_PATH)
+    if err != nil && !IsAndroid() {
+        // 常规 Linux 发行版的内核配置一般在 /boot 下
+        uname, e := getOSUnamer()
+        if e == nil {
+            return getAndroidConfig(fmt.Sprintf("/boot/config-%s", uname.Release))
+        }
+    }
     return getAndroidConfig(BOOT_CONFIG_PATH)
 }
 
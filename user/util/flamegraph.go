@@ -0,0 +1,165 @@
+package util
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 折叠栈 即 Brendan Gregg 的 folded stack 格式
+// 每一行为 root;...;leaf count
+// 同时提供一个简单的 svg 火焰图输出 不依赖 flamegraph.pl
+
+const (
+	FLAME_WIDTH        = 1200
+	FLAME_FRAME_HEIGHT = 16
+	FLAME_PAD_TOP      = 40
+	FLAME_PAD_SIDE     = 10
+	FLAME_MIN_WIDTH    = 0.1
+)
+
+type flameNode struct {
+	name     string
+	count    uint64
+	children map[string]*flameNode
+}
+
+func newFlameNode(name string) *flameNode {
+	return &flameNode{name: name, children: make(map[string]*flameNode)}
+}
+
+func (this *flameNode) sortedChildren() []*flameNode {
+	var nodes []*flameNode
+	for _, node := range this.children {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	return nodes
+}
+
+func (this *flameNode) depth() int {
+	max_depth := 0
+	for _, node := range this.children {
+		if d := node.depth(); d > max_depth {
+			max_depth = d
+		}
+	}
+	return max_depth + 1
+}
+
+type FlameGraph struct {
+	folded map[string]uint64
+	root   *flameNode
+}
+
+func NewFlameGraph() *FlameGraph {
+	fg := &FlameGraph{}
+	fg.folded = make(map[string]uint64)
+	fg.root = newFlameNode("all")
+	return fg
+}
+
+// stack 的顺序为 root 在前 leaf 在后
+func (this *FlameGraph) Add(stack []string, count uint64) {
+	if len(stack) == 0 {
+		return
+	}
+	var frames []string
+	for _, frame := range stack {
+		// ; 是折叠栈的分隔符
+		frames = append(frames, strings.ReplaceAll(frame, ";", ":"))
+	}
+	this.folded[strings.Join(frames, ";")] += count
+	node := this.root
+	node.count += count
+	for _, frame := range frames {
+		child, ok := node.children[frame]
+		if !ok {
+			child = newFlameNode(frame)
+			node.children[frame] = child
+		}
+		child.count += count
+		node = child
+	}
+}
+
+func (this *FlameGraph) IsEmpty() bool {
+	return this.root.count == 0
+}
+
+func (this *FlameGraph) WriteFolded(w io.Writer) error {
+	var keys []string
+	for key := range this.folded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s %d\n", key, this.folded[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func flameColor(name string) string {
+	// 与 flamegraph.pl 的 hot 配色接近 同名函数颜色固定
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	r := 205 + v%50
+	g := (v >> 8) % 230
+	b := (v >> 16) % 55
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
+
+func (this *FlameGraph) writeNode(w io.Writer, node *flameNode, x float64, level int, height int, scale float64) {
+	width := float64(node.count) * scale
+	if width < FLAME_MIN_WIDTH {
+		return
+	}
+	y := height - FLAME_PAD_SIDE - (level+1)*FLAME_FRAME_HEIGHT
+	percent := float64(node.count) * 100 / float64(this.root.count)
+	title := html.EscapeString(fmt.Sprintf("%s (%d samples, %.2f%%)", node.name, node.count, percent))
+	fmt.Fprintf(w, "<g><title>%s</title>", title)
+	fmt.Fprintf(w, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" rx="2" ry="2"/>`, x, y, width, FLAME_FRAME_HEIGHT-1, flameColor(node.name))
+	// 每个字符大约 7 像素宽 放不下就截断
+	max_chars := int(width / 7)
+	if max_chars >= 3 {
+		text := node.name
+		if len(text) > max_chars {
+			text = text[:max_chars-2] + ".."
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%d">%s</text>`, x+3, y+FLAME_FRAME_HEIGHT-4, html.EscapeString(text))
+	}
+	fmt.Fprintf(w, "</g>\n")
+	child_x := x
+	for _, child := range node.sortedChildren() {
+		this.writeNode(w, child, child_x, level+1, height, scale)
+		child_x += float64(child.count) * scale
+	}
+}
+
+func (this *FlameGraph) WriteSVG(w io.Writer, title string) error {
+	depth := this.root.depth()
+	height := depth*FLAME_FRAME_HEIGHT + FLAME_PAD_TOP + FLAME_PAD_SIDE
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">
+<style>text { font-family: Verdana; font-size: 12px; fill: rgb(0,0,0); } rect:hover { stroke: black; stroke-width: 0.5; }</style>
+<rect x="0" y="0" width="100%%" height="100%%" fill="rgb(250,250,235)"/>
+<text x="%d" y="24" text-anchor="middle" style="font-size:17px">%s</text>
+`, FLAME_WIDTH, height, FLAME_WIDTH/2, html.EscapeString(title))
+	if err != nil {
+		return err
+	}
+	if this.root.count > 0 {
+		scale := float64(FLAME_WIDTH-2*FLAME_PAD_SIDE) / float64(this.root.count)
+		this.writeNode(w, this.root, FLAME_PAD_SIDE, 0, height, scale)
+	}
+	_, err = fmt.Fprintf(w, "</svg>\n")
+	return err
+}
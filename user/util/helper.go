@@ -2,12 +2,15 @@ package util
 
 import (
 	"bytes"
+	"debug/elf"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"os/exec"
+	"path"
 	"strconv"
 	"strings"
 	"syscall"
@@ -55,6 +58,18 @@ func UIntToBytes(x uint32) []byte {
 }
 
 func FindRet(lib_path string, sym_offset, sym_size int64) (string, error) {
+	// 32 位 arm 库需要区分 arm 和 thumb 指令
+	is_arm := false
+	if elf_file, err := elf.Open(lib_path); err == nil {
+		is_arm = elf_file.Machine == elf.EM_ARM
+		elf_file.Close()
+	}
+	thumb := false
+	if is_arm && sym_offset&1 == 1 {
+		thumb = true
+		sym_offset &^= 1
+	}
+
 	file, err := os.Open(lib_path)
 	if err != nil {
 		return "", err
@@ -72,26 +87,110 @@ func FindRet(lib_path string, sym_offset, sym_size int64) (string, error) {
 		return "", err
 	}
 
+	if thumb {
+		return FindThumbRet(sym_offset, sym_data), nil
+	}
+	if is_arm {
+		return FindArmRet(sym_offset, sym_data), nil
+	}
 	// https://armconverter.com/?code=RET -> C0035FD6
 	return FindIns(sym_offset, sym_data, []byte{0xC0, 0x03, 0x5F, 0xD6}), nil
 }
 
 func FindIns(sym_offset int64, sym_data, ins []byte) string {
 	var result []string
-	ret_offset := bytes.Index(sym_data, ins)
-	for ret_offset > 0 {
-		result = append(result, fmt.Sprintf("0x%x", sym_offset+int64(ret_offset)))
-		sym_data = sym_data[ret_offset:]
-		ret_offset = bytes.Index(sym_data, ins)
+	// 按指令长度对齐查找 避免匹配到跨指令的数据
+	for offset := 0; offset+len(ins) <= len(sym_data); offset += len(ins) {
+		if bytes.Equal(sym_data[offset:offset+len(ins)], ins) {
+			result = append(result, fmt.Sprintf("0x%x", sym_offset+int64(offset)))
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+func FindArmRet(sym_offset int64, sym_data []byte) string {
+	var result []string
+	for offset := 0; offset+4 <= len(sym_data); offset += 4 {
+		ins := binary.LittleEndian.Uint32(sym_data[offset:])
+		// 不关心条件码
+		// bx lr / pop {..., pc} / ldr pc, [sp], #4
+		if ins&0x0FFFFFFF == 0x012FFF1E || ins&0x0FFF8000 == 0x08BD8000 || ins&0x0FFFFFFF == 0x049DF004 {
+			result = append(result, fmt.Sprintf("0x%x", sym_offset+int64(offset)))
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+func FindThumbRet(sym_offset int64, sym_data []byte) string {
+	var result []string
+	offset := 0
+	for offset+2 <= len(sym_data) {
+		ins := binary.LittleEndian.Uint16(sym_data[offset:])
+		// 高 5 位为 0b11101 0b11110 0b11111 的是 32 位指令
+		if ins>>11 >= 0x1D {
+			if offset+4 > len(sym_data) {
+				break
+			}
+			ins2 := binary.LittleEndian.Uint16(sym_data[offset+2:])
+			// pop.w {..., pc} / ldr.w pc, [sp], #4
+			if (ins == 0xE8BD && ins2&0x8000 != 0) || (ins == 0xF85D && ins2 == 0xFB04) {
+				result = append(result, fmt.Sprintf("0x%x", sym_offset+int64(offset)))
+			}
+			offset += 4
+			continue
+		}
+		// bx lr / pop {..., pc}
+		if ins == 0x4770 || ins&0xFF00 == 0xBD00 {
+			result = append(result, fmt.Sprintf("0x%x", sym_offset+int64(offset)))
+		}
+		offset += 2
 	}
 	return strings.Join(result, ",")
 }
 
+// uid = userId * PER_USER_RANGE + appId
+// packages.list 中记录的是 appId 也就是主用户下的 uid
+const (
+	PER_USER_RANGE   uint32 = 100000
+	TRACE_USER_ALL   uint32 = 0xffffffff
+	DEFAULT_USER_DIR        = "/data/user"
+)
+
+func GetUserId(uid uint32) uint32 {
+	return uid / PER_USER_RANGE
+}
+
+func GetAppId(uid uint32) uint32 {
+	return uid % PER_USER_RANGE
+}
+
+// 列出设备上的全部用户 包括工作资料
+func ListUsers(user_dir string) ([]uint32, error) {
+	entries, err := ioutil.ReadDir(user_dir)
+	if err != nil {
+		return nil, err
+	}
+	var users []uint32
+	for _, entry := range entries {
+		value, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		users = append(users, uint32(value))
+	}
+	return users, nil
+}
+
 type PackageInfo struct {
 	Name string
 	Uid  uint32
 }
 
+// 对应用户下的 uid
+func (this *PackageInfo) UidForUser(user uint32) uint32 {
+	return user*PER_USER_RANGE + GetAppId(this.Uid)
+}
+
 type PackageInfos struct {
 	items []PackageInfo
 }
@@ -105,9 +204,26 @@ func (this *PackageInfos) FindPackageByName(name string) (bool, PackageInfo) {
 	return false, PackageInfo{}
 }
 
+// 包名在各个用户下的 uid system 应用的 uid 与系统进程相同 返回空列表
+func (this *PackageInfos) FindUidsByName(name string, users []uint32) ([]uint32, error) {
+	is_find, info := this.FindPackageByName(name)
+	if !is_find {
+		return nil, errors.New(fmt.Sprintf("can not find pkg_name=%s", name))
+	}
+	if GetAppId(info.Uid) == 1000 {
+		return nil, nil
+	}
+	var uids []uint32
+	for _, user := range users {
+		uids = append(uids, info.UidForUser(user))
+	}
+	return uids, nil
+}
+
 func (this *PackageInfos) FindPackageByUid(uid uint32) (bool, PackageInfo) {
+	// 不同用户下同一个应用的 appId 相同
 	for _, item := range this.items {
-		if item.Uid == uid {
+		if GetAppId(item.Uid) == GetAppId(uid) {
 			return true, item
 		}
 	}
@@ -116,7 +232,7 @@ func (this *PackageInfos) FindPackageByUid(uid uint32) (bool, PackageInfo) {
 
 func (this *PackageInfos) FindPackageByPid(uid uint32) (bool, PackageInfo) {
 	for _, item := range this.items {
-		if item.Uid == uid {
+		if GetAppId(item.Uid) == GetAppId(uid) {
 			return true, item
 		}
 	}
@@ -149,24 +265,102 @@ func (this *PackageInfos) FindUidByPid(pid uint32) uint32 {
 	return uint32(value)
 }
 
-func Get_PackageInfos() *PackageInfos {
+const DEFAULT_PACKAGES_LIST = "/data/system/packages.list"
+
+func Get_PackageInfos(packages_list string) (*PackageInfos, error) {
 	// https://zhuanlan.zhihu.com/p/31124919
 	// /data/system/packages.list
-	content, err := ioutil.ReadFile("/data/system/packages.list")
+	var pis PackageInfos
+	content, err := ioutil.ReadFile(packages_list)
 	if err != nil {
-		panic(err)
+		// 普通 Linux 上没有 packages.list 此时没有任何包信息
+		if !IsAndroid() {
+			return &pis, nil
+		}
+		return nil, errors.New(fmt.Sprintf("read %s failed, err:%v", packages_list, err))
 	}
-	var pis PackageInfos
 	lines := strings.TrimSpace(string(content))
-	for _, line := range strings.Split(lines, "\n") {
+	for line_no, line := range strings.Split(lines, "\n") {
 		parts := strings.Split(line, " ")
+		if len(parts) < 2 {
+			continue
+		}
 		value, err := strconv.ParseUint(parts[1], 10, 32)
 		if err != nil {
-			panic(err)
+			return nil, errors.New(fmt.Sprintf("parse uid %s at %s:%d failed, err:%v", parts[1], packages_list, line_no+1, err))
 		}
 		pis.items = append(pis.items, PackageInfo{parts[0], uint32(value)})
 	}
-	return &pis
+	return &pis, nil
+}
+
+// comm 最长 15 个字符 超出的部分在内核中被截断
+const TASK_COMM_LEN = 16
+
+func MatchComm(comm, name string) bool {
+	if len(name) >= TASK_COMM_LEN {
+		name = name[:TASK_COMM_LEN-1]
+	}
+	return comm == name
+}
+
+// 带路径时完整比较 否则只比较文件名
+func MatchExe(exe_path, exe string) bool {
+	exe_path = strings.TrimSuffix(exe_path, " (deleted)")
+	if strings.Contains(exe, "/") {
+		return exe_path == exe
+	}
+	return path.Base(exe_path) == exe
+}
+
+func ReadCommByPid(pid uint32) (string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func ReadExeByPid(pid uint32) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// 遍历 /proc 找出满足条件的进程 不依赖 ps 之类的外部命令
+func FindPids(match func(pid uint32) bool) []uint32 {
+	var pid_list []uint32
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return pid_list
+	}
+	self_pid := uint32(os.Getpid())
+	for _, entry := range entries {
+		value, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		pid := uint32(value)
+		if pid == self_pid {
+			continue
+		}
+		if match(pid) {
+			pid_list = append(pid_list, pid)
+		}
+	}
+	return pid_list
+}
+
+func FindPidsByComm(name string) []uint32 {
+	return FindPids(func(pid uint32) bool {
+		comm, err := ReadCommByPid(pid)
+		return err == nil && MatchComm(comm, name)
+	})
+}
+
+func FindPidsByExe(exe string) []uint32 {
+	return FindPids(func(pid uint32) bool {
+		exe_path, err := ReadExeByPid(pid)
+		return err == nil && MatchExe(exe_path, exe)
+	})
 }
 
 func ReadMapsByPid(pid uint32) (string, error) {
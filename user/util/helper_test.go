@@ -0,0 +1,68 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindUidsByName(t *testing.T) {
+	all_users, err := ListUsers("testdata/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		packages_list string
+		users         []uint32
+		pkg_name      string
+		expect        []uint32
+		expect_error  string
+	}{
+		{"user_0", "testdata/packages.list", []uint32{0}, "com.example.app", []uint32{10123}, ""},
+		{"user_10", "testdata/packages.list", []uint32{10}, "com.example.work", []uint32{1010245}, ""},
+		{"user_all", "testdata/packages.list", all_users, "com.example.app", []uint32{10123, 1010123}, ""},
+		// system 应用的 uid 与系统进程相同
+		{"system_app", "testdata/packages.list", all_users, "com.android.settings", nil, ""},
+		{"not_found", "testdata/packages.list", []uint32{0}, "com.example.missing", nil, "can not find pkg_name=com.example.missing"},
+		{"bad_uid", "testdata/packages_bad_uid.list", []uint32{0}, "com.example.broken", nil, "parse uid 10x23 at testdata/packages_bad_uid.list:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pis, err := Get_PackageInfos(tt.packages_list)
+			var uids []uint32
+			if err == nil {
+				uids, err = pis.FindUidsByName(tt.pkg_name, tt.users)
+			}
+			if tt.expect_error != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expect_error) {
+					t.Fatalf("expect error %q, got %v", tt.expect_error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(uids, tt.expect) {
+				t.Fatalf("expect %v, got %v", tt.expect, uids)
+			}
+		})
+	}
+}
+
+func TestGetPackageInfosMissing(t *testing.T) {
+	// 普通 Linux 上没有 packages.list 视为没有任何包信息 安卓上则报错
+	pis, err := Get_PackageInfos("testdata/missing.list")
+	if IsAndroid() {
+		if err == nil {
+			t.Fatal("expect error for missing packages.list")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is_find, _ := pis.FindPackageByName("com.example.app"); is_find {
+		t.Fatal("expect no package info")
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// 通过 /proc/pid/mem 读取目标进程内存
+// 用于硬件断点这类没有 eBPF 程序协助读取数据的场景
+type ProcMemReader struct {
+	Pid uint32
+}
+
+func NewProcMemReader(pid uint32) *ProcMemReader {
+	return &ProcMemReader{Pid: pid}
+}
+
+func (this *ProcMemReader) ReadMemory(addr uint64, size uint32) ([]byte, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/mem", this.Pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := make([]byte, size)
+	n, err := f.ReadAt(data, int64(addr))
+	if err != nil {
+		return nil, err
+	}
+	if n != int(size) {
+		return nil, errors.New(fmt.Sprintf("read memory at 0x%x failed, want:%d got:%d", addr, size, n))
+	}
+	return data, nil
+}
+
+// 优先从采样时内核复制的用户栈中读取 这部分是断点命中那一刻的内容
+// 其余的地址仍然通过 /proc/pid/mem 读取
+type SnapshotMemReader struct {
+	Base uint64
+	Data []byte
+	Mem  *ProcMemReader
+}
+
+func NewSnapshotMemReader(pid uint32, base uint64, data []byte) *SnapshotMemReader {
+	return &SnapshotMemReader{Base: base, Data: data, Mem: NewProcMemReader(pid)}
+}
+
+func (this *SnapshotMemReader) ReadMemory(addr uint64, size uint32) ([]byte, error) {
+	if addr >= this.Base && addr+uint64(size) <= this.Base+uint64(len(this.Data)) {
+		offset := addr - this.Base
+		data := make([]byte, size)
+		copy(data, this.Data[offset:offset+uint64(size)])
+		return data, nil
+	}
+	return this.Mem.ReadMemory(addr, size)
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// 以 ptrace 方式启动的目标程序 execve 完成后停在第一条指令之前
+// 此时 pid comm exe 都已经是目标程序自身 等模块全部运行后再 detach 恢复
+type Spawned struct {
+	Pid    int
+	cmd    *exec.Cmd
+	resume chan bool
+	result chan error
+}
+
+func SpawnStopped(argv []string) (*Spawned, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("spawn target is empty")
+	}
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return nil, errors.New(fmt.Sprintf("spawn target %s not found, err:%v", argv[0], err))
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	spawned := &Spawned{
+		cmd:    cmd,
+		resume: make(chan bool),
+		result: make(chan error),
+	}
+	go spawned.trace(argv[0])
+	if err := <-spawned.result; err != nil {
+		return nil, err
+	}
+	spawned.Pid = cmd.Process.Pid
+	return spawned, nil
+}
+
+func (this *Spawned) trace(name string) {
+	// tracer 是启动子进程的那个线程 之后的 ptrace 请求和回收都必须在同一个线程上完成
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := this.cmd.Start(); err != nil {
+		this.result <- err
+		return
+	}
+	var status syscall.WaitStatus
+	_, err := syscall.Wait4(this.cmd.Process.Pid, &status, 0, nil)
+	if err != nil {
+		this.cmd.Process.Kill()
+		this.result <- err
+		return
+	}
+	if !status.Stopped() || status.StopSignal() != syscall.SIGTRAP {
+		this.result <- errors.New(fmt.Sprintf("spawn %s failed, child not stopped after exec, status:0x%x", name, uint32(status)))
+		return
+	}
+	this.result <- nil
+
+	if <-this.resume {
+		err = syscall.PtraceDetach(this.cmd.Process.Pid)
+		this.result <- err
+		if err == nil {
+			// 回收子进程 避免成为僵尸进程
+			this.cmd.Wait()
+			return
+		}
+	}
+	// 停止状态下也能收到 SIGKILL 随后回收子进程
+	this.cmd.Process.Kill()
+	this.cmd.Wait()
+	if err == nil {
+		this.result <- nil
+	}
+}
+
+func ResumeSpawned(spawned *Spawned) error {
+	spawned.resume <- true
+	return <-spawned.result
+}
+
+func KillSpawned(spawned *Spawned) error {
+	spawned.resume <- false
+	return <-spawned.result
+}
@@ -0,0 +1,254 @@
+package util
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const KALLSYMS_PATH = "/proc/kallsyms"
+const KPTR_RESTRICT_PATH = "/proc/sys/kernel/kptr_restrict"
+
+type SymbolInfo struct {
+	Name string
+	Addr uint64
+	Size uint64
+	// 32 位 arm 库中的 thumb 函数 符号值最低位为 1 Addr 中已去掉
+	Thumb bool
+}
+
+type SymbolTable struct {
+	// 按地址升序排列 便于根据地址反查符号
+	symbols []SymbolInfo
+	// 地址是否全部被隐藏 即 kptr_restrict 生效
+	restricted bool
+	// ELF 的 PT_LOAD 段 用于符号值 (虚拟地址) 与文件偏移之间的换算
+	segments []elf.ProgHeader
+}
+
+// 符号值是链接时的虚拟地址 uprobe 和 maps 用的是文件偏移 二者按所在 PT_LOAD 段换算
+func (this *SymbolTable) VaddrToOffset(vaddr uint64) (uint64, bool) {
+	for _, seg := range this.segments {
+		if vaddr >= seg.Vaddr && vaddr < seg.Vaddr+seg.Filesz {
+			return vaddr - seg.Vaddr + seg.Off, true
+		}
+	}
+	return 0, false
+}
+
+func (this *SymbolTable) OffsetToVaddr(offset uint64) (uint64, bool) {
+	for _, seg := range this.segments {
+		if offset >= seg.Off && offset < seg.Off+seg.Filesz {
+			return offset - seg.Off + seg.Vaddr, true
+		}
+	}
+	return 0, false
+}
+
+func (this *SymbolTable) FindByName(name string) (SymbolInfo, bool) {
+	for _, sym := range this.symbols {
+		if sym.Name == name {
+			return sym, true
+		}
+	}
+	return SymbolInfo{}, false
+}
+
+func (this *SymbolTable) FindByAddr(addr uint64) (SymbolInfo, bool) {
+	// 找到地址小于等于 addr 的最后一个符号
+	index := sort.Search(len(this.symbols), func(i int) bool {
+		return this.symbols[i].Addr > addr
+	})
+	if index == 0 {
+		return SymbolInfo{}, false
+	}
+	sym := this.symbols[index-1]
+	if sym.Size != 0 && addr >= sym.Addr+sym.Size {
+		return SymbolInfo{}, false
+	}
+	return sym, true
+}
+
+func (this *SymbolTable) sort() {
+	sort.SliceStable(this.symbols, func(i, j int) bool {
+		return this.symbols[i].Addr < this.symbols[j].Addr
+	})
+}
+
+var sym_lock sync.Mutex
+var kallsyms_table *SymbolTable
+var elf_tables = make(map[string]*SymbolTable)
+
+func KptrRestrictError() error {
+	level := "unknown"
+	content, err := ioutil.ReadFile(KPTR_RESTRICT_PATH)
+	if err == nil {
+		level = strings.TrimSpace(string(content))
+	}
+	return errors.New(fmt.Sprintf("kernel symbol addresses are hidden by kptr_restrict=%s, plz run `echo 0 > %s` first", level, KPTR_RESTRICT_PATH))
+}
+
+func LoadKallsyms() (*SymbolTable, error) {
+	sym_lock.Lock()
+	defer sym_lock.Unlock()
+	if kallsyms_table != nil {
+		return kallsyms_table, nil
+	}
+	content, err := ioutil.ReadFile(KALLSYMS_PATH)
+	if err != nil {
+		return nil, fmt.Errorf("Error when opening file:%v", err)
+	}
+	table := &SymbolTable{}
+	table.restricted = true
+	for _, line := range strings.Split(string(content), "\n") {
+		// ffffffc008010000 T _text
+		// ffffffc0012a3b40 t xxx	[module]
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			continue
+		}
+		addr, err := strconv.ParseUint(parts[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		if addr != 0 {
+			table.restricted = false
+		}
+		table.symbols = append(table.symbols, SymbolInfo{parts[2], addr, 0, false})
+	}
+	table.sort()
+	kallsyms_table = table
+	return kallsyms_table, nil
+}
+
+func FindKallsymsAddr(symbol string) (uint64, error) {
+	table, err := LoadKallsyms()
+	if err != nil {
+		return 0, err
+	}
+	sym, ok := table.FindByName(symbol)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("symbol %s not found in %s", symbol, KALLSYMS_PATH))
+	}
+	if table.restricted {
+		return 0, KptrRestrictError()
+	}
+	return sym.Addr, nil
+}
+
+func FindKallsymsByAddr(addr uint64) (string, bool) {
+	table, err := LoadKallsyms()
+	if err != nil || table.restricted {
+		return "", false
+	}
+	sym, ok := table.FindByAddr(addr)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s+0x%x", sym.Name, addr-sym.Addr), true
+}
+
+func LoadElfSymbols(lib_path string) (*SymbolTable, error) {
+	sym_lock.Lock()
+	defer sym_lock.Unlock()
+	if table, ok := elf_tables[lib_path]; ok {
+		return table, nil
+	}
+	f, err := elf.Open(lib_path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table := &SymbolTable{}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			table.segments = append(table.segments, prog.ProgHeader)
+		}
+	}
+	is_arm := f.Machine == elf.EM_ARM
+	// .symtab 经常被 strip 掉 所以 .dynsym 也要一并读取
+	var all_syms []elf.Symbol
+	if syms, err := f.Symbols(); err == nil {
+		all_syms = append(all_syms, syms...)
+	}
+	if syms, err := f.DynamicSymbols(); err == nil {
+		all_syms = append(all_syms, syms...)
+	}
+	for _, sym := range all_syms {
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC && elf.ST_TYPE(sym.Info) != elf.STT_OBJECT {
+			continue
+		}
+		if sym.Value == 0 || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+		addr := sym.Value
+		thumb := false
+		if is_arm && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && addr&1 == 1 {
+			addr &^= 1
+			thumb = true
+		}
+		table.symbols = append(table.symbols, SymbolInfo{sym.Name, addr, sym.Size, thumb})
+	}
+	table.sort()
+	elf_tables[lib_path] = table
+	return table, nil
+}
+
+func FindElfSymbol(lib_path, symbol string) (SymbolInfo, error) {
+	table, err := LoadElfSymbols(lib_path)
+	if err != nil {
+		return SymbolInfo{}, errors.New(fmt.Sprintf("load symbols from %s failed, err:%v", lib_path, err))
+	}
+	sym, ok := table.FindByName(symbol)
+	if !ok {
+		return SymbolInfo{}, errors.New(fmt.Sprintf("symbol %s not found in %s", symbol, lib_path))
+	}
+	return sym, nil
+}
+
+// 返回符号所在的文件偏移 可直接用于 uprobe
+func FindElfSymbolOffset(lib_path, symbol string) (SymbolInfo, uint64, error) {
+	table, err := LoadElfSymbols(lib_path)
+	if err != nil {
+		return SymbolInfo{}, 0, errors.New(fmt.Sprintf("load symbols from %s failed, err:%v", lib_path, err))
+	}
+	sym, ok := table.FindByName(symbol)
+	if !ok {
+		return SymbolInfo{}, 0, errors.New(fmt.Sprintf("symbol %s not found in %s", symbol, lib_path))
+	}
+	offset, ok := table.VaddrToOffset(sym.Addr)
+	if !ok {
+		return SymbolInfo{}, 0, errors.New(fmt.Sprintf("symbol %s value 0x%x not in any PT_LOAD segment of %s", symbol, sym.Addr, lib_path))
+	}
+	return sym, offset, nil
+}
+
+func FindElfSymbolAddr(lib_path, symbol string) (uint64, error) {
+	sym, err := FindElfSymbol(lib_path, symbol)
+	if err != nil {
+		return 0, err
+	}
+	return sym.Addr, nil
+}
+
+// offset 为库文件内的偏移 先换算为虚拟地址再查符号
+func FindElfSymbolByOffset(lib_path string, offset uint64) (string, bool) {
+	table, err := LoadElfSymbols(lib_path)
+	if err != nil {
+		return "", false
+	}
+	addr, ok := table.OffsetToVaddr(offset)
+	if !ok {
+		return "", false
+	}
+	sym, ok := table.FindByAddr(addr)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s+0x%x", sym.Name, addr-sym.Addr), true
+}